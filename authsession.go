@@ -17,15 +17,12 @@ var errOIDCStaleIDToken = errors.New("oidc stale id_token")
 var errAuthTimerStale = errors.New("auth timer stale")
 var errOIDCInvalidExpiry = errors.New("oidc invalid exp")
 
-type authTimer interface {
-	Stop() bool
-}
-
-type authTimerAfterFunc func(time.Duration, func()) authTimer
-
 type authTimerState struct {
-	timer  authTimer
-	expiry time.Time
+	timer     Timer
+	expiry    time.Time
+	refreshAt time.Time
+	retries   int
+	sess      *jaws.Session
 }
 
 func authTimerEntryExpiry(entry *authTimerState) (expiry time.Time) {
@@ -51,16 +48,16 @@ func tokenDebugAttrs(token *oauth2.Token) []any {
 	return attrs
 }
 
-func realAuthTimerAfterFunc(delay time.Duration, callback func()) authTimer {
-	return time.AfterFunc(delay, callback)
+func (srv *Server) oauth2Context(ctx context.Context) (authctx context.Context) {
+	return srv.providerContext(ctx, srv.defaultProvider())
 }
 
-func (srv *Server) oauth2Context(ctx context.Context) (authctx context.Context) {
+func (srv *Server) providerContext(ctx context.Context, p *provider) (authctx context.Context) {
 	authctx = ctx
 	if srv != nil {
 		client, ok := authctx.Value(oauth2.HTTPClient).(*http.Client)
-		if !ok {
-			client = srv.httpClient
+		if !ok && p != nil {
+			client = p.httpClient
 		}
 		if logger := srv.debugLogger(); logger != nil {
 			authctx = context.WithValue(authctx, oauth2.HTTPClient, srv.debugHTTPClient(client, logger))
@@ -85,14 +82,14 @@ func (srv *Server) sessionAuthStatus(sess *jaws.Session, now func() time.Time) (
 	return
 }
 
-func (srv *Server) storeSessionAuthClaims(ctx context.Context, sess *jaws.Session, claims map[string]any, tokenSource oauth2.TokenSource, expiry time.Time, entry *authTimerState) (err error) {
+func (srv *Server) storeSessionAuthClaims(ctx context.Context, sess *jaws.Session, p *provider, claims map[string]any, tokenSource oauth2.TokenSource, expiry time.Time, entry *authTimerState) (err error) {
 	err = ErrOAuth2NotConfigured
-	if srv != nil {
+	if srv != nil && p != nil {
 		err = ErrOAuth2MissingSession
 		if sess != nil {
 			err = errOIDC{kind: ErrOIDCInvalidIDToken, cause: errOIDCInvalidExpiry}
 			if !expiry.IsZero() {
-				if fallback, e := srv.fetchUserInfo(ctx, srv.userinfoUrl, tokenSource); srv.Jaws.Log(e) == nil {
+				if fallback, e := srv.fetchUserInfo(ctx, p.userinfoUrl, tokenSource); srv.Jaws.Log(e) == nil {
 					mergeMissingClaims(claims, fallback)
 				}
 				if entry != nil {
@@ -103,29 +100,53 @@ func (srv *Server) storeSessionAuthClaims(ctx context.Context, sess *jaws.Sessio
 				}
 				verified := extractEmailVerified(claims)
 				claims["email_verified"] = verified
-				sess.Set(srv.SessionKey, claims)
-				sess.Set(srv.SessionTokenKey, tokenSource)
-				sess.Set(oauth2IDTokenExpiryKey, expiry)
-				sess.Set(srv.SessionEmailKey, srv.extractEmail(claims))
-				sess.Set(srv.SessionEmailVerifiedKey, verified)
-				srv.Jaws.Dirty(sess)
-				srv.scheduleSessionAuthTimer(sess, expiry)
-				err = nil
+				err = srv.checkLoginClaims(claims)
+				var evict []*jaws.Session
+				if login := entry == nil && sess.Get(oauth2AuthTimeKey) == nil; err == nil && login && srv.MaxSessionsPerUser > 0 {
+					if evict, err = srv.limitUserSessions(sess, p, claims); err == nil {
+						defer srv.endPendingLogin(sess)
+					}
+				}
+				if err == nil {
+					sess.Set(srv.SessionKey, claims)
+					sess.Set(srv.SessionTokenKey, tokenSource)
+					sess.Set(oauth2IDTokenExpiryKey, expiry)
+					sess.Set(srv.SessionEmailKey, srv.extractEmail(claims))
+					sess.Set(srv.SessionEmailVerifiedKey, verified)
+					sid, _ := claims["sid"].(string)
+					sess.Set(oauth2SidKey, sid)
+					sess.Set(oauth2ProviderKey, p.name)
+					now := srv.now()
+					if _, ok := sess.Get(oauth2AuthTimeKey).(time.Time); !ok && entry == nil {
+						sess.Set(oauth2AuthTimeKey, now)
+						sess.Set(oauth2LastActivityKey, now)
+					}
+					if _, ok := sess.Get(oauth2LoginTimeKey).(time.Time); !ok {
+						sess.Set(oauth2LoginTimeKey, now)
+					}
+					sess.Set(oauth2LastRefreshKey, now)
+					srv.persistSessionAuth(sess, p, claims, tokenSource, expiry)
+					srv.Jaws.Dirty(sess)
+					srv.scheduleSessionAuthTimer(sess, expiry)
+					for _, old := range evict {
+						srv.clearSessionAuth(old, nil, true, true, nil)
+					}
+				}
 			}
 		}
 	}
 	return
 }
 
-func (srv *Server) setSessionAuthFromToken(ctx context.Context, sess *jaws.Session, tokenSource oauth2.TokenSource, token *oauth2.Token, minExpiry time.Time, entry *authTimerState) (err error) {
+func (srv *Server) setSessionAuthFromToken(ctx context.Context, sess *jaws.Session, p *provider, tokenSource oauth2.TokenSource, token *oauth2.Token, minExpiry time.Time, entry *authTimerState) (err error) {
 	err = ErrOAuth2NotConfigured
-	if srv != nil && srv.idTokenVerifier != nil {
+	if srv != nil && p != nil && p.idTokenVerifier != nil {
 		err = ErrOIDCMissingIDToken
 		if token != nil {
 			rawIDToken, _ := token.Extra("id_token").(string)
 			if rawIDToken != "" {
 				var idToken *oidc.IDToken
-				if idToken, err = srv.idTokenVerifier.Verify(ctx, rawIDToken); wrapOIDC(ErrOIDCInvalidIDToken, &err) == nil {
+				if idToken, err = p.idTokenVerifier.Verify(ctx, rawIDToken); wrapOIDC(ErrOIDCInvalidIDToken, &err) == nil {
 					var claims map[string]any
 					if err = idToken.Claims(&claims); wrapOIDC(ErrOIDCInvalidIDToken, &err) == nil {
 						if idToken.Expiry.IsZero() {
@@ -133,7 +154,7 @@ func (srv *Server) setSessionAuthFromToken(ctx context.Context, sess *jaws.Sessi
 						} else if !minExpiry.IsZero() && !idToken.Expiry.After(minExpiry) {
 							err = errOIDC{kind: ErrOIDCInvalidIDToken, cause: errOIDCStaleIDToken}
 						} else {
-							err = srv.storeSessionAuthClaims(ctx, sess, claims, tokenSource, idToken.Expiry, entry)
+							err = srv.storeSessionAuthClaims(ctx, sess, p, claims, tokenSource, idToken.Expiry, entry)
 						}
 					}
 				}
@@ -155,16 +176,21 @@ func (srv *Server) refreshSessionAuth(ctx context.Context, sess *jaws.Session, m
 		"entry_expiry", authTimerEntryExpiry(entry),
 	)
 	err = ErrOAuth2NotConfigured
-	if srv != nil && sess != nil && srv.oauth2cfg != nil && srv.idTokenVerifier != nil {
+	var p *provider
+	if srv != nil && sess != nil {
+		p = srv.sessionProvider(sess)
+	}
+	if p.valid() {
 		tokenSource, _ := sess.Get(srv.SessionTokenKey).(oauth2.TokenSource)
 		err = ErrOIDCMissingIDToken
 		if tokenSource != nil {
-			authctx := srv.oauth2Context(ctx)
+			authctx := srv.providerContext(ctx, p)
 			var token *oauth2.Token
 			srv.debugLog("jawsauth: requesting token from stored token source", "session_id", sessionID)
 			if token, err = tokenSource.Token(); err == nil {
 				srv.debugLog("jawsauth: stored token source returned token", append([]any{"session_id", sessionID}, tokenDebugAttrs(token)...)...)
-				err = srv.setSessionAuthFromToken(authctx, sess, tokenSource, token, minExpiry, entry)
+				srv.captureRefreshToken(sess, p, tokenSource, token)
+				err = srv.setSessionAuthFromToken(authctx, sess, p, tokenSource, token, minExpiry, entry)
 				if err == nil {
 					srv.debugLog("jawsauth: stored token refreshed session auth", "session_id", sessionID)
 				} else {
@@ -172,12 +198,13 @@ func (srv *Server) refreshSessionAuth(ctx context.Context, sess *jaws.Session, m
 				}
 				if err != nil && token != nil && token.RefreshToken != "" && !errors.Is(err, errAuthTimerStale) {
 					srv.debugErrorLog("jawsauth: forcing refresh with refresh token", err, "session_id", sessionID)
-					tokenSource = srv.oauth2cfg.TokenSource(authctx, &oauth2.Token{
+					tokenSource = p.oauth2cfg.TokenSource(authctx, &oauth2.Token{
 						RefreshToken: token.RefreshToken,
 					})
 					if token, err = tokenSource.Token(); err == nil {
 						srv.debugLog("jawsauth: forced refresh returned token", append([]any{"session_id", sessionID}, tokenDebugAttrs(token)...)...)
-						err = srv.setSessionAuthFromToken(authctx, sess, tokenSource, token, minExpiry, entry)
+						srv.captureRefreshToken(sess, p, tokenSource, token)
+						err = srv.setSessionAuthFromToken(authctx, sess, p, tokenSource, token, minExpiry, entry)
 						if err == nil {
 							srv.debugLog("jawsauth: forced refresh updated session auth", "session_id", sessionID)
 						} else {
@@ -193,13 +220,15 @@ func (srv *Server) refreshSessionAuth(ctx context.Context, sess *jaws.Session, m
 		} else {
 			srv.debugLog("jawsauth: refresh session auth missing token source", "session_id", sessionID)
 		}
+		err = srv.checkRefreshTokenReuse(sess, err)
 	} else {
 		srv.debugLog("jawsauth: refresh session auth not configured",
 			"session_id", sessionID,
 			"server_nil", srv == nil,
 			"session_nil", sess == nil,
-			"oauth2_configured", srv != nil && srv.oauth2cfg != nil,
-			"id_token_verifier_configured", srv != nil && srv.idTokenVerifier != nil,
+			"provider_found", p != nil,
+			"oauth2_configured", p != nil && p.oauth2cfg != nil,
+			"id_token_verifier_configured", p != nil && p.idTokenVerifier != nil,
 		)
 	}
 	return
@@ -207,33 +236,38 @@ func (srv *Server) refreshSessionAuth(ctx context.Context, sess *jaws.Session, m
 
 func (srv *Server) scheduleSessionAuthTimer(sess *jaws.Session, expiry time.Time) {
 	if srv != nil && sess != nil && !expiry.IsZero() {
-		delay := max(time.Until(expiry.Add(-authRefreshSkew)), 0)
-		entry := &authTimerState{expiry: expiry}
-		srv.mu.Lock()
-		if srv.authTimers == nil {
-			srv.authTimers = make(map[uint64]*authTimerState)
-		}
-		if srv.authTimerAfterFunc == nil {
-			srv.authTimerAfterFunc = realAuthTimerAfterFunc
-		}
-		replaced := false
-		if old := srv.authTimers[sess.ID()]; old != nil && old.timer != nil {
-			replaced = true
-			old.timer.Stop()
-		}
-		srv.authTimers[sess.ID()] = entry
-		entry.timer = srv.authTimerAfterFunc(delay, func() {
-			srv.handleSessionAuthTimer(sess, entry)
-		})
-		srv.mu.Unlock()
-		srv.debugLog("jawsauth: scheduled auth refresh timer",
-			"session_id", sess.ID(),
-			"expiry", expiry,
-			"delay", delay,
-			"refresh_skew", authRefreshSkew,
-			"replaced_existing", replaced,
-		)
+		srv.scheduleSessionAuthTimerAt(sess, expiry, srv.RefreshPolicy.refreshAt(expiry, srv.now()))
+	}
+}
+
+func (srv *Server) scheduleSessionAuthTimerAt(sess *jaws.Session, expiry, refreshAt time.Time) {
+	fireAt := refreshAt
+	if deadline := srv.sessionDeadline(sess); !deadline.IsZero() && deadline.Before(fireAt) {
+		fireAt = deadline
+	}
+	delay := max(fireAt.Sub(srv.now()), 0)
+	entry := &authTimerState{expiry: expiry, refreshAt: refreshAt, sess: sess}
+	srv.mu.Lock()
+	if srv.authTimers == nil {
+		srv.authTimers = make(map[uint64]*authTimerState)
+	}
+	replaced := false
+	if old := srv.authTimers[sess.ID()]; old != nil && old.timer != nil {
+		replaced = true
+		old.timer.Stop()
 	}
+	srv.authTimers[sess.ID()] = entry
+	entry.timer = srv.clock().AfterFunc(delay, func() {
+		srv.handleSessionAuthTimer(sess, entry)
+	})
+	srv.mu.Unlock()
+	srv.debugLog("jawsauth: scheduled auth refresh timer",
+		"session_id", sess.ID(),
+		"expiry", expiry,
+		"delay", delay,
+		"refresh_at", refreshAt,
+		"replaced_existing", replaced,
+	)
 }
 
 func (srv *Server) sessionAuthTimerCurrent(sess *jaws.Session, entry *authTimerState) (current bool) {
@@ -270,29 +304,56 @@ func (srv *Server) stopSessionAuthTimer(sess *jaws.Session, entry *authTimerStat
 
 func (srv *Server) handleSessionAuthTimer(sess *jaws.Session, entry *authTimerState) {
 	if srv.sessionAuthTimerCurrent(sess, entry) {
-		current, present := srv.sessionAuthStatus(sess, time.Now)
+		current, present := srv.sessionAuthStatus(sess, srv.now)
 		srv.debugLog("jawsauth: auth refresh timer fired",
 			"session_id", sess.ID(),
 			"entry_expiry", authTimerEntryExpiry(entry),
 			"session_current", current,
 			"session_present", present,
 		)
+		if srv.sessionRevoked(context.Background(), sess, true) {
+			srv.clearSessionAuth(sess, nil, true, true, entry)
+			return
+		}
+		srv.touchLive(sess)
+		now := srv.now()
+		if err := srv.sessionExpired(sess, now); err != nil {
+			srv.debugErrorLog("jawsauth: auth refresh timer found session expired; clearing auth", err, "session_id", sess.ID())
+			srv.clearSessionAuth(sess, nil, true, true, entry)
+			return
+		}
+		if !srv.sessionDeadline(sess).IsZero() && now.Before(entry.refreshAt) {
+			// fired for an idle deadline that activity has since postponed
+			srv.scheduleSessionAuthTimerAt(sess, entry.expiry, entry.refreshAt)
+			return
+		}
+		release := srv.acquireRefresh()
 		err := srv.refreshSessionAuth(context.Background(), sess, entry.expiry, entry)
+		release()
 		if err != nil {
 			if errors.Is(err, errAuthTimerStale) {
 				srv.debugErrorLog("jawsauth: auth refresh timer became stale", err, "session_id", sess.ID())
 				return
 			}
-			current, present = srv.sessionAuthStatus(sess, time.Now)
+			if errors.Is(err, ErrRefreshTokenReuse) {
+				srv.refreshTokenReused(context.Background(), sess, err)
+				srv.clearSessionAuth(sess, nil, true, true, entry)
+				return
+			}
+			current, present = srv.sessionAuthStatus(sess, srv.now)
 			if current && present {
-				retryDelay := max(time.Until(entry.expiry), 0)
+				var retryDelay time.Duration
+				var retries int
 				retryScheduled := false
 				srv.mu.Lock()
 				if srv.authTimers[sess.ID()] == entry {
 					if entry.timer != nil {
 						entry.timer.Stop()
 					}
-					entry.timer = srv.authTimerAfterFunc(retryDelay, func() {
+					retryDelay = srv.RefreshPolicy.retryDelay(entry.retries, entry.expiry, srv.now())
+					entry.retries++
+					retries = entry.retries
+					entry.timer = srv.clock().AfterFunc(retryDelay, func() {
 						srv.handleSessionAuthTimer(sess, entry)
 					})
 					retryScheduled = true
@@ -305,6 +366,7 @@ func (srv *Server) handleSessionAuthTimer(sess *jaws.Session, entry *authTimerSt
 						"session_current", current,
 						"session_present", present,
 						"retry_delay", retryDelay,
+						"retries", retries,
 					)
 					return
 				}
@@ -316,7 +378,12 @@ func (srv *Server) handleSessionAuthTimer(sess *jaws.Session, entry *authTimerSt
 				"session_present", present,
 			)
 			_ = srv.Jaws.Log(err)
-			srv.clearSessionAuth(sess, nil, true, true, entry)
+			p := srv.sessionProvider(sess)
+			loginTime, _ := sess.Get(oauth2LoginTimeKey).(time.Time)
+			if srv.clearSessionAuth(sess, nil, true, false, entry) {
+				srv.markSilentReauth(sess, p, loginTime)
+				sess.Reload()
+			}
 		} else {
 			srv.debugLog("jawsauth: auth refresh timer completed", "session_id", sess.ID())
 		}
@@ -333,16 +400,21 @@ func clearSessionOAuthFlow(sess *jaws.Session) {
 	sess.Set(oauth2PKCEVerifierKey, nil)
 	sess.Set(oauth2NonceKey, nil)
 	sess.Set(oauth2ReferrerKey, nil)
+	sess.Set(oauth2LogoutStateKey, nil)
+	sess.Set(oauth2PendingProviderKey, nil)
+	sess.Set(oauth2StepUpKey, nil)
+	sess.Set(oauth2SilentPendingKey, nil)
 }
 
 // Logout clears all authentication state for the session and returns true if anything
 // was cleared.
 //
 // It stops the auth-refresh timer, clears the OIDC claims, token source, email, expiry
-// and any in-flight OAuth flow keys, calls LogoutEvent (if set), and marks the session
-// dirty. It performs no HTTP redirect, so the caller can build its own post-logout
-// response (for example an RP-initiated end-session redirect). It is safe to call with
-// a nil receiver or nil session.
+// and any in-flight OAuth flow keys, deletes the session's TokenStore record (if any),
+// calls LogoutEvent (if set), and marks the session dirty. It performs no HTTP
+// redirect, so the caller can build its own post-logout response (for example an
+// RP-initiated end-session redirect); HandleLogout also expires the TokenStore
+// cookie. It is safe to call with a nil receiver or nil session.
 func (srv *Server) Logout(sess *jaws.Session, hr *http.Request) (cleared bool) {
 	return srv.clearSessionAuth(sess, hr, true, false, nil)
 }
@@ -356,6 +428,17 @@ func (srv *Server) clearSessionAuth(sess *jaws.Session, hr *http.Request, callLo
 			sess.Set(oauth2IDTokenExpiryKey, nil)
 			sess.Set(srv.SessionEmailKey, nil)
 			sess.Set(srv.SessionEmailVerifiedKey, nil)
+			sess.Set(oauth2SidKey, nil)
+			sess.Set(oauth2ProviderKey, nil)
+			sess.Set(oauth2AuthTimeKey, nil)
+			sess.Set(oauth2LoginTimeKey, nil)
+			sess.Set(oauth2LastRefreshKey, nil)
+			sess.Set(oauth2LastActivityKey, nil)
+			sess.Set(oauth2SilentReauthKey, nil)
+			sess.Set(oauth2RevocationCheckKey, nil)
+			sess.Set(oauth2RefreshTokenKey, nil)
+			sess.Set(oauth2RemoteIPKey, nil)
+			srv.forgetSessionAuth(sess)
 			if callLogout && srv.LogoutEvent != nil {
 				srv.LogoutEvent(sess, hr)
 			}
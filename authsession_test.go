@@ -50,7 +50,11 @@ type testAuthTimerFactory struct {
 	timers []*testAuthTimer
 }
 
-func (factory *testAuthTimerFactory) after(delay time.Duration, callback func()) authTimer {
+func (factory *testAuthTimerFactory) Now() time.Time {
+	return time.Now()
+}
+
+func (factory *testAuthTimerFactory) AfterFunc(delay time.Duration, callback func()) Timer {
 	timer := &testAuthTimer{
 		delay:    delay,
 		callback: callback,
@@ -235,7 +239,7 @@ func TestErrorDebugAttrsIncludeOIDCAndOAuth2Details(t *testing.T) {
 func newTimerTestServer(t *testing.T, jw *jaws.Jaws, issuer string, factory *testAuthTimerFactory) *Server {
 	t.Helper()
 	srv := newWrapperTestServer(jw, issuer)
-	srv.authTimerAfterFunc = factory.after
+	srv.Clock = factory
 	return srv
 }
 
@@ -253,7 +257,7 @@ func TestStoreSessionAuthClaimsSchedulesTimer(t *testing.T) {
 	expiry := time.Now().Add(time.Hour).Truncate(time.Second)
 	tokenSource := oauth2.StaticTokenSource(makeOAuth2Token("access", "", ""))
 
-	err = srv.storeSessionAuthClaims(t.Context(), sess, map[string]any{
+	err = srv.storeSessionAuthClaims(t.Context(), sess, srv.defaultProvider(), map[string]any{
 		"exp":            expiry.Unix(),
 		"email":          "User@Example.COM",
 		"email_verified": "true",
@@ -289,7 +293,8 @@ func TestStoreSessionAuthClaimsSchedulesTimer(t *testing.T) {
 	if !timer.isStopped() {
 		t.Fatal("old timer was not stopped")
 	}
-	if delay := factory.timer(1).delay; delay != 0 {
+	// a token that expires within the skew is refreshed after a quarter of its lifetime
+	if delay := factory.timer(1).delay; delay <= 0 || delay > time.Second/4 {
 		t.Fatal(delay)
 	}
 }
@@ -306,23 +311,23 @@ func TestStoreSessionAuthClaimsErrors(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "http://example.com/protected", nil)
 	sess := jw.NewSession(httptest.NewRecorder(), req)
 
-	err = (*Server)(nil).storeSessionAuthClaims(t.Context(), sess, map[string]any{}, nil, time.Now().Add(time.Hour), nil)
+	err = (*Server)(nil).storeSessionAuthClaims(t.Context(), sess, nil, map[string]any{}, nil, time.Now().Add(time.Hour), nil)
 	if !errors.Is(err, ErrOAuth2NotConfigured) {
 		t.Fatal(err)
 	}
 
-	err = srv.storeSessionAuthClaims(t.Context(), nil, map[string]any{}, nil, time.Now().Add(time.Hour), nil)
+	err = srv.storeSessionAuthClaims(t.Context(), nil, srv.defaultProvider(), map[string]any{}, nil, time.Now().Add(time.Hour), nil)
 	if !errors.Is(err, ErrOAuth2MissingSession) {
 		t.Fatal(err)
 	}
 
-	err = srv.storeSessionAuthClaims(t.Context(), sess, map[string]any{}, nil, time.Time{}, nil)
+	err = srv.storeSessionAuthClaims(t.Context(), sess, srv.defaultProvider(), map[string]any{}, nil, time.Time{}, nil)
 	if !errors.Is(err, ErrOIDCInvalidIDToken) {
 		t.Fatal(err)
 	}
 
 	entry := &authTimerState{}
-	err = srv.storeSessionAuthClaims(t.Context(), sess, map[string]any{}, nil, time.Now().Add(time.Hour), entry)
+	err = srv.storeSessionAuthClaims(t.Context(), sess, srv.defaultProvider(), map[string]any{}, nil, time.Now().Add(time.Hour), entry)
 	if !errors.Is(err, errAuthTimerStale) {
 		t.Fatal(err)
 	}
@@ -341,17 +346,17 @@ func TestSetSessionAuthFromTokenErrors(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "http://example.com/protected", nil)
 	sess := jw.NewSession(httptest.NewRecorder(), req)
 
-	err = (*Server)(nil).setSessionAuthFromToken(t.Context(), sess, nil, nil, time.Time{}, nil)
+	err = (*Server)(nil).setSessionAuthFromToken(t.Context(), sess, nil, nil, nil, time.Time{}, nil)
 	if !errors.Is(err, ErrOAuth2NotConfigured) {
 		t.Fatal(err)
 	}
 
-	err = srv.setSessionAuthFromToken(t.Context(), sess, nil, nil, time.Time{}, nil)
+	err = srv.setSessionAuthFromToken(t.Context(), sess, srv.defaultProvider(), nil, nil, time.Time{}, nil)
 	if !errors.Is(err, ErrOIDCMissingIDToken) {
 		t.Fatal(err)
 	}
 
-	err = srv.setSessionAuthFromToken(t.Context(), sess, nil, makeOAuth2Token("access", "not-a-jwt", ""), time.Time{}, nil)
+	err = srv.setSessionAuthFromToken(t.Context(), sess, srv.defaultProvider(), nil, makeOAuth2Token("access", "not-a-jwt", ""), time.Time{}, nil)
 	if !errors.Is(err, ErrOIDCInvalidIDToken) {
 		t.Fatal(err)
 	}
@@ -365,7 +370,7 @@ func TestSetSessionAuthFromTokenErrors(t *testing.T) {
 		"aud": "client",
 		"sub": "sub-123",
 	})
-	err = srv.setSessionAuthFromToken(t.Context(), sess, nil, makeOAuth2Token("access", rawIDToken, ""), time.Time{}, nil)
+	err = srv.setSessionAuthFromToken(t.Context(), sess, srv.defaultProvider(), nil, makeOAuth2Token("access", rawIDToken, ""), time.Time{}, nil)
 	if !errors.Is(err, ErrOIDCInvalidIDToken) {
 		t.Fatal(err)
 	}
@@ -442,7 +447,7 @@ func TestAuthTimerRefreshesCachedTokenByForcingRefresh(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "http://example.com/protected", nil)
 	sess := jw.NewSession(httptest.NewRecorder(), req)
 	tokenSource := oauth2.StaticTokenSource(makeOAuth2Token("cached-access", cachedIDToken, "refresh123"))
-	err = srv.storeSessionAuthClaims(t.Context(), sess, map[string]any{
+	err = srv.storeSessionAuthClaims(t.Context(), sess, srv.defaultProvider(), map[string]any{
 		"exp":            initialExpiry.Unix(),
 		"email":          "cached@example.com",
 		"email_verified": false,
@@ -656,7 +661,7 @@ func TestAuthTimerRefreshFailureKeepsCurrentAuthUntilExpiry(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "http://example.com/protected", nil)
 	sess := jw.NewSession(httptest.NewRecorder(), req)
 	expiry := time.Now().Add(time.Minute).Truncate(time.Second)
-	err = srv.storeSessionAuthClaims(t.Context(), sess, map[string]any{
+	err = srv.storeSessionAuthClaims(t.Context(), sess, srv.defaultProvider(), map[string]any{
 		"exp":            expiry.Unix(),
 		"email":          "current@example.com",
 		"email_verified": true,
@@ -766,7 +771,7 @@ func TestAuthTimerRefreshFailureClearsExpiredAuth(t *testing.T) {
 			req := httptest.NewRequest(http.MethodGet, "http://example.com/protected", nil)
 			sess := jw.NewSession(httptest.NewRecorder(), req)
 			expiry := time.Now().Add(-time.Second).Truncate(time.Second)
-			err = srv.storeSessionAuthClaims(t.Context(), sess, map[string]any{
+			err = srv.storeSessionAuthClaims(t.Context(), sess, srv.defaultProvider(), map[string]any{
 				"exp":            expiry.Unix(),
 				"email":          "old@example.com",
 				"email_verified": true,
@@ -818,7 +823,7 @@ func TestAuthTimerDebugLogsRefreshFailure(t *testing.T) {
 	sess := jw.NewSession(httptest.NewRecorder(), req)
 	expiry := time.Now().Add(30 * time.Second).Truncate(time.Second)
 
-	err = srv.storeSessionAuthClaims(t.Context(), sess, map[string]any{
+	err = srv.storeSessionAuthClaims(t.Context(), sess, srv.defaultProvider(), map[string]any{
 		"exp":            expiry.Unix(),
 		"email":          "old@example.com",
 		"email_verified": true,
@@ -862,7 +867,7 @@ func TestAuthTimerDebugLogsRequireJawsDebug(t *testing.T) {
 	sess := jw.NewSession(httptest.NewRecorder(), req)
 	expiry := time.Now().Add(30 * time.Second).Truncate(time.Second)
 
-	err = srv.storeSessionAuthClaims(t.Context(), sess, map[string]any{
+	err = srv.storeSessionAuthClaims(t.Context(), sess, srv.defaultProvider(), map[string]any{
 		"exp":            expiry.Unix(),
 		"email":          "old@example.com",
 		"email_verified": true,
@@ -898,7 +903,7 @@ func TestAuthTimerStaleCallbackNoOp(t *testing.T) {
 	sess := jw.NewSession(httptest.NewRecorder(), req)
 	expiry := time.Now().Add(time.Minute).Truncate(time.Second)
 
-	err = srv.storeSessionAuthClaims(t.Context(), sess, map[string]any{
+	err = srv.storeSessionAuthClaims(t.Context(), sess, srv.defaultProvider(), map[string]any{
 		"exp":   expiry.Unix(),
 		"email": "first@example.com",
 	}, tokenSourceFunc(func() (*oauth2.Token, error) {
@@ -909,7 +914,7 @@ func TestAuthTimerStaleCallbackNoOp(t *testing.T) {
 		t.Fatal(err)
 	}
 	firstTimer := factory.timer(0)
-	err = srv.storeSessionAuthClaims(t.Context(), sess, map[string]any{
+	err = srv.storeSessionAuthClaims(t.Context(), sess, srv.defaultProvider(), map[string]any{
 		"exp":   time.Now().Add(time.Hour).Unix(),
 		"email": "second@example.com",
 	}, oauth2.StaticTokenSource(makeOAuth2Token("access", "", "")), time.Now().Add(time.Hour), nil)
@@ -957,7 +962,7 @@ func TestAuthTimerStaleAfterRefreshNoOp(t *testing.T) {
 		srv.scheduleSessionAuthTimer(sess, newExpiry)
 		return makeOAuth2Token("access", rawIDToken, ""), nil
 	})
-	err = srv.storeSessionAuthClaims(t.Context(), sess, map[string]any{
+	err = srv.storeSessionAuthClaims(t.Context(), sess, srv.defaultProvider(), map[string]any{
 		"exp":   oldExpiry.Unix(),
 		"email": "old@example.com",
 	}, tokenSource, oldExpiry, nil)
@@ -994,7 +999,7 @@ func TestExplicitLogoutStopsAuthTimer(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "http://example.com/oauth2/logout", nil)
 	rec := httptest.NewRecorder()
 	sess := jw.NewSession(rec, req)
-	err = srv.storeSessionAuthClaims(t.Context(), sess, map[string]any{
+	err = srv.storeSessionAuthClaims(t.Context(), sess, srv.defaultProvider(), map[string]any{
 		"exp":   time.Now().Add(time.Hour).Unix(),
 		"email": "user@example.com",
 	}, oauth2.StaticTokenSource(makeOAuth2Token("access", "", "")), time.Now().Add(time.Hour), nil)
@@ -1074,7 +1079,7 @@ func TestServerLogout(t *testing.T) {
 	}
 	req := httptest.NewRequest(http.MethodGet, "http://example.com/logout", nil)
 	sess := jw.NewSession(httptest.NewRecorder(), req)
-	err = srv.storeSessionAuthClaims(t.Context(), sess, map[string]any{
+	err = srv.storeSessionAuthClaims(t.Context(), sess, srv.defaultProvider(), map[string]any{
 		"exp":   time.Now().Add(time.Hour).Unix(),
 		"email": "user@example.com",
 	}, oauth2.StaticTokenSource(makeOAuth2Token("access", "", "")), time.Now().Add(time.Hour), nil)
@@ -0,0 +1,135 @@
+package jawsauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/linkdata/jaws"
+)
+
+const backChannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+var errLogoutTokenMissingEvent = errors.New("missing backchannel-logout event")
+var errLogoutTokenHasNonce = errors.New("nonce not allowed")
+var errLogoutTokenMissingSubject = errors.New("missing sid and sub")
+
+type logoutTokenClaims struct {
+	Sid    string         `json:"sid"`
+	Nonce  *string        `json:"nonce"`
+	Events map[string]any `json:"events"`
+}
+
+// verifyLogoutToken verifies a back-channel logout_token using the id_token
+// verifiers of the configured providers and returns the provider that verified
+// it and the session ID and subject it identifies.
+func (srv *Server) verifyLogoutToken(ctx context.Context, rawLogoutToken string) (p *provider, sid, sub string, err error) {
+	err = ErrOAuth2NotConfigured
+	if srv != nil && srv.idTokenVerifier != nil {
+		var logoutToken *oidc.IDToken
+		for _, candidate := range srv.allProviders() {
+			if candidate.idTokenVerifier != nil {
+				if logoutToken, err = candidate.idTokenVerifier.Verify(ctx, rawLogoutToken); err == nil {
+					p = candidate
+					break
+				}
+			}
+		}
+		if err == nil {
+			var claims logoutTokenClaims
+			if err = logoutToken.Claims(&claims); err == nil {
+				err = errLogoutTokenMissingEvent
+				if _, ok := claims.Events[backChannelLogoutEvent].(map[string]any); ok {
+					err = errLogoutTokenHasNonce
+					if claims.Nonce == nil {
+						err = errLogoutTokenMissingSubject
+						sid = claims.Sid
+						sub = logoutToken.Subject
+						if sid != "" || sub != "" {
+							err = nil
+						}
+					}
+				}
+			}
+		}
+		wrapOIDC(ErrOIDCInvalidLogoutToken, &err)
+	}
+	return
+}
+
+// authSessions returns the sessions with an auth-refresh timer for which match returns true.
+func (srv *Server) authSessions(match func(sess *jaws.Session) bool) (sessions []*jaws.Session) {
+	srv.mu.Lock()
+	for _, entry := range srv.authTimers {
+		if entry != nil && entry.sess != nil {
+			sessions = append(sessions, entry.sess)
+		}
+	}
+	srv.mu.Unlock()
+	n := 0
+	for _, sess := range sessions {
+		if match(sess) {
+			sessions[n] = sess
+			n++
+		}
+	}
+	sessions = sessions[:n]
+	return
+}
+
+// sessionFromProvider returns true if the session with the stored claims was
+// authenticated with p, judged by the "iss" claim if present and otherwise by
+// the provider name stored in the session.
+func (srv *Server) sessionFromProvider(sess *jaws.Session, claims map[string]any, p *provider) bool {
+	if iss, _ := claims["iss"].(string); iss != "" {
+		return iss == p.issuer
+	}
+	sp := srv.sessionProvider(sess)
+	return sp != nil && sp.name == p.name
+}
+
+// backChannelLogout clears the auth of all sessions authenticated with p whose
+// stored claims match the non-empty sid and sub, and returns the number of
+// sessions cleared.
+func (srv *Server) backChannelLogout(p *provider, sid, sub string) (n int) {
+	return srv.logoutMatching(func(sess *jaws.Session, claims map[string]any) bool {
+		gotSid, _ := sess.Get(oauth2SidKey).(string)
+		gotSub, _ := claims["sub"].(string)
+		return (sid == "" || sid == gotSid) && (sub == "" || sub == gotSub) && srv.sessionFromProvider(sess, claims, p)
+	})
+}
+
+// HandleBackChannelLogout handles OIDC Back-Channel Logout requests from the provider.
+//
+// For POST requests it verifies the logout_token form value with the id_token
+// verifier, requires the back-channel logout event and either a sid or sub claim
+// (and no nonce), then clears the auth of every session of the provider that issued
+// it whose stored claims match, firing LogoutEvent with a nil request and reloading
+// the session. If Revoker is set, the sid (or sub, if there is no sid) is also
+// revoked for the provider's issuer. It responds with 200 on success and 400 if
+// the logout_token is invalid. Non-POST requests receive 405.
+func (srv *Server) HandleBackChannelLogout(hw http.ResponseWriter, hr *http.Request) {
+	statusCode := http.StatusMethodNotAllowed
+	var err error
+	if hr.Method == http.MethodPost {
+		var p *provider
+		var sid, sub string
+		statusCode = http.StatusBadRequest
+		if p, sid, sub, err = srv.verifyLogoutToken(hr.Context(), hr.PostFormValue("logout_token")); err == nil {
+			n := srv.backChannelLogout(p, sid, sub)
+			if srv.Revoker != nil {
+				rev := Revocation{Issuer: p.issuer, SID: sid}
+				if sid == "" {
+					rev.Subject = sub
+				}
+				_ = srv.Jaws.Log(srv.Revoker.Revoke(hr.Context(), rev))
+			}
+			srv.debugLog("jawsauth: back-channel logout", "issuer", p.issuer, "sid", sid, "sub", sub, "sessions_cleared", n)
+			statusCode = http.StatusOK
+		} else {
+			srv.debugErrorLog("jawsauth: back-channel logout rejected", err)
+		}
+	}
+	srv.writeResult(hw, statusCode, err, nil)
+}
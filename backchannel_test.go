@@ -0,0 +1,189 @@
+package jawsauth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linkdata/jaws"
+)
+
+func makeLogoutToken(t *testing.T, issuer string, extra map[string]any) string {
+	t.Helper()
+	claims := map[string]any{
+		"iss":    issuer,
+		"aud":    "client",
+		"iat":    time.Now().Add(-time.Minute).Unix(),
+		"exp":    time.Now().Add(time.Minute).Unix(),
+		"jti":    "jti-123",
+		"events": map[string]any{backChannelLogoutEvent: map[string]any{}},
+	}
+	for k, v := range extra {
+		if v == nil {
+			delete(claims, k)
+		} else {
+			claims[k] = v
+		}
+	}
+	return makeIDToken(t, claims)
+}
+
+func newBackChannelTestSession(t *testing.T, jw *jaws.Jaws, srv *Server, sid, sub string) *jaws.Session {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/protected", nil)
+	sess := jw.NewSession(httptest.NewRecorder(), req)
+	expiry := time.Now().Add(time.Hour)
+	sess.Set(srv.SessionKey, map[string]any{"sid": sid, "sub": sub})
+	sess.Set(oauth2SidKey, sid)
+	sess.Set(oauth2IDTokenExpiryKey, expiry)
+	srv.scheduleSessionAuthTimer(sess, expiry)
+	return sess
+}
+
+func postLogoutToken(srv *Server, logoutToken string) *httptest.ResponseRecorder {
+	form := url.Values{"logout_token": {logoutToken}}
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/oauth2/backchannel-logout", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	srv.HandleBackChannelLogout(rec, req)
+	return rec
+}
+
+func TestHandleBackChannelLogout(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	const issuer = "https://issuer.example"
+	factory := &testAuthTimerFactory{}
+	srv := newTimerTestServer(t, jw, issuer, factory)
+	var loggedOut []uint64
+	srv.LogoutEvent = func(sess *jaws.Session, hr *http.Request) {
+		if hr != nil {
+			t.Error("expected nil request")
+		}
+		loggedOut = append(loggedOut, sess.ID())
+	}
+
+	sessA1 := newBackChannelTestSession(t, jw, srv, "sid-a1", "sub-a")
+	sessA2 := newBackChannelTestSession(t, jw, srv, "sid-a2", "sub-a")
+	sessB := newBackChannelTestSession(t, jw, srv, "sid-b", "sub-b")
+
+	rec := postLogoutToken(srv, makeLogoutToken(t, issuer, map[string]any{"sid": "sid-a1", "sub": "sub-a"}))
+	if rec.Code != http.StatusOK {
+		t.Fatal(rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Cache-Control") != "no-store" {
+		t.Fatal(rec.Header().Get("Cache-Control"))
+	}
+	assertWrapperAuthCleared(t, srv, sessA1)
+	if sessA2.Get(srv.SessionKey) == nil || sessB.Get(srv.SessionKey) == nil {
+		t.Fatal("cleared unrelated session")
+	}
+	if len(loggedOut) != 1 || loggedOut[0] != sessA1.ID() {
+		t.Fatal(loggedOut)
+	}
+	if factory.timer(0).isStopped() != true {
+		t.Fatal("timer not stopped")
+	}
+
+	rec = postLogoutToken(srv, makeLogoutToken(t, issuer, map[string]any{"sub": "sub-a"}))
+	if rec.Code != http.StatusOK {
+		t.Fatal(rec.Code, rec.Body.String())
+	}
+	assertWrapperAuthCleared(t, srv, sessA2)
+	if sessB.Get(srv.SessionKey) == nil {
+		t.Fatal("cleared unrelated session")
+	}
+
+	rec = postLogoutToken(srv, makeLogoutToken(t, issuer, map[string]any{"sid": "sid-b"}))
+	if rec.Code != http.StatusOK {
+		t.Fatal(rec.Code, rec.Body.String())
+	}
+	assertWrapperAuthCleared(t, srv, sessB)
+	if len(loggedOut) != 3 {
+		t.Fatal(loggedOut)
+	}
+}
+
+func TestHandleBackChannelLogoutRejects(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	const issuer = "https://issuer.example"
+	srv := newTimerTestServer(t, jw, issuer, &testAuthTimerFactory{})
+	sess := newBackChannelTestSession(t, jw, srv, "sid-1", "sub-1")
+
+	for _, tc := range []struct {
+		name  string
+		token string
+		cause error
+	}{
+		{name: "notJWT", token: "not-a-jwt"},
+		{name: "wrongIssuer", token: makeLogoutToken(t, "https://other.example", map[string]any{"sub": "sub-1"})},
+		{name: "missingEvent", token: makeLogoutToken(t, issuer, map[string]any{"sub": "sub-1", "events": nil}), cause: errLogoutTokenMissingEvent},
+		{name: "nonce", token: makeLogoutToken(t, issuer, map[string]any{"sub": "sub-1", "nonce": "n"}), cause: errLogoutTokenHasNonce},
+		{name: "missingSubject", token: makeLogoutToken(t, issuer, nil), cause: errLogoutTokenMissingSubject},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, _, err := srv.verifyLogoutToken(t.Context(), tc.token)
+			if !errors.Is(err, ErrOIDCInvalidLogoutToken) {
+				t.Fatal(err)
+			}
+			if tc.cause != nil && !errors.Is(err, tc.cause) {
+				t.Fatal(err)
+			}
+			rec := postLogoutToken(srv, tc.token)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatal(rec.Code)
+			}
+			if sess.Get(srv.SessionKey) == nil {
+				t.Fatal("session was cleared")
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	srv.HandleBackChannelLogout(rec, httptest.NewRequest(http.MethodGet, "http://example.com/oauth2/backchannel-logout", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatal(rec.Code)
+	}
+
+	if _, _, _, err = (*Server)(nil).verifyLogoutToken(t.Context(), ""); !errors.Is(err, ErrOAuth2NotConfigured) {
+		t.Fatal(err)
+	}
+}
+
+func TestHandleBackChannelLogoutScopedToProvider(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	const issuer = "https://issuer.example"
+	srv := newTimerTestServer(t, jw, issuer, &testAuthTimerFactory{})
+	own := newBackChannelTestSession(t, jw, srv, "sid-1", "sub-1")
+	own.Set(srv.SessionKey, map[string]any{"iss": issuer, "sid": "sid-1", "sub": "sub-1"})
+	otherIssuer := newBackChannelTestSession(t, jw, srv, "sid-2", "sub-1")
+	otherIssuer.Set(srv.SessionKey, map[string]any{"iss": "https://other.example", "sid": "sid-2", "sub": "sub-1"})
+	otherProvider := newBackChannelTestSession(t, jw, srv, "sid-3", "sub-1")
+	otherProvider.Set(oauth2ProviderKey, "other")
+
+	if rec := postLogoutToken(srv, makeLogoutToken(t, issuer, map[string]any{"sub": "sub-1"})); rec.Code != http.StatusOK {
+		t.Fatal(rec.Code, rec.Body.String())
+	}
+	assertWrapperAuthCleared(t, srv, own)
+	if otherIssuer.Get(srv.SessionKey) == nil || otherProvider.Get(srv.SessionKey) == nil {
+		t.Fatal("cleared session of another provider")
+	}
+}
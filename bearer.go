@@ -0,0 +1,149 @@
+package jawsauth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+)
+
+var errBearerWrongAudience = errors.New("audience not accepted")
+var errBearerIDToken = errors.New("id token used as access token")
+var errBearerTokenType = errors.New("token type not accepted")
+
+type bearerClaimsKey struct{}
+
+// bearerToken returns the token from an "Authorization: Bearer" request header.
+// present is true if the request has an Authorization header of any scheme.
+func bearerToken(hr *http.Request) (rawToken string, present bool) {
+	if authorization := hr.Header.Get("Authorization"); authorization != "" {
+		present = true
+		if scheme, value, ok := strings.Cut(authorization, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			rawToken = strings.TrimSpace(value)
+		}
+	}
+	return
+}
+
+// acceptsAudience returns true if audience contains one of BearerAudience.
+// If BearerAudience is empty, no audience is accepted.
+func (srv *Server) acceptsAudience(audience []string) bool {
+	return slices.ContainsFunc(audience, func(aud string) bool { return slices.Contains(srv.BearerAudience, aud) })
+}
+
+// jwtType returns the "typ" header parameter of the JWT rawToken, if any.
+func jwtType(rawToken string) (typ string) {
+	if header, _, ok := strings.Cut(rawToken, "."); ok {
+		if b, err := base64.RawURLEncoding.DecodeString(header); err == nil {
+			var h struct {
+				Typ string `json:"typ"`
+			}
+			if json.Unmarshal(b, &h) == nil {
+				typ = h.Typ
+			}
+		}
+	}
+	return
+}
+
+// isIDToken returns true if token, issued by p, looks like an ID token rather
+// than an access token. ID tokens carry the client ID as audience, so a token
+// for the client ID is only accepted if it is typed "at+jwt" as in RFC 9068.
+func isIDToken(p *provider, token *oidc.IDToken, rawToken string) bool {
+	if p.oauth2cfg != nil && slices.Contains(token.Audience, p.oauth2cfg.ClientID) {
+		typ := strings.ToLower(jwtType(rawToken))
+		return typ != "at+jwt" && typ != "application/at+jwt"
+	}
+	return false
+}
+
+// verifyBearerToken verifies a JWT access token against the JWKS of the
+// provider that issued it and returns its claims. If no provider issued it
+// and token introspection is available, the token is treated as opaque and
+// validated with introspectBearerToken instead.
+func (srv *Server) verifyBearerToken(ctx context.Context, rawToken string) (claims map[string]any, err error) {
+	err = ErrOAuth2NotConfigured
+	if srv != nil && srv.accessVerifier != nil {
+		var token *oidc.IDToken
+		var issued bool
+		for _, p := range srv.allProviders() {
+			if p.accessVerifier != nil {
+				if token, err = p.accessVerifier.Verify(srv.providerContext(ctx, p), rawToken); err == nil {
+					issued = true
+					err = errBearerWrongAudience
+					if isIDToken(p, token, rawToken) {
+						err = errBearerIDToken
+					} else if srv.acceptsAudience(token.Audience) {
+						err = token.Claims(&claims)
+					}
+					break
+				}
+			}
+		}
+		if !issued && srv.introspectionConfigured() {
+			claims, err = srv.introspectBearerToken(ctx, rawToken)
+		}
+		wrapOIDC(ErrOIDCInvalidAccessToken, &err)
+	}
+	return
+}
+
+// writeBearerChallenge writes a 401 response with a WWW-Authenticate header
+// as described in RFC 6750. If err is nil, the request lacked a bearer token.
+func (srv *Server) writeBearerChallenge(hw http.ResponseWriter, err error) {
+	challenge := "Bearer"
+	if err != nil {
+		challenge += ` error="invalid_token", error_description="the access token is invalid"`
+	}
+	hw.Header().Set("WWW-Authenticate", challenge)
+	srv.writeResult(hw, http.StatusUnauthorized, err, nil)
+}
+
+// serveBearer authenticates hr using its bearer token and invokes the wrapped
+// handler with the verified claims available through RequestAuth. If the login
+// gates (RequireEmailVerified, AllowedEmailDomains and AllowedHostedDomains) or
+// the policy do not allow the token's user, the 403 handler is invoked instead.
+func (w wrapper) serveBearer(hw http.ResponseWriter, hr *http.Request, rawToken string) {
+	srv := w.server
+	err := ErrOIDCInvalidAccessToken
+	var claims map[string]any
+	if rawToken != "" {
+		if claims, err = srv.verifyBearerToken(hr.Context(), rawToken); err == nil && srv.bearerRevoked(hr.Context(), claims) {
+			err = ErrSessionRevoked
+		}
+	}
+	if err != nil {
+		srv.debugErrorLog("jawsauth: bearer token rejected", err)
+		if rawToken == "" {
+			err = nil
+		}
+		srv.writeBearerChallenge(hw, err)
+		return
+	}
+	if w.stepUp != nil && !w.stepUp.satisfied(claims, w.server.now()) {
+		srv.debugErrorLog("jawsauth: bearer token rejected", ErrStepUpRequired)
+		srv.writeStepUpChallenge(hw, w.stepUp)
+		return
+	}
+	if err = srv.checkLoginClaims(claims); err != nil {
+		srv.debugErrorLog("jawsauth: bearer token rejected", err)
+		srv.get403Handler().ServeHTTP(hw, hr)
+		return
+	}
+	w.serveAllowed(hw, hr.WithContext(context.WithValue(hr.Context(), bearerClaimsKey{}, claims)), w.handler, claims)
+}
+
+// RequestAuth returns a JawsAuth for hr.
+//
+// If hr was authenticated by Wrap or WrapAdmin using a bearer token (see
+// BearerAuth), the JawsAuth reports the verified access token claims. Otherwise
+// it reports the data stored in the request's JaWS session, if any.
+func (srv *Server) RequestAuth(hr *http.Request) *JawsAuth {
+	claims, _ := hr.Context().Value(bearerClaimsKey{}).(map[string]any)
+	return &JawsAuth{server: srv, sess: srv.Jaws.GetSession(hr), claims: claims}
+}
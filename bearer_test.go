@@ -0,0 +1,250 @@
+package jawsauth
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/linkdata/jaws"
+	"golang.org/x/oauth2"
+)
+
+const bearerTestIssuer = "https://issuer.example"
+
+func newBearerTestServer(jw *jaws.Jaws) *Server {
+	return &Server{
+		Jaws:                    jw,
+		SessionKey:              "oidc_claims",
+		SessionTokenKey:         "oauth2_tokensource",
+		SessionEmailKey:         "email",
+		SessionEmailVerifiedKey: "email_verified",
+		HandledPaths:            map[string]struct{}{},
+		BearerAuth:              true,
+		BearerAudience:          []string{"api"},
+		oauth2cfg: &oauth2.Config{
+			ClientID:    "client",
+			Endpoint:    oauth2.Endpoint{AuthURL: bearerTestIssuer + "/auth", TokenURL: bearerTestIssuer + "/token"},
+			RedirectURL: "http://example.com/oauth2/callback",
+		},
+		idTokenVerifier: oidc.NewVerifier(bearerTestIssuer, passthroughKeySet{}, &oidc.Config{ClientID: "client"}),
+		accessVerifier:  oidc.NewVerifier(bearerTestIssuer, passthroughKeySet{}, &oidc.Config{SkipClientIDCheck: true}),
+		admins:          map[string]struct{}{},
+		handle403:       testStatusHandler{statusCode: http.StatusForbidden},
+	}
+}
+
+func makeAccessToken(t *testing.T, aud string, expiry time.Time) string {
+	t.Helper()
+	return makeIDToken(t, map[string]any{
+		"iss":            bearerTestIssuer,
+		"aud":            aud,
+		"exp":            expiry.Unix(),
+		"sub":            "sub-123",
+		"email":          "API@example.com",
+		"email_verified": true,
+	})
+}
+
+func TestBearerToken(t *testing.T) {
+	tests := []struct {
+		header    string
+		wantToken string
+		present   bool
+	}{
+		{"", "", false},
+		{"Bearer abc", "abc", true},
+		{"bearer  abc ", "abc", true},
+		{"Basic dXNlcjpwYXNz", "", true},
+		{"Bearer", "", true},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/api", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		gotToken, present := bearerToken(req)
+		if gotToken != tt.wantToken || present != tt.present {
+			t.Errorf("%q: got %q %v", tt.header, gotToken, present)
+		}
+	}
+}
+
+func TestWrapBearerToken(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+	srv := newBearerTestServer(jw)
+
+	var gotAuth *JawsAuth
+	h := srv.Wrap(http.HandlerFunc(func(hw http.ResponseWriter, hr *http.Request) {
+		gotAuth = srv.RequestAuth(hr)
+		hw.WriteHeader(http.StatusNoContent)
+	}))
+
+	serve := func(h http.Handler, authorization string) *http.Response {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/api", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		h.ServeHTTP(rec, req)
+		resp := rec.Result()
+		closeResponseBody(t, resp)
+		return resp
+	}
+
+	resp := serve(h, "Bearer "+makeAccessToken(t, "api", time.Now().Add(time.Hour)))
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatal(resp.Status)
+	}
+	if gotAuth.Email() != "api@example.com" || !gotAuth.EmailVerified() || gotAuth.Data()["sub"] != "sub-123" {
+		t.Fatal(gotAuth.Data())
+	}
+
+	resp = serve(h, "Bearer "+makeAccessToken(t, "other-api", time.Now().Add(time.Hour)))
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatal(resp.Status)
+	}
+	if got := resp.Header.Get("WWW-Authenticate"); !strings.HasPrefix(got, `Bearer error="invalid_token"`) {
+		t.Fatal(got)
+	}
+
+	srv.BearerAudience = nil
+	if resp = serve(h, "Bearer "+makeAccessToken(t, "api", time.Now().Add(time.Hour))); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatal(resp.Status)
+	}
+
+	srv.BearerAudience = []string{"other-api"}
+	if resp = serve(h, "Bearer "+makeAccessToken(t, "other-api", time.Now().Add(time.Hour))); resp.StatusCode != http.StatusNoContent {
+		t.Fatal(resp.Status)
+	}
+
+	resp = serve(h, "Bearer "+makeAccessToken(t, "other-api", time.Now().Add(-time.Hour)))
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatal(resp.Status)
+	}
+
+	resp = serve(h, "Basic dXNlcjpwYXNz")
+	if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") != "Bearer" {
+		t.Fatal(resp.Status, resp.Header.Get("WWW-Authenticate"))
+	}
+
+	srv.SetAdmins([]string{"admin@example.com"})
+	resp = serve(srv.WrapAdmin(h), "Bearer "+makeAccessToken(t, "other-api", time.Now().Add(time.Hour)))
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatal(resp.Status)
+	}
+
+	srv.BearerAuth = false
+	resp = serve(h, "Bearer "+makeAccessToken(t, "other-api", time.Now().Add(time.Hour)))
+	if resp.StatusCode != http.StatusFound {
+		t.Fatal(resp.Status)
+	}
+}
+
+func TestServerVerifyBearerTokenErrors(t *testing.T) {
+	if _, err := (*Server)(nil).verifyBearerToken(t.Context(), "x"); !errors.Is(err, ErrOAuth2NotConfigured) {
+		t.Fatal(err)
+	}
+	srv := newBearerTestServer(nil)
+	if _, err := srv.verifyBearerToken(t.Context(), "not-a-jwt"); !errors.Is(err, ErrOIDCInvalidAccessToken) {
+		t.Fatal(err)
+	}
+	_, err := srv.verifyBearerToken(t.Context(), makeAccessToken(t, "other-api", time.Now().Add(time.Hour)))
+	if !errors.Is(err, ErrOIDCInvalidAccessToken) || !errors.Is(err, errBearerWrongAudience) {
+		t.Fatal(err)
+	}
+}
+
+func TestWrapBearerRejectsIDToken(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+	srv := newBearerTestServer(jw)
+	h := srv.Wrap(http.HandlerFunc(func(hw http.ResponseWriter, hr *http.Request) {
+		hw.WriteHeader(http.StatusNoContent)
+	}))
+	serve := func(rawToken string) int {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/api", nil)
+		req.Header.Set("Authorization", "Bearer "+rawToken)
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	idToken := makeAccessToken(t, "client", time.Now().Add(time.Hour))
+	for _, audience := range [][]string{nil, {"api"}, {"client"}} {
+		srv.BearerAudience = audience
+		if code := serve(idToken); code != http.StatusUnauthorized {
+			t.Fatal(audience, code)
+		}
+	}
+	if _, err = srv.verifyBearerToken(t.Context(), idToken); !errors.Is(err, errBearerIDToken) {
+		t.Fatal(err)
+	}
+	if got := errorDebugClasses(err); !testStringSliceContains(got, "bearer_id_token") {
+		t.Fatal(got)
+	}
+
+	_, rest, _ := strings.Cut(idToken, ".")
+	accessToken := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"at+jwt","kid":"test"}`)) + "." + rest
+	if code := serve(accessToken); code != http.StatusNoContent {
+		t.Fatal(code)
+	}
+	if typ := jwtType("not a jwt"); typ != "" {
+		t.Fatal(typ)
+	}
+}
+
+func TestWrapBearerLoginGates(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+	srv := newBearerTestServer(jw)
+	h := srv.Wrap(http.HandlerFunc(func(hw http.ResponseWriter, hr *http.Request) {
+		hw.WriteHeader(http.StatusNoContent)
+	}))
+	serve := func(claims map[string]any) int {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/api", nil)
+		req.Header.Set("Authorization", "Bearer "+makeIDToken(t, claims))
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	claims := map[string]any{
+		"iss":            bearerTestIssuer,
+		"aud":            "api",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"sub":            "sub-123",
+		"email":          "user@example.com",
+		"email_verified": false,
+	}
+
+	if code := serve(claims); code != http.StatusNoContent {
+		t.Fatal(code)
+	}
+	srv.RequireEmailVerified = true
+	if code := serve(claims); code != http.StatusForbidden {
+		t.Fatal(code)
+	}
+	claims["email_verified"] = true
+	srv.AllowedEmailDomains = []string{"example.org"}
+	if code := serve(claims); code != http.StatusForbidden {
+		t.Fatal(code)
+	}
+	srv.AllowedEmailDomains = []string{"example.com"}
+	if code := serve(claims); code != http.StatusNoContent {
+		t.Fatal(code)
+	}
+}
@@ -0,0 +1,171 @@
+package jawsauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// ErrJWKSStatus means fetching the provider's JWKS returned a non-200 HTTP status.
+var ErrJWKSStatus = errors.New("jwks status")
+
+var errJWKSNoSigningKeys = errors.New("jwks has no signing keys")
+
+// CheckReport describes how a Config resolves against its identity provider,
+// as returned by Config.Check.
+type CheckReport struct {
+	Issuer           string       // issuer URL
+	RedirectURL      string       // OAuth2 callback URL
+	Paths            HandlerPaths // endpoint paths registered by New and NewDebug
+	AuthURL          string       // authorization endpoint
+	TokenURL         string       // token endpoint
+	UserInfoURL      string       // UserInfo endpoint, empty if not available
+	EndSessionURL    string       // end_session_endpoint used by RPInitiatedLogout, empty if not available
+	RevocationURL    string       // revocation_endpoint, empty if not available
+	IntrospectionURL string       // introspection_endpoint used by BearerAuth, empty if not available
+	JWKSURL          string       // jwks_uri
+	Scopes           []string     // scopes requested at login
+	ScopesSupported  []string     // discovered scopes_supported, if any
+	ClaimsSupported  []string     // discovered claims_supported, if any
+	PKCES256         bool         // true if code_challenge_methods_supported includes "S256"
+	KeyTypes         []string     // distinct JWKS signing key types, e.g. "RSA RS256" or "EC P-256 ES256"
+	Warnings         []string     // problems that do not prevent New from succeeding
+}
+
+// Check validates cfg, runs OIDC discovery the same way New does and fetches
+// the provider's JWKS, returning a report of the resolved settings.
+//
+// Problems that make New fail, as well as a JWKS that cannot be fetched or has no
+// signing keys, are returned as errors matching ErrConfig, ErrOIDCDiscovery or
+// ErrOIDCProviderMetadata, with a nil report. Lesser problems, such as an insecure
+// issuer or a missing userinfo_endpoint, are listed in the report's Warnings.
+func (cfg *Config) Check(ctx context.Context) (report *CheckReport, err error) {
+	var oauth2cfg *oauth2.Config
+	r := &CheckReport{Issuer: cfg.Issuer}
+	if oauth2cfg, r.UserInfoURL, r.EndSessionURL, r.IntrospectionURL, _, _, err = cfg.buildContext(ctx, "", nil); err == nil {
+		if cfg.HTTPClient != nil {
+			ctx = context.WithValue(ctx, oauth2.HTTPClient, cfg.HTTPClient)
+		}
+		var provider *oidc.Provider
+		if provider, err = oidc.NewProvider(ctx, cfg.Issuer); wrapOIDC(ErrOIDCDiscovery, &err) == nil {
+			var metadata struct {
+				JWKSURI                       string   `json:"jwks_uri"`
+				RevocationEndpoint            string   `json:"revocation_endpoint"`
+				ScopesSupported               []string `json:"scopes_supported"`
+				ClaimsSupported               []string `json:"claims_supported"`
+				CodeChallengeMethodsSupported []string `json:"code_challenge_methods_supported"`
+			}
+			if err = provider.Claims(&metadata); wrapOIDC(ErrOIDCProviderMetadata, &err) == nil {
+				var redir *url.URL
+				if redir, err = url.Parse(oauth2cfg.RedirectURL); err == nil {
+					r.RedirectURL = oauth2cfg.RedirectURL
+					r.Paths = handlerPaths(redir)
+					r.AuthURL = oauth2cfg.Endpoint.AuthURL
+					r.TokenURL = oauth2cfg.Endpoint.TokenURL
+					r.RevocationURL = metadata.RevocationEndpoint
+					r.JWKSURL = metadata.JWKSURI
+					r.Scopes = oauth2cfg.Scopes
+					r.ScopesSupported = metadata.ScopesSupported
+					r.ClaimsSupported = metadata.ClaimsSupported
+					r.PKCES256 = slices.Contains(metadata.CodeChallengeMethodsSupported, "S256")
+					if r.KeyTypes, err = fetchJWKSKeyTypes(ctx, r.JWKSURL); wrapOIDC(ErrOIDCProviderMetadata, &err) == nil {
+						r.Warnings = cfg.checkWarnings(r)
+						report = r
+					}
+				}
+			}
+		}
+	}
+	return
+}
+
+// fetchJWKSKeyTypes returns the sorted, distinct types of the signing keys in the JWKS at jwksURL.
+func fetchJWKSKeyTypes(ctx context.Context, jwksURL string) (keyTypes []string, err error) {
+	var req *http.Request
+	if req, err = http.NewRequestWithContext(ctx, http.MethodGet, jwksURL, nil); err == nil {
+		req.Header.Set("Accept", "application/json")
+		client, _ := ctx.Value(oauth2.HTTPClient).(*http.Client)
+		if client == nil {
+			client = http.DefaultClient
+		}
+		var resp *http.Response
+		if resp, err = client.Do(req); /*#nosec G704*/ err == nil {
+			defer func() {
+				if closeErr := resp.Body.Close(); err == nil && closeErr != nil {
+					err = closeErr
+				}
+			}()
+			var body []byte
+			if body, err = io.ReadAll(io.LimitReader(resp.Body, 1<<20)); err == nil {
+				if resp.StatusCode == http.StatusOK {
+					var jwks struct {
+						Keys []struct {
+							Kty string `json:"kty"`
+							Crv string `json:"crv"`
+							Alg string `json:"alg"`
+							Use string `json:"use"`
+						} `json:"keys"`
+					}
+					if err = json.Unmarshal(body, &jwks); err == nil {
+						for _, key := range jwks.Keys {
+							if key.Use != "enc" {
+								keyType := strings.Join(slices.DeleteFunc([]string{key.Kty, key.Crv, key.Alg}, func(s string) bool { return s == "" }), " ")
+								keyTypes = append(keyTypes, keyType)
+							}
+						}
+						slices.Sort(keyTypes)
+						keyTypes = slices.Compact(keyTypes)
+						if len(keyTypes) == 0 {
+							err = errJWKSNoSigningKeys
+						}
+					}
+				} else {
+					err = fmt.Errorf("%w %s", ErrJWKSStatus, resp.Status)
+				}
+			}
+		}
+	}
+	return
+}
+
+// checkWarnings returns the problems with cfg and r that do not prevent New from succeeding.
+func (cfg *Config) checkWarnings(r *CheckReport) (warnings []string) {
+	if u, err := url.Parse(r.Issuer); err == nil && u.Scheme != "https" {
+		warnings = append(warnings, "Issuer does not use https (AllowInsecureIssuer is set)")
+	}
+	if u, err := url.Parse(r.RedirectURL); err == nil && u.Scheme != "https" {
+		warnings = append(warnings, "RedirectURL does not use https")
+	}
+	if strings.TrimSpace(cfg.ClientSecret) == "" {
+		warnings = append(warnings, "ClientSecret is empty")
+	}
+	if !r.PKCES256 {
+		warnings = append(warnings, "provider does not list S256 in code_challenge_methods_supported, but PKCE S256 is always used")
+	}
+	if r.UserInfoURL == "" {
+		warnings = append(warnings, "no userinfo_endpoint: claims missing from the id_token, such as email, cannot be fetched")
+	}
+	if r.EndSessionURL == "" {
+		warnings = append(warnings, "no end_session_endpoint: RPInitiatedLogout only ends the local session")
+	}
+	if len(r.ScopesSupported) > 0 {
+		for _, scope := range r.Scopes {
+			if !slices.Contains(r.ScopesSupported, scope) {
+				warnings = append(warnings, fmt.Sprintf("scope %q is not in scopes_supported", scope))
+			}
+		}
+	}
+	if len(r.ClaimsSupported) > 0 && !slices.Contains(r.ClaimsSupported, "email") {
+		warnings = append(warnings, `"email" is not in claims_supported`)
+	}
+	return
+}
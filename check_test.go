@@ -0,0 +1,152 @@
+package jawsauth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func newCheckTestServer(t *testing.T, tls bool, metadata map[string]any, jwks string) (server *httptest.Server) {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(hw http.ResponseWriter, hr *http.Request) {
+		data := map[string]any{
+			"issuer":                 server.URL,
+			"authorization_endpoint": server.URL + "/auth",
+			"token_endpoint":         server.URL + "/token",
+			"jwks_uri":               server.URL + "/jwks",
+		}
+		for k, v := range metadata {
+			data[k] = v
+		}
+		hw.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(hw).Encode(data)
+	})
+	mux.HandleFunc("/jwks", func(hw http.ResponseWriter, hr *http.Request) {
+		if jwks == "" {
+			http.Error(hw, "gone", http.StatusGone)
+			return
+		}
+		hw.Header().Set("Content-Type", "application/json")
+		_, _ = hw.Write([]byte(jwks))
+	})
+	if tls {
+		server = httptest.NewTLSServer(mux)
+	} else {
+		server = httptest.NewServer(mux)
+	}
+	t.Cleanup(server.Close)
+	return
+}
+
+func TestConfigCheck(t *testing.T) {
+	server := newCheckTestServer(t, true, map[string]any{
+		"userinfo_endpoint":                "https://idp.example/userinfo",
+		"end_session_endpoint":             "https://idp.example/logout",
+		"revocation_endpoint":              "https://idp.example/revoke",
+		"scopes_supported":                 []string{"openid", "email", "profile"},
+		"claims_supported":                 []string{"sub", "email"},
+		"code_challenge_methods_supported": []string{"plain", "S256"},
+	}, `{"keys":[{"kty":"RSA","alg":"RS256","use":"sig"},{"kty":"EC","crv":"P-256","alg":"ES256"},{"kty":"RSA","alg":"RS256"},{"kty":"RSA","use":"enc"}]}`)
+	cfg := &Config{
+		RedirectURL:  "https://app.example/auth/callback",
+		Issuer:       server.URL,
+		HTTPClient:   server.Client(),
+		Scopes:       []string{"profile"},
+		ClientID:     "client",
+		ClientSecret: "secret",
+	}
+	report, err := cfg.Check(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &CheckReport{
+		Issuer:      server.URL,
+		RedirectURL: "https://app.example/auth/callback",
+		Paths: HandlerPaths{
+			Callback:           "/auth/callback",
+			Login:              "/auth/login",
+			Logout:             "/auth/logout",
+			BackChannelLogout:  "/auth/backchannel-logout",
+			FrontChannelLogout: "/auth/frontchannel-logout",
+		},
+		AuthURL:         server.URL + "/auth",
+		TokenURL:        server.URL + "/token",
+		UserInfoURL:     "https://idp.example/userinfo",
+		EndSessionURL:   "https://idp.example/logout",
+		RevocationURL:   "https://idp.example/revoke",
+		JWKSURL:         server.URL + "/jwks",
+		Scopes:          []string{"email", "openid", "profile"},
+		ScopesSupported: []string{"openid", "email", "profile"},
+		ClaimsSupported: []string{"sub", "email"},
+		PKCES256:        true,
+		KeyTypes:        []string{"EC P-256 ES256", "RSA RS256"},
+	}
+	if !reflect.DeepEqual(report, want) {
+		t.Fatalf("\n got %#v\nwant %#v", report, want)
+	}
+}
+
+func TestConfigCheckWarnings(t *testing.T) {
+	server := newCheckTestServer(t, false, map[string]any{
+		"scopes_supported": []string{"openid"},
+		"claims_supported": []string{"sub"},
+	}, `{"keys":[{"kty":"RSA"}]}`)
+	cfg := &Config{
+		RedirectURL:         "http://app.example/callback",
+		Issuer:              server.URL,
+		AllowInsecureIssuer: true,
+		ClientID:            "client",
+	}
+	report, err := cfg.Check(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"Issuer does not use https (AllowInsecureIssuer is set)",
+		"RedirectURL does not use https",
+		"ClientSecret is empty",
+		"provider does not list S256 in code_challenge_methods_supported, but PKCE S256 is always used",
+		"no userinfo_endpoint: claims missing from the id_token, such as email, cannot be fetched",
+		"no end_session_endpoint: RPInitiatedLogout only ends the local session",
+		`scope "email" is not in scopes_supported`,
+		`"email" is not in claims_supported`,
+	}
+	if !reflect.DeepEqual(report.Warnings, want) || !reflect.DeepEqual(report.KeyTypes, []string{"RSA"}) {
+		t.Fatal(report.Warnings, report.KeyTypes)
+	}
+	if report.Paths.Login != "/login" {
+		t.Fatal(report.Paths)
+	}
+}
+
+func TestConfigCheckErrors(t *testing.T) {
+	if report, err := (&Config{RedirectURL: "https://app.example/callback"}).Check(t.Context()); !errors.Is(err, ErrConfig) || report != nil {
+		t.Fatal(report, err)
+	}
+
+	server := newCheckTestServer(t, false, nil, "")
+	cfg := &Config{RedirectURL: "https://app.example/callback", Issuer: server.URL, AllowInsecureIssuer: true, ClientID: "client"}
+	report, err := cfg.Check(t.Context())
+	if !errors.Is(err, ErrOIDCProviderMetadata) || !errors.Is(err, ErrJWKSStatus) || report != nil {
+		t.Fatal(report, err)
+	}
+	if got := errorDebugClasses(err); !reflect.DeepEqual(got, []string{"oidc_provider_metadata", "jwks_status"}) {
+		t.Fatal(got)
+	}
+
+	server = newCheckTestServer(t, false, nil, `{"keys":[{"kty":"RSA","use":"enc"}]}`)
+	cfg.Issuer = server.URL
+	if report, err = cfg.Check(t.Context()); !errors.Is(err, ErrOIDCProviderMetadata) || !errors.Is(err, errJWKSNoSigningKeys) || report != nil {
+		t.Fatal(report, err)
+	}
+
+	server = newCheckTestServer(t, false, nil, `{"keys":`)
+	cfg.Issuer = server.URL
+	if report, err = cfg.Check(t.Context()); !errors.Is(err, ErrOIDCProviderMetadata) || report != nil {
+		t.Fatal(report, err)
+	}
+}
@@ -0,0 +1,44 @@
+package jawsauth
+
+import "time"
+
+// Clock provides the current time and timers to a Server.
+//
+// It is used for session expiry, IdleTimeout and MaxLifetime, revocation
+// check intervals, step-up auth_time checks, id_token and access token
+// verification and the auth-refresh timer, so that tests and simulations can
+// fast-forward token lifetimes deterministically. If Server.Clock is nil, the
+// system clock is used.
+type Clock interface {
+	Now() time.Time
+	// AfterFunc calls f after d has elapsed, like time.AfterFunc.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a timer started by Clock.AfterFunc.
+type Timer interface {
+	// Stop prevents the timer from firing. It returns false if the timer has
+	// already fired or been stopped.
+	Stop() bool
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+func (srv *Server) clock() Clock {
+	if srv != nil && srv.Clock != nil {
+		return srv.Clock
+	}
+	return systemClock{}
+}
+
+func (srv *Server) now() time.Time {
+	return srv.clock().Now()
+}
@@ -0,0 +1,82 @@
+package jawsauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/linkdata/jaws"
+)
+
+type testClock struct {
+	testAuthTimerFactory
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func TestServerClock(t *testing.T) {
+	var nilServer *Server
+	if _, ok := nilServer.clock().(systemClock); !ok {
+		t.Fatal("nil server does not use the system clock")
+	}
+	timer := systemClock{}.AfterFunc(time.Hour, func() {})
+	if !timer.Stop() {
+		t.Fatal("system timer not stopped")
+	}
+
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	clock := &testClock{now: time.Now().Add(24 * time.Hour)}
+	srv := newWrapperTestServer(jw, "https://issuer.example")
+	srv.Clock = clock
+	srv.IdleTimeout = time.Hour
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/protected", nil)
+	sess := jw.NewSession(httptest.NewRecorder(), req)
+	if err = srv.LoginForTest(sess, map[string]any{"sub": "sub-123"}, time.Time{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if expiry, _ := sess.Get(oauth2IDTokenExpiryKey).(time.Time); !expiry.Equal(clock.now.Add(time.Hour)) {
+		t.Fatal(expiry)
+	}
+	if delay := clock.timer(0).delay; delay != time.Hour-authRefreshSkew {
+		t.Fatal(delay)
+	}
+
+	h := srv.Wrap(testStatusHandler{statusCode: http.StatusNoContent})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if lastActivity, _ := sess.Get(oauth2LastActivityKey).(time.Time); rec.Code != http.StatusNoContent || !lastActivity.Equal(clock.now) {
+		t.Fatal(rec.Code, lastActivity)
+	}
+
+	clock.now = clock.now.Add(time.Hour)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusFound || sess.Get(srv.SessionKey) != nil {
+		t.Fatal(rec.Code)
+	}
+}
+
+func TestMemoryRevokerClock(t *testing.T) {
+	clock := &testClock{now: time.Now().Add(24 * time.Hour)}
+	mr := &MemoryRevoker{MaxAge: time.Hour, Clock: clock}
+	rev := Revocation{Subject: "sub-123"}
+	if err := mr.Revoke(t.Context(), rev); err != nil {
+		t.Fatal(err)
+	}
+	if revoked, _ := mr.Revoked(t.Context(), rev, clock.now.Add(-time.Minute)); !revoked {
+		t.Fatal("not revoked")
+	}
+	clock.now = clock.now.Add(2 * time.Hour)
+	if revoked, _ := mr.Revoked(t.Context(), rev, clock.now.Add(-3*time.Hour)); revoked {
+		t.Fatal("revocation not forgotten")
+	}
+}
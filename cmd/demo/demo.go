@@ -26,6 +26,7 @@ import (
 	"github.com/linkdata/jaws"
 	"github.com/linkdata/jaws/lib/bind"
 	"github.com/linkdata/jawsauth"
+	"github.com/linkdata/jawsauth/jawsauthtest"
 	"github.com/linkdata/webserv"
 	"golang.org/x/oauth2"
 )
@@ -52,10 +53,10 @@ const indexTemplate = `<!doctype html>
     {{with .Auth}}
       <p id="email">Signed in as {{.Email}}</p>
     {{end}}
-    <p>This page is protected by OAuth2 via Keycloak and rendered with JaWS.</p>
+    <p>This page is protected by OAuth2 via an OpenID Connect provider and rendered with JaWS.</p>
     <p>Move the slider below to update state on the server without a full page reload.</p>
     {{$.Range .Dot}}
-    <p><a href="/logout">Sign out</a></p>
+    <p><a href="/oauth2/logout">Sign out</a></p>
   </main>
   {{$.TailHTML}}
 </body>
@@ -88,6 +89,7 @@ type demoOptions struct {
 	Username      string
 	UserEmail     string
 	KeycloakImage string
+	IdP           string
 }
 
 func (o demoOptions) withDefaults() demoOptions {
@@ -112,12 +114,15 @@ func (o demoOptions) withDefaults() demoOptions {
 	if o.KeycloakImage == "" {
 		o.KeycloakImage = "quay.io/keycloak/keycloak:latest"
 	}
+	if o.IdP == "" {
+		o.IdP = idpKeycloak
+	}
 	return o
 }
 
 type demoServer struct {
 	appURL       string
-	keycloakURL  string
+	idpURL       string
 	username     string
 	password     string
 	userEmail    string
@@ -126,6 +131,7 @@ type demoServer struct {
 	httpServer *http.Server
 	jaws       *jaws.Jaws
 	keycloak   *keycloakServer
+	idp        *jawsauthtest.Provider
 	certDir    string
 
 	closeOnce sync.Once
@@ -143,6 +149,9 @@ func (d *demoServer) close(ctx context.Context) (err error) {
 		if d.keycloak != nil {
 			errs = append(errs, d.keycloak.Close(ctx))
 		}
+		if d.idp != nil {
+			d.idp.Close()
+		}
 		if d.certDir != "" {
 			errs = append(errs, os.RemoveAll(d.certDir))
 		}
@@ -192,70 +201,104 @@ func startDemo(ctx context.Context, opts demoOptions) (demo *demoServer, err err
 
 	password := randomPassword(18)
 
-	keycloak, err := startKeycloakServer(ctx, opts.KeycloakImage, password)
+	jw, err := jaws.New()
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("create jaws instance: %w", err)
 	}
 	defer func() {
 		if err != nil {
-			_ = keycloak.Close(context.Background())
+			jw.Close()
 		}
 	}()
 
-	oidc, err := keycloak.SetupRealm(ctx, keycloakRealmSetup{
-		Realm:       opts.Realm,
-		ClientID:    opts.ClientID,
-		RedirectURI: appURL + "/oauth2/callback",
-		Username:    opts.Username,
-		Email:       opts.UserEmail,
-		Password:    password,
-	})
-	if err != nil {
-		return nil, err
+	if err = jw.AddTemplateLookuper(template.Must(template.New("index.html").Parse(indexTemplate))); err != nil {
+		return nil, fmt.Errorf("add template lookuper: %w", err)
 	}
 
-	if err = writePasswordFile(opts.PasswordFile, password); err != nil {
-		return nil, err
-	}
+	mux := http.NewServeMux()
+	mux.Handle(http.MethodGet+" /jaws/", jw)
 
-	jw, err := jaws.New()
-	if err != nil {
-		return nil, fmt.Errorf("create jaws instance: %w", err)
+	httpServer := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
 	}
+
+	go jw.Serve()
+
+	go func() {
+		_ = httpServer.Serve(listener)
+	}()
 	defer func() {
 		if err != nil {
-			jw.Close()
+			_ = httpServer.Shutdown(context.Background())
 		}
 	}()
 
-	if err = jw.AddTemplateLookuper(template.Must(template.New("index.html").Parse(indexTemplate))); err != nil {
-		return nil, fmt.Errorf("add template lookuper: %w", err)
+	if err = waitForHTTPSReady(ctx, appURL+"/jaws/.ping"); err != nil {
+		return nil, err
 	}
 
-	mux := http.NewServeMux()
-	mux.Handle(http.MethodGet+" /jaws/", jw)
+	var cfg *jawsauth.Config
+	var keycloak *keycloakServer
+	var idp *jawsauthtest.Provider
+	var idpURL string
+	switch opts.IdP {
+	case idpKeycloak:
+		if keycloak, err = startKeycloakServer(ctx, opts.KeycloakImage, password); err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err != nil {
+				_ = keycloak.Close(context.Background())
+			}
+		}()
+		var oidc keycloakOIDC
+		if oidc, err = keycloak.SetupRealm(ctx, keycloakRealmSetup{
+			Realm:       opts.Realm,
+			ClientID:    opts.ClientID,
+			RedirectURI: appURL + "/oauth2/callback",
+			Username:    opts.Username,
+			Email:       opts.UserEmail,
+			Password:    password,
+		}); err != nil {
+			return nil, err
+		}
+		cfg = &jawsauth.Config{
+			RedirectURL:  appURL + "/oauth2/callback",
+			Issuer:       oidc.Issuer,
+			HTTPClient:   keycloak.httpClient,
+			Scopes:       []string{"profile"},
+			ClientID:     opts.ClientID,
+			ClientSecret: oidc.ClientSecret,
+		}
+		idpURL = keycloak.baseURL
+	case idpEmbedded:
+		if idp, cfg, err = startEmbeddedIdP(mux, appURL, opts, password); err != nil {
+			return nil, err
+		}
+		idpURL = idp.Issuer()
+	default:
+		return nil, fmt.Errorf("unknown identity provider %q", opts.IdP)
+	}
 
-	cfg := jawsauth.Config{
-		RedirectURL:  appURL + "/oauth2/callback",
-		Issuer:       oidc.Issuer,
-		HTTPClient:   keycloak.httpClient,
-		Scopes:       []string{"profile"},
-		ClientID:     opts.ClientID,
-		ClientSecret: oidc.ClientSecret,
+	if err = writePasswordFile(opts.PasswordFile, password); err != nil {
+		return nil, err
 	}
 
 	handleWithOAuthClient := func(uri string, handler http.Handler) {
 		mux.Handle(http.MethodGet+" "+uri, http.HandlerFunc(func(hw http.ResponseWriter, hr *http.Request) {
-			oauthCtx := context.WithValue(hr.Context(), oauth2.HTTPClient, keycloak.httpClient)
+			oauthCtx := context.WithValue(hr.Context(), oauth2.HTTPClient, cfg.HTTPClient)
 			handler.ServeHTTP(hw, hr.WithContext(oauthCtx))
 		}))
 	}
 
-	authServer, err := jawsauth.New(jw, &cfg, handleWithOAuthClient)
+	authServer, err := jawsauth.New(jw, cfg, handleWithOAuthClient)
 	if err != nil {
 		return nil, fmt.Errorf("create auth server: %w", err)
 	}
 	authServer.LoginFailed = demoLoginFailed
+	authServer.RPInitiatedLogout = true
+	authServer.LogoutRedirect = "/logged-out"
 
 	var sliderMu sync.Mutex
 	var slider float64
@@ -264,23 +307,6 @@ func startDemo(ctx context.Context, opts demoOptions) (demo *demoServer, err err
 		hw.Header().Set("Content-Type", "text/html; charset=utf-8")
 		_, _ = hw.Write([]byte(`<!doctype html><html lang="en"><body><h1>Signed out</h1><p><a href="/">Sign in again</a></p></body></html>`))
 	})
-	mux.HandleFunc(http.MethodGet+" /logout", demoLogoutHandler(jw, authServer, appURL, opts.ClientID, oidc.EndSessionURL))
-
-	httpServer := &http.Server{
-		Handler:           mux,
-		ReadHeaderTimeout: 5 * time.Second,
-	}
-
-	go jw.Serve()
-
-	go func() {
-		_ = httpServer.Serve(listener)
-	}()
-
-	if err = waitForHTTPSReady(ctx, appURL+"/jaws/.ping"); err != nil {
-		_ = httpServer.Shutdown(context.Background())
-		return nil, err
-	}
 
 	absPasswordFile, pathErr := filepath.Abs(opts.PasswordFile)
 	if pathErr != nil {
@@ -289,7 +315,7 @@ func startDemo(ctx context.Context, opts demoOptions) (demo *demoServer, err err
 
 	return &demoServer{
 		appURL:       appURL,
-		keycloakURL:  keycloak.baseURL,
+		idpURL:       idpURL,
 		username:     opts.Username,
 		password:     password,
 		userEmail:    opts.UserEmail,
@@ -297,42 +323,11 @@ func startDemo(ctx context.Context, opts demoOptions) (demo *demoServer, err err
 		httpServer:   httpServer,
 		jaws:         jw,
 		keycloak:     keycloak,
+		idp:          idp,
 		certDir:      certDir,
 	}, nil
 }
 
-func demoLogoutHandler(jw *jaws.Jaws, authServer *jawsauth.Server, appURL, clientID, endSessionURL string) http.HandlerFunc {
-	return func(hw http.ResponseWriter, hr *http.Request) {
-		var idTokenHint string
-		if sess := jw.GetSession(hr); sess != nil {
-			if tokenSource, ok := sess.Get(authServer.SessionTokenKey).(oauth2.TokenSource); ok && tokenSource != nil {
-				if token, e := tokenSource.Token(); e == nil && token != nil {
-					if value, ok := token.Extra("id_token").(string); ok {
-						idTokenHint = value
-					}
-				}
-			}
-			authServer.Logout(sess, hr)
-		}
-
-		target := appURL + "/logged-out"
-		if endSessionURL != "" {
-			if u, e := url.Parse(endSessionURL); e == nil {
-				q := u.Query()
-				q.Set("client_id", clientID)
-				q.Set("post_logout_redirect_uri", target)
-				if idTokenHint != "" {
-					q.Set("id_token_hint", idTokenHint)
-				}
-				u.RawQuery = q.Encode()
-				http.Redirect(hw, hr, u.String(), http.StatusFound)
-				return
-			}
-		}
-		http.Redirect(hw, hr, "/logged-out", http.StatusFound)
-	}
-}
-
 func demoLoginFailed(hw http.ResponseWriter, hr *http.Request, httpCode int, err error, email string) (handled bool) {
 	if httpCode < http.StatusBadRequest {
 		httpCode = http.StatusInternalServerError
@@ -414,16 +409,22 @@ func listenerPort(addr net.Addr) string {
 	return port
 }
 
-func waitForHTTPSReady(ctx context.Context, pingURL string) error {
-	client := &http.Client{
-		Timeout: 5 * time.Second,
+// selfSignedClient returns an HTTP client that accepts the demo app's generated
+// self-signed certificate.
+func selfSignedClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
 		Transport: &http.Transport{
 			TLSClientConfig: &tls.Config{
 				MinVersion:         tls.VersionTLS12,
-				InsecureSkipVerify: true, // #nosec G402 -- demo readiness probe uses a generated self-signed certificate.
+				InsecureSkipVerify: true, // #nosec G402 -- the demo app uses a generated self-signed certificate.
 			},
 		},
 	}
+}
+
+func waitForHTTPSReady(ctx context.Context, pingURL string) error {
+	client := selfSignedClient(5 * time.Second)
 
 	deadline := time.NewTimer(30 * time.Second)
 	defer deadline.Stop()
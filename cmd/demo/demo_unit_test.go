@@ -16,7 +16,6 @@ import (
 	"time"
 
 	"github.com/linkdata/jaws"
-	"github.com/linkdata/jawsauth"
 )
 
 type demoTestAddr string
@@ -47,6 +46,9 @@ func TestDemoOptionsWithDefaults(t *testing.T) {
 	if got.KeycloakImage != "quay.io/keycloak/keycloak:latest" {
 		t.Fatal(got.KeycloakImage)
 	}
+	if got.IdP != idpKeycloak {
+		t.Fatal(got.IdP)
+	}
 
 	custom := demoOptions{
 		ListenAddr:    "127.0.0.1:9443",
@@ -57,6 +59,7 @@ func TestDemoOptionsWithDefaults(t *testing.T) {
 		Username:      "user",
 		UserEmail:     "user@example.com",
 		KeycloakImage: "keycloak:test",
+		IdP:           idpEmbedded,
 	}
 	if got = custom.withDefaults(); got != custom {
 		t.Fatalf("custom options changed: %#v", got)
@@ -260,64 +263,6 @@ func TestDemoServerCloseRemovesResources(t *testing.T) {
 	}
 }
 
-func TestDemoLogoutHandlerRedirects(t *testing.T) {
-	jw, err := jaws.New()
-	if err != nil {
-		t.Fatal(err)
-	}
-	t.Cleanup(jw.Close)
-
-	authServer := &jawsauth.Server{SessionTokenKey: "tokens"}
-	for _, tc := range []struct {
-		name          string
-		endSessionURL string
-		wantLocation  string
-	}{
-		{name: "empty end session", wantLocation: "/logged-out"},
-		{name: "invalid end session", endSessionURL: "http://[::1", wantLocation: "/logged-out"},
-		{name: "valid end session", endSessionURL: "https://issuer.example/logout"},
-	} {
-		t.Run(tc.name, func(t *testing.T) {
-			rr := httptest.NewRecorder()
-			req := httptest.NewRequest(http.MethodGet, "https://app.example/logout", nil)
-			handler := demoLogoutHandler(jw, authServer, "https://app.example", "client-id", tc.endSessionURL)
-
-			handler(rr, req)
-
-			resp := rr.Result()
-			defer closeResponseBody(t, resp)
-			if resp.StatusCode != http.StatusFound {
-				t.Fatal(resp.Status)
-			}
-			location := resp.Header.Get("Location")
-			if tc.wantLocation != "" {
-				if location != tc.wantLocation {
-					t.Fatalf("location = %q, want %q", location, tc.wantLocation)
-				}
-				return
-			}
-
-			u, err := url.Parse(location)
-			if err != nil {
-				t.Fatal(err)
-			}
-			if u.Scheme != "https" || u.Host != "issuer.example" || u.Path != "/logout" {
-				t.Fatal(location)
-			}
-			q := u.Query()
-			if q.Get("client_id") != "client-id" {
-				t.Fatal(location)
-			}
-			if q.Get("post_logout_redirect_uri") != "https://app.example/logged-out" {
-				t.Fatal(location)
-			}
-			if q.Get("id_token_hint") != "" {
-				t.Fatal(location)
-			}
-		})
-	}
-}
-
 func TestStartDemoInvalidListenAddress(t *testing.T) {
 	_, err := startDemo(t.Context(), demoOptions{ListenAddr: "not a tcp address"})
 	if err == nil || !strings.Contains(err.Error(), "resolve listen address") {
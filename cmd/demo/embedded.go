@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/linkdata/jawsauth"
+	"github.com/linkdata/jawsauth/jawsauthtest"
+)
+
+const (
+	idpKeycloak = "keycloak" // Keycloak in a Docker container
+	idpEmbedded = "embedded" // in-process jawsauthtest.Provider served by the demo app
+)
+
+// embeddedIdPPath is the path of the demo app where the embedded identity provider is served.
+const embeddedIdPPath = "/idp"
+
+// startEmbeddedIdP mounts an in-process OIDC provider on mux below embeddedIdPPath,
+// with the demo user logging in using password, and returns it along with the
+// jawsauth configuration for it. The demo app must already be serving mux at appURL.
+func startEmbeddedIdP(mux *http.ServeMux, appURL string, opts demoOptions, password string) (idp *jawsauthtest.Provider, cfg *jawsauth.Config, err error) {
+	if idp, err = jawsauthtest.NewHandler(appURL + embeddedIdPPath); err == nil {
+		idp.ClientID = opts.ClientID
+		idp.ClientSecret = randomPassword(18)
+		idp.AddUser(jawsauthtest.User{
+			Subject:       opts.Username,
+			Email:         opts.UserEmail,
+			EmailVerified: true,
+			Claims:        map[string]any{"preferred_username": opts.Username, "name": "Demo User"},
+			Password:      password,
+		})
+		h := http.StripPrefix(embeddedIdPPath, idp)
+		mux.Handle(http.MethodGet+" "+embeddedIdPPath+"/", h)
+		mux.Handle(http.MethodPost+" "+embeddedIdPPath+"/", h)
+		cfg = &jawsauth.Config{
+			RedirectURL:  appURL + "/oauth2/callback",
+			Issuer:       idp.Issuer(),
+			HTTPClient:   selfSignedClient(30 * time.Second),
+			Scopes:       []string{"profile"},
+			ClientID:     idp.ClientID,
+			ClientSecret: idp.ClientSecret,
+		}
+	}
+	return
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEmbeddedLoginWorks(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), "password.txt")
+	demo, err := startDemo(t.Context(), demoOptions{
+		ListenAddr:   "127.0.0.1:0",
+		PasswordFile: passwordFile,
+		Username:     "demouser",
+		UserEmail:    "demouser@example.com",
+		IdP:          idpEmbedded,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.WithoutCancel(t.Context()), 20*time.Second)
+		defer shutdownCancel()
+		if closeErr := demo.close(shutdownCtx); closeErr != nil {
+			t.Errorf("shutdown demo: %v", closeErr)
+		}
+	})
+	if demo.idpURL != demo.appURL+embeddedIdPPath || demo.keycloak != nil {
+		t.Fatal(demo.idpURL, demo.keycloak)
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := selfSignedClient(30 * time.Second)
+	client.Jar = jar
+	get := func(uri string) (resp *http.Response, body string) {
+		t.Helper()
+		resp, err := client.Get(uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, string(b)
+	}
+	login := func(form url.Values) (resp *http.Response, body string) {
+		t.Helper()
+		resp, page := get(demo.appURL + "/")
+		loginAction, err := extractLoginAction(resp.Request.URL, []byte(page))
+		if err != nil || !strings.HasPrefix(loginAction, demo.idpURL+"/") {
+			t.Fatalf("extract login action %q: %v", loginAction, err)
+		}
+		if resp, err = client.PostForm(loginAction, form); err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, string(b)
+	}
+
+	resp, body := login(url.Values{"cancel": {"1"}})
+	if resp.StatusCode < http.StatusBadRequest || !strings.Contains(body, "Sign-in failed") {
+		t.Fatalf("cancelled login: %s %s", resp.Status, body)
+	}
+
+	resp, body = login(url.Values{"username": {demo.username}, "password": {demo.password}})
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "Signed in as "+demo.userEmail) {
+		t.Fatalf("login: %s %s", resp.Status, body)
+	}
+
+	resp, body = get(demo.appURL + "/oauth2/logout")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "Signed out") {
+		t.Fatalf("logout: %s url=%s body=%s", resp.Status, resp.Request.URL, body)
+	}
+
+	resp, body = get(demo.appURL + "/")
+	if strings.Contains(body, "Signed in as "+demo.userEmail) {
+		t.Fatalf("user should not remain signed in after logout: %s", body)
+	}
+	if _, err = extractLoginAction(resp.Request.URL, []byte(body)); err != nil {
+		t.Fatalf("expected login form after logout: %v", err)
+	}
+}
+
+func TestStartDemoUnknownIdP(t *testing.T) {
+	_, err := startDemo(t.Context(), demoOptions{
+		ListenAddr:   "127.0.0.1:0",
+		PasswordFile: filepath.Join(t.TempDir(), "password.txt"),
+		IdP:          "bogus",
+	})
+	if err == nil || !strings.Contains(err.Error(), `unknown identity provider "bogus"`) {
+		t.Fatalf("error = %v, want unknown identity provider error", err)
+	}
+}
@@ -127,7 +127,7 @@ func TestIntegrationLoginWorks(t *testing.T) {
 		t.Fatalf("missing signed-in marker in body: %s", string(loginBody))
 	}
 
-	logoutResp, err := client.Get(demo.appURL + "/logout")
+	logoutResp, err := client.Get(demo.appURL + "/oauth2/logout")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -20,6 +20,7 @@ func main() {
 	flag.StringVar(&opts.Username, "username", "demo", "demo login username")
 	flag.StringVar(&opts.UserEmail, "user-email", "demo@example.com", "demo login user email")
 	flag.StringVar(&opts.KeycloakImage, "keycloak-image", "quay.io/keycloak/keycloak:latest", "Keycloak Docker image")
+	flag.StringVar(&opts.IdP, "idp", idpKeycloak, "identity provider: keycloak (Docker container) or embedded (in-process mock)")
 	flag.Parse()
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
@@ -31,7 +32,7 @@ func main() {
 	}
 
 	log.Printf("demo app url: %s", demo.appURL)
-	log.Printf("keycloak url: %s", demo.keycloakURL)
+	log.Printf("identity provider url: %s", demo.idpURL)
 	log.Printf("username: %s", demo.username)
 	log.Printf("password file: %s", demo.passwordFile)
 
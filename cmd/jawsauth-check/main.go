@@ -0,0 +1,198 @@
+// Command jawsauth-check validates a jawsauth.Config against its identity provider.
+//
+// It loads the Config from a JSON file (-config or JAWSAUTH_CONFIG, using the
+// Config field names), JAWSAUTH_* environment variables and flags, in increasing
+// order of precedence, runs Config.Check and prints the resolved endpoints,
+// supported scopes and claims, PKCE S256 support, JWKS key types, the handler
+// paths derived from the redirect URL and any warnings.
+//
+// The exit status is 0 on success, 1 if the check failed (or, with -strict, if
+// there were warnings) and 2 for invalid arguments, so it can gate deployments:
+//
+//	jawsauth-check -config jawsauth.json -strict
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/linkdata/jawsauth"
+)
+
+// setting is a Config field that can be set with a flag or an environment variable.
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	set   func(cfg *jawsauth.Config, value string) error
+}
+
+var settings = []setting{
+	{"name", "JAWSAUTH_NAME", "provider name", func(cfg *jawsauth.Config, v string) error { cfg.Name = v; return nil }},
+	{"redirect-url", "JAWSAUTH_REDIRECT_URL", "OAuth2 callback URL", func(cfg *jawsauth.Config, v string) error { cfg.RedirectURL = v; return nil }},
+	{"issuer", "JAWSAUTH_ISSUER", "OIDC issuer URL", func(cfg *jawsauth.Config, v string) error { cfg.Issuer = v; return nil }},
+	{"auth-url", "JAWSAUTH_AUTH_URL", "override for the discovered authorization_endpoint", func(cfg *jawsauth.Config, v string) error { cfg.AuthURL = v; return nil }},
+	{"token-url", "JAWSAUTH_TOKEN_URL", "override for the discovered token_endpoint", func(cfg *jawsauth.Config, v string) error { cfg.TokenURL = v; return nil }},
+	{"userinfo-url", "JAWSAUTH_USERINFO_URL", "override for the discovered userinfo_endpoint", func(cfg *jawsauth.Config, v string) error { cfg.UserInfoURL = v; return nil }},
+	{"end-session-url", "JAWSAUTH_END_SESSION_URL", "override for the discovered end_session_endpoint", func(cfg *jawsauth.Config, v string) error { cfg.EndSessionURL = v; return nil }},
+	{"introspection-url", "JAWSAUTH_INTROSPECTION_URL", "override for the discovered introspection_endpoint", func(cfg *jawsauth.Config, v string) error { cfg.IntrospectionURL = v; return nil }},
+	{"scopes", "JAWSAUTH_SCOPES", "additional scopes, separated by spaces or commas", func(cfg *jawsauth.Config, v string) error {
+		cfg.Scopes = strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' })
+		return nil
+	}},
+	{"client-id", "JAWSAUTH_CLIENT_ID", "OAuth2 client ID", func(cfg *jawsauth.Config, v string) error { cfg.ClientID = v; return nil }},
+	{"client-secret", "JAWSAUTH_CLIENT_SECRET", "OAuth2 client secret", func(cfg *jawsauth.Config, v string) error { cfg.ClientSecret = v; return nil }},
+	{"allow-insecure-issuer", "JAWSAUTH_ALLOW_INSECURE_ISSUER", "permit an http issuer URL", func(cfg *jawsauth.Config, v string) (err error) {
+		cfg.AllowInsecureIssuer, err = strconv.ParseBool(v)
+		return
+	}},
+}
+
+var errWarnings = errors.New("check has warnings")
+
+func main() {
+	os.Exit(run(context.Background(), os.Args[1:], os.Getenv, os.Stdout, os.Stderr))
+}
+
+// run runs the command with args and environment getenv and returns the exit status.
+func run(ctx context.Context, args []string, getenv func(string) string, stdout, stderr io.Writer) (status int) {
+	cfg, timeout, strict, err := loadConfig(args, getenv, stderr)
+	if err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(stderr, "jawsauth-check: %v\n", err)
+		}
+		return 2
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var report *jawsauth.CheckReport
+	if report, err = cfg.Check(ctx); err == nil {
+		printReport(stdout, report)
+		if strict && len(report.Warnings) > 0 {
+			err = errWarnings
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "jawsauth-check: FAIL: %v\n", err)
+		return 1
+	}
+	fmt.Fprintln(stdout, "OK")
+	return 0
+}
+
+// loadConfig builds the Config from the file named by -config or JAWSAUTH_CONFIG,
+// then the environment, then the flags in args.
+func loadConfig(args []string, getenv func(string) string, stderr io.Writer) (cfg *jawsauth.Config, timeout time.Duration, strict bool, err error) {
+	type flagValue struct {
+		s     *setting
+		value string
+	}
+	var flagged []flagValue
+	fs := flag.NewFlagSet("jawsauth-check", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configFile := fs.String("config", getenv("JAWSAUTH_CONFIG"), "JSON file with the Config (env JAWSAUTH_CONFIG)")
+	fs.DurationVar(&timeout, "timeout", 30*time.Second, "timeout for discovery and JWKS requests")
+	fs.BoolVar(&strict, "strict", false, "fail if there are warnings")
+	for i := range settings {
+		s := &settings[i]
+		usage := s.usage + " (env " + s.env + ")"
+		collect := func(value string) error {
+			flagged = append(flagged, flagValue{s: s, value: value})
+			return nil
+		}
+		if s.flag == "allow-insecure-issuer" {
+			fs.BoolFunc(s.flag, usage, collect)
+		} else {
+			fs.Func(s.flag, usage, collect)
+		}
+	}
+	if err = fs.Parse(args); err == nil {
+		err = fmt.Errorf("unexpected arguments: %q", fs.Args())
+		if fs.NArg() == 0 {
+			cfg = &jawsauth.Config{}
+			if err = readConfigFile(*configFile, cfg); err == nil {
+				for i := range settings {
+					if value := getenv(settings[i].env); value != "" && err == nil {
+						if err = settings[i].set(cfg, value); err != nil {
+							err = fmt.Errorf("%s: %w", settings[i].env, err)
+						}
+					}
+				}
+				for _, fv := range flagged {
+					if err == nil {
+						if err = fv.s.set(cfg, fv.value); err != nil {
+							err = fmt.Errorf("-%s: %w", fv.s.flag, err)
+						}
+					}
+				}
+			}
+		}
+	}
+	return
+}
+
+// readConfigFile decodes the JSON file fn into cfg. An empty fn does nothing.
+func readConfigFile(fn string, cfg *jawsauth.Config) (err error) {
+	if fn != "" {
+		var f *os.File
+		if f, err = os.Open(fn); /*#nosec G304*/ err == nil {
+			defer func() {
+				if closeErr := f.Close(); err == nil && closeErr != nil {
+					err = closeErr
+				}
+			}()
+			dec := json.NewDecoder(f)
+			dec.DisallowUnknownFields()
+			if err = dec.Decode(cfg); err != nil {
+				err = fmt.Errorf("%s: %w", fn, err)
+			}
+		}
+	}
+	return
+}
+
+func printReport(w io.Writer, r *jawsauth.CheckReport) {
+	line := func(name, value string) {
+		if value == "" {
+			value = "(none)"
+		}
+		fmt.Fprintf(w, "%-28s %s\n", name+":", value)
+	}
+	list := func(name string, values []string) {
+		value := strings.Join(values, " ")
+		if value == "" {
+			value = "(not advertised)"
+		}
+		line(name, value)
+	}
+	line("issuer", r.Issuer)
+	line("redirect url", r.RedirectURL)
+	line("callback path", r.Paths.Callback)
+	line("login path", r.Paths.Login)
+	line("logout path", r.Paths.Logout)
+	line("back-channel logout path", r.Paths.BackChannelLogout)
+	line("front-channel logout path", r.Paths.FrontChannelLogout)
+	line("authorization endpoint", r.AuthURL)
+	line("token endpoint", r.TokenURL)
+	line("userinfo endpoint", r.UserInfoURL)
+	line("end_session endpoint", r.EndSessionURL)
+	line("revocation endpoint", r.RevocationURL)
+	line("introspection endpoint", r.IntrospectionURL)
+	line("jwks uri", r.JWKSURL)
+	line("scopes requested", strings.Join(r.Scopes, " "))
+	list("scopes supported", r.ScopesSupported)
+	list("claims supported", r.ClaimsSupported)
+	line("pkce s256", strconv.FormatBool(r.PKCES256))
+	line("jwks key types", strings.Join(r.KeyTypes, ", "))
+	for _, warning := range r.Warnings {
+		fmt.Fprintf(w, "WARNING: %s\n", warning)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/linkdata/jawsauth/jawsauthtest"
+)
+
+func newTestProvider(t *testing.T) *jawsauthtest.Provider {
+	t.Helper()
+	p, err := jawsauthtest.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(p.Close)
+	return p
+}
+
+func envFunc(env map[string]string) func(string) string {
+	return func(k string) string { return env[k] }
+}
+
+func TestRunReport(t *testing.T) {
+	p := newTestProvider(t)
+	var stdout, stderr bytes.Buffer
+	status := run(t.Context(), []string{
+		"-issuer", p.Issuer(),
+		"-allow-insecure-issuer",
+		"-client-id", p.ClientID,
+		"-client-secret", p.ClientSecret,
+		"-redirect-url", "https://app.example/auth/callback",
+		"-scopes", "profile,email",
+	}, envFunc(nil), &stdout, &stderr)
+	if status != 0 || stderr.Len() != 0 {
+		t.Fatal(status, stderr.String())
+	}
+	out := stdout.String()
+	for _, want := range []string{
+		"issuer:                      " + p.Issuer() + "\n",
+		"login path:                  /auth/login\n",
+		"front-channel logout path:   /auth/frontchannel-logout\n",
+		"end_session endpoint:        " + p.Issuer() + jawsauthtest.EndpointEndSession + "\n",
+		"revocation endpoint:         " + p.Issuer() + jawsauthtest.EndpointRevocation + "\n",
+		"introspection endpoint:      (none)\n",
+		"scopes requested:            email openid profile\n",
+		"claims supported:            (not advertised)\n",
+		"pkce s256:                   true\n",
+		"jwks key types:              RSA RS256\n",
+		"WARNING: Issuer does not use https (AllowInsecureIssuer is set)\n",
+		"OK\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in\n%s", want, out)
+		}
+	}
+
+	stdout.Reset()
+	if status = run(t.Context(), []string{"-strict"}, envFunc(map[string]string{
+		"JAWSAUTH_ISSUER":                p.Issuer(),
+		"JAWSAUTH_ALLOW_INSECURE_ISSUER": "true",
+		"JAWSAUTH_CLIENT_ID":             p.ClientID,
+		"JAWSAUTH_REDIRECT_URL":          "https://app.example/callback",
+	}), &stdout, &stderr); status != 1 || !strings.Contains(stderr.String(), "FAIL: check has warnings") {
+		t.Fatal(status, stderr.String())
+	}
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "jawsauth.json")
+	if err := os.WriteFile(fn, []byte(`{"Issuer":"https://file.example","ClientID":"file-client","ClientSecret":"file-secret","Scopes":["groups"]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var stderr bytes.Buffer
+	cfg, timeout, strict, err := loadConfig([]string{"-client-id", "flag-client", "-timeout", "5s", "-strict"}, envFunc(map[string]string{
+		"JAWSAUTH_CONFIG":    fn,
+		"JAWSAUTH_CLIENT_ID": "env-client",
+		"JAWSAUTH_SCOPES":    "profile roles",
+	}), &stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Issuer != "https://file.example" || cfg.ClientID != "flag-client" || cfg.ClientSecret != "file-secret" ||
+		strings.Join(cfg.Scopes, " ") != "profile roles" || timeout.String() != "5s" || !strict {
+		t.Fatalf("%+v %v %v", cfg, timeout, strict)
+	}
+
+	for _, tc := range []struct {
+		args []string
+		env  map[string]string
+		want string
+	}{
+		{[]string{"extra"}, nil, "unexpected arguments"},
+		{[]string{"-bogus"}, nil, "flag provided but not defined"},
+		{nil, map[string]string{"JAWSAUTH_ALLOW_INSECURE_ISSUER": "maybe"}, "JAWSAUTH_ALLOW_INSECURE_ISSUER"},
+		{nil, map[string]string{"JAWSAUTH_CONFIG": filepath.Join(t.TempDir(), "missing.json")}, "no such file"},
+		{[]string{"-config", fn + ".bad"}, nil, "no such file"},
+	} {
+		if _, _, _, err = loadConfig(tc.args, envFunc(tc.env), &stderr); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%v %v: %v", tc.args, tc.env, err)
+		}
+	}
+
+	if err = os.WriteFile(fn, []byte(`{"Issuer":"https://file.example","Typo":1}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err = loadConfig([]string{"-config", fn}, envFunc(nil), &stderr); err == nil || !strings.Contains(err.Error(), "Typo") {
+		t.Fatal(err)
+	}
+}
+
+func TestRunFailures(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if status := run(t.Context(), []string{"-bogus"}, envFunc(nil), &stdout, &stderr); status != 2 {
+		t.Fatal(status)
+	}
+	stderr.Reset()
+	if status := run(t.Context(), []string{"-issuer", "http://idp.example"}, envFunc(nil), &stdout, &stderr); status != 1 ||
+		!strings.Contains(stderr.String(), "FAIL: invalid RedirectURL") || stdout.Len() != 0 {
+		t.Fatal(status, stderr.String(), stdout.String())
+	}
+}
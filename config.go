@@ -8,6 +8,7 @@ import (
 	"net/url"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
 	"golang.org/x/oauth2"
@@ -15,15 +16,24 @@ import (
 
 // Config holds the OIDC/OAuth2 settings used by New and NewDebug to construct a Server.
 //
-// RedirectURL, Issuer and ClientID are required; AuthURL, TokenURL and UserInfoURL
-// override values otherwise obtained via OIDC discovery, and the remaining fields
-// are optional.
+// RedirectURL, Issuer and ClientID are required; AuthURL, TokenURL, UserInfoURL,
+// EndSessionURL and IntrospectionURL override values otherwise obtained via OIDC
+// discovery, and the remaining fields are optional.
 type Config struct {
+	// Name identifies the provider in the session and the provider chooser. It is
+	// optional for the provider passed to New, but required by Server.AddProvider.
+	Name        string
 	RedirectURL string // required. e.g. "https://application.example.com/oauth2/callback"
 	Issuer      string // required. e.g. "https://login.microsoftonline.com/00000000-0000-0000-0000-000000000000/v2.0"
 	AuthURL     string // optional override for discovered authorization_endpoint
 	TokenURL    string // optional override for discovered token_endpoint
 	UserInfoURL string // optional override for discovered userinfo_endpoint
+	// EndSessionURL optionally overrides the discovered end_session_endpoint used
+	// for RP-initiated logout (see Server.RPInitiatedLogout).
+	EndSessionURL string
+	// IntrospectionURL optionally overrides the discovered introspection_endpoint
+	// used to validate opaque bearer access tokens (see Server.BearerAuth).
+	IntrospectionURL string
 	// AllowInsecureIssuer permits "http://" Issuer URLs and should only be used for tests/dev.
 	AllowInsecureIssuer bool
 	// HTTPClient is used for OIDC discovery at startup and, unless a per-request
@@ -77,9 +87,10 @@ func validateUrl(k, u, defaultURL string, optional bool) (value string, err erro
 // Validate checks whether cfg contains usable OIDC/OAuth2 settings.
 //
 // RedirectURL, Issuer and ClientID must be present. URL fields must be absolute
-// and include a host; AuthURL, TokenURL and UserInfoURL are optional and
-// validated only when set. Issuer must use https unless AllowInsecureIssuer is
-// true. Returned validation failures match [ErrConfig].
+// and include a host; AuthURL, TokenURL, UserInfoURL, EndSessionURL and
+// IntrospectionURL are optional and validated only when set. Issuer must use
+// https unless AllowInsecureIssuer is true. Returned validation failures match
+// [ErrConfig].
 func (cfg *Config) Validate() (err error) {
 	if _, err = validateUrl("RedirectURL", cfg.RedirectURL, "", false); err == nil {
 		if _, err = validateUrl("Issuer", cfg.Issuer, "", false); err == nil {
@@ -95,7 +106,11 @@ func (cfg *Config) Validate() (err error) {
 				if _, err = validateUrl("AuthURL", cfg.AuthURL, "", true); err == nil {
 					if _, err = validateUrl("TokenURL", cfg.TokenURL, "", true); err == nil {
 						if _, err = validateUrl("UserInfoURL", cfg.UserInfoURL, "", true); err == nil {
-							err = requireStr("ClientID", cfg.ClientID)
+							if _, err = validateUrl("EndSessionURL", cfg.EndSessionURL, "", true); err == nil {
+								if _, err = validateUrl("IntrospectionURL", cfg.IntrospectionURL, "", true); err == nil {
+									err = requireStr("ClientID", cfg.ClientID)
+								}
+							}
 						}
 					}
 				}
@@ -124,7 +139,7 @@ func ensureScopes(rawScopes []string) (scopes []string) {
 	return
 }
 
-func (cfg *Config) buildContext(ctx context.Context, overrideUrl string) (oauth2cfg *oauth2.Config, userInfoURL string, verifier *oidc.IDTokenVerifier, err error) {
+func (cfg *Config) buildContext(ctx context.Context, overrideUrl string, now func() time.Time) (oauth2cfg *oauth2.Config, userInfoURL, endSessionURL, introspectionURL string, verifier, accessTokenVerifier *oidc.IDTokenVerifier, err error) {
 	if err = cfg.Validate(); err == nil {
 		if cfg.HTTPClient != nil {
 			ctx = context.WithValue(ctx, oauth2.HTTPClient, cfg.HTTPClient)
@@ -136,6 +151,8 @@ func (cfg *Config) buildContext(ctx context.Context, overrideUrl string) (oauth2
 				AuthorizationEndpoint string `json:"authorization_endpoint"`
 				TokenEndpoint         string `json:"token_endpoint"`
 				UserinfoEndpoint      string `json:"userinfo_endpoint"`
+				EndSessionEndpoint    string `json:"end_session_endpoint"`
+				IntrospectionEndpoint string `json:"introspection_endpoint"`
 			}
 			if err = provider.Claims(&metadata); wrapOIDC(ErrOIDCProviderMetadata, &err) == nil {
 				var authURL string
@@ -143,23 +160,28 @@ func (cfg *Config) buildContext(ctx context.Context, overrideUrl string) (oauth2
 				if authURL, err = validateUrl("AuthURL", cfg.AuthURL, metadata.AuthorizationEndpoint, false); wrapOIDC(ErrOIDCProviderMetadata, &err) == nil {
 					if tokenURL, err = validateUrl("TokenURL", cfg.TokenURL, metadata.TokenEndpoint, false); wrapOIDC(ErrOIDCProviderMetadata, &err) == nil {
 						if userInfoURL, err = validateUrl("UserInfoURL", cfg.UserInfoURL, metadata.UserinfoEndpoint, true); wrapOIDC(ErrOIDCProviderMetadata, &err) == nil {
-							var redir *url.URL
-							if redir, err = url.Parse(cfg.RedirectURL); err == nil {
-								if u, e := url.Parse(overrideUrl); e == nil {
-									overrideStr(&redir.Scheme, u.Scheme)
-									overrideStr(&redir.Host, u.Host)
-								}
-								oauth2cfg = &oauth2.Config{
-									ClientID:     cfg.ClientID,
-									ClientSecret: cfg.ClientSecret,
-									Endpoint: oauth2.Endpoint{
-										AuthURL:  authURL,
-										TokenURL: tokenURL,
-									},
-									RedirectURL: redir.String(),
-									Scopes:      ensureScopes(cfg.Scopes),
+							if endSessionURL, err = validateUrl("EndSessionURL", cfg.EndSessionURL, metadata.EndSessionEndpoint, true); wrapOIDC(ErrOIDCProviderMetadata, &err) == nil {
+								if introspectionURL, err = validateUrl("IntrospectionURL", cfg.IntrospectionURL, metadata.IntrospectionEndpoint, true); wrapOIDC(ErrOIDCProviderMetadata, &err) == nil {
+									var redir *url.URL
+									if redir, err = url.Parse(cfg.RedirectURL); err == nil {
+										if u, e := url.Parse(overrideUrl); e == nil {
+											overrideStr(&redir.Scheme, u.Scheme)
+											overrideStr(&redir.Host, u.Host)
+										}
+										oauth2cfg = &oauth2.Config{
+											ClientID:     cfg.ClientID,
+											ClientSecret: cfg.ClientSecret,
+											Endpoint: oauth2.Endpoint{
+												AuthURL:  authURL,
+												TokenURL: tokenURL,
+											},
+											RedirectURL: redir.String(),
+											Scopes:      ensureScopes(cfg.Scopes),
+										}
+										verifier = provider.Verifier(&oidc.Config{ClientID: cfg.ClientID, Now: now})
+										accessTokenVerifier = provider.Verifier(&oidc.Config{SkipClientIDCheck: true, Now: now})
+									}
 								}
-								verifier = provider.Verifier(&oidc.Config{ClientID: cfg.ClientID})
 							}
 						}
 					}
@@ -2,6 +2,7 @@ package jawsauth
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
@@ -22,6 +23,8 @@ func newOIDCDiscoveryServer(t *testing.T) *httptest.Server {
 			"authorization_endpoint": server.URL + "/oauth2/auth",
 			"token_endpoint":         server.URL + "/oauth2/token",
 			"userinfo_endpoint":      server.URL + "/oauth2/userinfo",
+			"end_session_endpoint":   server.URL + "/oauth2/logout",
+			"introspection_endpoint": server.URL + "/oauth2/introspect",
 			"jwks_uri":               server.URL + "/oauth2/jwks",
 		}
 		hw.Header().Set("Content-Type", "application/json")
@@ -163,7 +166,7 @@ func TestConfig_buildContext(t *testing.T) {
 				ClientID:            tt.fields.ClientID,
 				ClientSecret:        tt.fields.ClientSecret,
 			}
-			gotOAuth2cfg, _, _, err := cfg.buildContext(t.Context(), tt.overrideURL)
+			gotOAuth2cfg, _, _, _, _, _, err := cfg.buildContext(t.Context(), tt.overrideURL, nil)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Config.Build() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -185,7 +188,7 @@ func TestConfig_buildContextUserInfoSource(t *testing.T) {
 		ClientSecret:        "the-client-secret",
 	}
 
-	_, userinfo, _, err := cfg.buildContext(t.Context(), "")
+	_, userinfo, _, _, _, _, err := cfg.buildContext(t.Context(), "", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -194,7 +197,7 @@ func TestConfig_buildContextUserInfoSource(t *testing.T) {
 	}
 
 	cfg.UserInfoURL = "https://override.example.com/userinfo"
-	_, userinfo, _, err = cfg.buildContext(t.Context(), "")
+	_, userinfo, _, _, _, _, err = cfg.buildContext(t.Context(), "", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -216,7 +219,7 @@ func TestConfig_buildContextWithHTTPClient(t *testing.T) {
 		ClientSecret:        "the-client-secret",
 	}
 
-	got, _, _, err := cfg.buildContext(t.Context(), "")
+	got, _, _, _, _, _, err := cfg.buildContext(t.Context(), "", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -224,3 +227,70 @@ func TestConfig_buildContextWithHTTPClient(t *testing.T) {
 		t.Fatal("expected oauth2 config")
 	}
 }
+
+func TestConfig_buildContextEndSessionSource(t *testing.T) {
+	discovery := newOIDCDiscoveryServer(t)
+	defer discovery.Close()
+
+	cfg := &Config{
+		RedirectURL:         "https://application.example.com/oauth2/callback",
+		Issuer:              discovery.URL,
+		AllowInsecureIssuer: true,
+		ClientID:            "the-client-id",
+	}
+
+	_, _, endSession, _, _, _, err := cfg.buildContext(t.Context(), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if endSession != discovery.URL+"/oauth2/logout" {
+		t.Fatal(endSession)
+	}
+
+	cfg.EndSessionURL = "https://override.example.com/logout"
+	_, _, endSession, _, _, _, err = cfg.buildContext(t.Context(), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if endSession != "https://override.example.com/logout" {
+		t.Fatal(endSession)
+	}
+
+	cfg.EndSessionURL = "/relative"
+	if _, _, _, _, _, _, err = cfg.buildContext(t.Context(), "", nil); !errors.Is(err, ErrConfigURLNotAbsolute) {
+		t.Fatal(err)
+	}
+}
+
+func TestConfig_buildContextIntrospectionSource(t *testing.T) {
+	discovery := newOIDCDiscoveryServer(t)
+	defer discovery.Close()
+
+	cfg := &Config{
+		RedirectURL:         "https://application.example.com/oauth2/callback",
+		Issuer:              discovery.URL,
+		AllowInsecureIssuer: true,
+		ClientID:            "the-client-id",
+	}
+
+	_, _, _, introspection, _, _, err := cfg.buildContext(t.Context(), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if introspection != discovery.URL+"/oauth2/introspect" {
+		t.Fatal(introspection)
+	}
+
+	cfg.IntrospectionURL = "https://override.example.com/introspect"
+	if _, _, _, introspection, _, _, err = cfg.buildContext(t.Context(), "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if introspection != "https://override.example.com/introspect" {
+		t.Fatal(introspection)
+	}
+
+	cfg.IntrospectionURL = "/relative"
+	if err = cfg.Validate(); !errors.Is(err, ErrConfigURLNotAbsolute) {
+		t.Fatal(err)
+	}
+}
@@ -275,6 +275,14 @@ func errorDebugClasses(err error) (classes []string) {
 	classes = appendErrorDebugClass(classes, err, ErrOAuth2MissingSession, "oauth2_missing_session")
 	classes = appendErrorDebugClass(classes, err, ErrOAuth2MissingState, "oauth2_missing_state")
 	classes = appendErrorDebugClass(classes, err, ErrOAuth2WrongState, "oauth2_wrong_state")
+	classes = appendErrorDebugClass(classes, err, ErrOAuth2WrongProvider, "oauth2_wrong_provider")
+	classes = appendErrorDebugClass(classes, err, ErrSessionRevoked, "session_revoked")
+	classes = appendErrorDebugClass(classes, err, ErrSessionIdle, "session_idle")
+	classes = appendErrorDebugClass(classes, err, ErrSessionLifetime, "session_lifetime")
+	classes = appendErrorDebugClass(classes, err, ErrTooManySessions, "too_many_sessions")
+	classes = appendErrorDebugClass(classes, err, ErrStepUpRequired, "step_up_required")
+	classes = appendErrorDebugClass(classes, err, ErrRefreshTokenReuse, "refresh_token_reuse")
+	classes = appendErrorDebugClass(classes, err, errTokenRecordIP, "token_record_ip")
 	classes = appendErrorDebugClass(classes, err, ErrOAuth2MissingPKCEVerifier, "oauth2_missing_pkce_verifier")
 	classes = appendErrorDebugClass(classes, err, ErrOAuth2Callback, "oauth2_callback")
 	classes = appendErrorDebugClass(classes, err, ErrUserInfoStatus, "userinfo_status")
@@ -284,8 +292,21 @@ func errorDebugClasses(err error) (classes []string) {
 	classes = appendErrorDebugClass(classes, err, ErrOIDCInvalidIDToken, "oidc_invalid_id_token")
 	classes = appendErrorDebugClass(classes, err, ErrOIDCMissingNonce, "oidc_missing_nonce")
 	classes = appendErrorDebugClass(classes, err, ErrOIDCNonceMismatch, "oidc_nonce_mismatch")
+	classes = appendErrorDebugClass(classes, err, ErrOIDCInvalidLogoutToken, "oidc_invalid_logout_token")
+	classes = appendErrorDebugClass(classes, err, ErrOIDCInvalidAccessToken, "oidc_invalid_access_token")
+	classes = appendErrorDebugClass(classes, err, ErrEmailNotVerified, "email_not_verified")
+	classes = appendErrorDebugClass(classes, err, ErrDomainNotAllowed, "domain_not_allowed")
+	classes = appendErrorDebugClass(classes, err, errBearerWrongAudience, "bearer_wrong_audience")
+	classes = appendErrorDebugClass(classes, err, errBearerIDToken, "bearer_id_token")
+	classes = appendErrorDebugClass(classes, err, errBearerTokenType, "bearer_token_type")
+	classes = appendErrorDebugClass(classes, err, ErrIntrospectionStatus, "introspection_status")
+	classes = appendErrorDebugClass(classes, err, ErrJWKSStatus, "jwks_status")
+	classes = appendErrorDebugClass(classes, err, errIntrospectionInactive, "introspection_inactive")
 	classes = appendErrorDebugClass(classes, err, errOIDCStaleIDToken, "oidc_stale_id_token")
 	classes = appendErrorDebugClass(classes, err, errOIDCInvalidExpiry, "oidc_invalid_expiry")
 	classes = appendErrorDebugClass(classes, err, errAuthTimerStale, "auth_timer_stale")
+	classes = appendErrorDebugClass(classes, err, errLogoutTokenMissingEvent, "logout_token_missing_event")
+	classes = appendErrorDebugClass(classes, err, errLogoutTokenHasNonce, "logout_token_has_nonce")
+	classes = appendErrorDebugClass(classes, err, errLogoutTokenMissingSubject, "logout_token_missing_subject")
 	return
 }
@@ -0,0 +1,80 @@
+package jawsauth
+
+import (
+	"net/url"
+	"path"
+
+	"github.com/linkdata/jaws"
+	"golang.org/x/oauth2"
+)
+
+const oauth2LogoutStateKey = "oauth2logoutstate"
+
+// endpointURL returns the absolute URL of the named endpoint registered
+// alongside the OAuth2 callback, e.g. "logout".
+func (srv *Server) endpointURL(name string) (s string) {
+	if srv != nil && srv.oauth2cfg != nil {
+		if u, err := url.Parse(srv.oauth2cfg.RedirectURL); err == nil {
+			u.Path = path.Join(path.Dir(path.Clean(callbackPathFromURL(u))), name)
+			u.RawPath = ""
+			u.RawQuery = ""
+			u.Fragment = ""
+			s = u.String()
+		}
+	}
+	return
+}
+
+func (srv *Server) sessionIDTokenHint(sess *jaws.Session) (idTokenHint string) {
+	if tokenSource, ok := sess.Get(srv.SessionTokenKey).(oauth2.TokenSource); ok && tokenSource != nil {
+		if token, err := tokenSource.Token(); err == nil && token != nil {
+			idTokenHint, _ = token.Extra("id_token").(string)
+		} else {
+			srv.debugErrorLog("jawsauth: id_token_hint unavailable", err, "session_id", sess.ID())
+		}
+	}
+	return
+}
+
+// endSessionLocation returns the end_session_endpoint URL of provider p to redirect
+// to if RP-initiated logout is enabled and available, otherwise it returns location.
+//
+// The logout state and the final location are stored in the session so that
+// endSessionReturn can verify the provider's redirect back to the logout endpoint.
+func (srv *Server) endSessionLocation(sess *jaws.Session, p *provider, idTokenHint, location string) (endSessionLocation string) {
+	endSessionLocation = location
+	if srv.RPInitiatedLogout && p != nil && p.endSessionUrl != "" && p.oauth2cfg != nil {
+		if u, err := url.Parse(p.endSessionUrl); err == nil {
+			state := randomHexString()
+			sess.Set(oauth2LogoutStateKey, state)
+			sess.Set(oauth2ReferrerKey, location)
+			q := u.Query()
+			q.Set("client_id", p.oauth2cfg.ClientID)
+			q.Set("post_logout_redirect_uri", srv.endpointURL("logout"))
+			q.Set("state", state)
+			if idTokenHint != "" {
+				q.Set("id_token_hint", idTokenHint)
+			}
+			u.RawQuery = q.Encode()
+			endSessionLocation = u.String()
+		}
+	}
+	return
+}
+
+// endSessionReturn verifies the state returned by the provider after RP-initiated
+// logout and returns the stored final location.
+func (srv *Server) endSessionReturn(sess *jaws.Session, gotState string) (location string, err error) {
+	wantState, _ := sess.Get(oauth2LogoutStateKey).(string)
+	location, _ = sess.Get(oauth2ReferrerKey).(string)
+	sess.Set(oauth2LogoutStateKey, nil)
+	sess.Set(oauth2ReferrerKey, nil)
+	err = ErrOAuth2MissingState
+	if wantState != "" {
+		err = ErrOAuth2WrongState
+		if wantState == gotState {
+			err = nil
+		}
+	}
+	return
+}
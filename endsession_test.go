@@ -0,0 +1,172 @@
+package jawsauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/linkdata/jaws"
+	"golang.org/x/oauth2"
+)
+
+func newEndSessionTestServer(jw *jaws.Jaws) *Server {
+	srv := newWrapperTestServer(jw, "https://issuer.example")
+	srv.HandledPaths["/oauth2/logout"] = struct{}{}
+	srv.RPInitiatedLogout = true
+	srv.endSessionUrl = "https://provider.example/logout?ui_locales=en"
+	return srv
+}
+
+func TestServerEndpointURL(t *testing.T) {
+	srv := &Server{oauth2cfg: &oauth2.Config{RedirectURL: "https://app.example/auth/callback/?x=1#y"}}
+	if got := srv.endpointURL("logout"); got != "https://app.example/auth/logout" {
+		t.Fatal(got)
+	}
+	if got := (*Server)(nil).endpointURL("logout"); got != "" {
+		t.Fatal(got)
+	}
+}
+
+func TestHandleLogoutRPInitiated(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	var logoutEvents int
+	srv := newEndSessionTestServer(jw)
+	srv.LogoutEvent = func(*jaws.Session, *http.Request) { logoutEvents++ }
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/oauth2/logout", nil)
+	req.Header.Set("Referer", "http://example.com/app/page")
+	sess := jw.NewSession(httptest.NewRecorder(), req)
+	sess.Set(srv.SessionKey, map[string]any{"email": "user@example.com"})
+	sess.Set(srv.SessionTokenKey, oauth2.StaticTokenSource(makeOAuth2Token("access", "the-id-token", "")))
+	sess.Set(oauth2IDTokenExpiryKey, time.Now().Add(time.Hour))
+
+	rec := httptest.NewRecorder()
+	srv.HandleLogout(rec, req)
+	if rec.Code != http.StatusFound {
+		t.Fatal(rec.Code)
+	}
+	assertWrapperAuthCleared(t, srv, sess)
+	if logoutEvents != 1 {
+		t.Fatal(logoutEvents)
+	}
+
+	u, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Host != "provider.example" || u.Path != "/logout" {
+		t.Fatal(u)
+	}
+	q := u.Query()
+	state, _ := sess.Get(oauth2LogoutStateKey).(string)
+	if state == "" || q.Get("state") != state {
+		t.Fatal(q.Get("state"), state)
+	}
+	if q.Get("id_token_hint") != "the-id-token" {
+		t.Fatal(q.Get("id_token_hint"))
+	}
+	if q.Get("client_id") != "client" {
+		t.Fatal(q.Get("client_id"))
+	}
+	if q.Get("post_logout_redirect_uri") != "http://example.com/oauth2/logout" {
+		t.Fatal(q.Get("post_logout_redirect_uri"))
+	}
+	if q.Get("ui_locales") != "en" {
+		t.Fatal(q.Get("ui_locales"))
+	}
+
+	returnReq := httptest.NewRequest(http.MethodGet, "http://example.com/oauth2/logout?state="+state, nil)
+	returnReq.Header = req.Header.Clone()
+	returnReq.Header.Set("Referer", "https://provider.example/")
+	rec = httptest.NewRecorder()
+	srv.HandleLogout(rec, returnReq)
+	if rec.Code != http.StatusFound {
+		t.Fatal(rec.Code)
+	}
+	if loc := rec.Header().Get("Location"); loc != "/app/page" {
+		t.Fatal(loc)
+	}
+	if value := sess.Get(oauth2LogoutStateKey); value != nil {
+		t.Fatal(value)
+	}
+	if logoutEvents != 1 {
+		t.Fatal(logoutEvents)
+	}
+}
+
+func TestHandleLogoutRPInitiatedWrongState(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	srv := newEndSessionTestServer(jw)
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/oauth2/logout?state=wrong", nil)
+	sess := jw.NewSession(httptest.NewRecorder(), req)
+	sess.Set(oauth2LogoutStateKey, "right")
+	sess.Set(srv.SessionKey, map[string]any{"email": "user@example.com"})
+	sess.Set(oauth2IDTokenExpiryKey, time.Now().Add(time.Hour))
+
+	rec := httptest.NewRecorder()
+	srv.HandleLogout(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatal(rec.Code)
+	}
+	if loc := rec.Header().Get("Location"); loc != "" {
+		t.Fatal(loc)
+	}
+	assertWrapperAuthCleared(t, srv, sess)
+	if value := sess.Get(oauth2LogoutStateKey); value != nil {
+		t.Fatal(value)
+	}
+}
+
+func TestHandleLogoutLocalOnly(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	for _, tc := range []struct {
+		name         string
+		rpInitiated  bool
+		endSession   string
+		redirect     string
+		wantLocation string
+	}{
+		{name: "disabled", endSession: "https://provider.example/logout", wantLocation: "/app"},
+		{name: "unsupported", rpInitiated: true, wantLocation: "/app"},
+		{name: "logoutRedirect", redirect: "https://example.com/signed-out", wantLocation: "/signed-out"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newEndSessionTestServer(jw)
+			srv.RPInitiatedLogout = tc.rpInitiated
+			srv.endSessionUrl = tc.endSession
+			srv.LogoutRedirect = tc.redirect
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/oauth2/logout", nil)
+			req.Header.Set("Referer", "http://example.com/app")
+			sess := jw.NewSession(httptest.NewRecorder(), req)
+
+			rec := httptest.NewRecorder()
+			srv.HandleLogout(rec, req)
+			if rec.Code != http.StatusFound {
+				t.Fatal(rec.Code)
+			}
+			if loc := rec.Header().Get("Location"); loc != tc.wantLocation {
+				t.Fatal(loc)
+			}
+			if value := sess.Get(oauth2LogoutStateKey); value != nil {
+				t.Fatal(value)
+			}
+		})
+	}
+}
@@ -20,6 +20,12 @@ var ErrOIDCMissingNonce = errors.New("oidc missing nonce")
 // ErrOIDCNonceMismatch means the id_token nonce did not match the stored session nonce.
 var ErrOIDCNonceMismatch = errors.New("oidc nonce mismatch")
 
+// ErrOIDCInvalidLogoutToken means a back-channel logout_token failed validation.
+var ErrOIDCInvalidLogoutToken = errors.New("oidc invalid logout_token")
+
+// ErrOIDCInvalidAccessToken means a bearer access token failed validation.
+var ErrOIDCInvalidAccessToken = errors.New("oidc invalid access_token")
+
 type errOIDC struct {
 	kind  error
 	cause error
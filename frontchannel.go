@@ -0,0 +1,85 @@
+package jawsauth
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/linkdata/jaws"
+)
+
+// issuerOrigins returns the space separated scheme and host of the configured
+// providers' issuers, or an empty string.
+func (srv *Server) issuerOrigins() string {
+	var origins []string
+	for _, p := range srv.allProviders() {
+		if origin := p.issuerOrigin(); origin != "" && !slices.Contains(origins, origin) {
+			origins = append(origins, origin)
+		}
+	}
+	return strings.Join(origins, " ")
+}
+
+// permitFraming relaxes the headers written by SetHeaders so that only origin, which
+// may list several space separated origins, may frame the response. If origin is
+// empty, framing remains denied.
+func permitFraming(hw http.ResponseWriter, origin string) {
+	if origin != "" {
+		hdr := hw.Header()
+		hdr.Del("X-Frame-Options")
+		directives := []string{}
+		for directive := range strings.SplitSeq(hdr.Get("Content-Security-Policy"), ";") {
+			if directive = strings.TrimSpace(directive); directive != "" {
+				if name, _, _ := strings.Cut(directive, " "); !strings.EqualFold(name, "frame-ancestors") {
+					directives = append(directives, directive)
+				}
+			}
+		}
+		directives = append(directives, "frame-ancestors "+origin)
+		hdr.Set("Content-Security-Policy", strings.Join(directives, "; "))
+	}
+}
+
+// frontChannelLogoutMatches reports whether iss and sid are both present and
+// match the values stored in sess at login.
+func (srv *Server) frontChannelLogoutMatches(sess *jaws.Session, iss, sid string) (matches bool) {
+	if _, present := srv.sessionAuthStatus(sess, nil); present && iss != "" && sid != "" {
+		claims, _ := sess.Get(srv.SessionKey).(map[string]any)
+		gotIss, _ := claims["iss"].(string)
+		gotSid, _ := sess.Get(oauth2SidKey).(string)
+		matches = iss == gotIss && sid == gotSid
+	}
+	return
+}
+
+// HandleFrontChannelLogout handles OIDC Front-Channel Logout requests.
+//
+// The provider loads this endpoint in an iframe. For GET requests, if the iss and
+// sid query parameters are both present and match the values stored at login, the
+// session is cleared using Logout. Requests without them are ignored, since the
+// endpoint may be framed or linked by other pages; the provider must be configured
+// to send them (frontchannel_logout_session_required). It always responds with an
+// empty page that must not be cached and may only be framed by the issuers'
+// origins. Non-GET requests receive 405.
+func (srv *Server) HandleFrontChannelLogout(hw http.ResponseWriter, hr *http.Request) {
+	statusCode := http.StatusMethodNotAllowed
+	if hr.Method == http.MethodGet {
+		statusCode = http.StatusOK
+		if sess := srv.Jaws.GetSession(hr); sess != nil {
+			iss := hr.FormValue("iss") // #nosec G120
+			sid := hr.FormValue("sid") // #nosec G120
+			if srv.frontChannelLogoutMatches(sess, iss, sid) {
+				srv.Logout(sess, hr)
+			} else {
+				srv.debugLog("jawsauth: front-channel logout ignored", "session_id", sess.ID(), "iss", iss, "sid", sid)
+			}
+		}
+	}
+	SetHeaders(hw, srv.ishttps)
+	permitFraming(hw, srv.issuerOrigins())
+	hdr := hw.Header()
+	hdr.Set("Cache-Control", "no-cache, no-store")
+	hdr.Set("Pragma", "no-cache")
+	hdr.Set("Content-Type", "text/html; charset=utf-8")
+	hw.WriteHeader(statusCode)
+}
@@ -0,0 +1,132 @@
+package jawsauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linkdata/jaws"
+)
+
+func TestPermitFraming(t *testing.T) {
+	hw := httptest.NewRecorder()
+	DefaultSetHeaders(hw, true)
+	permitFraming(hw, "https://idp.example")
+	if x := hw.Header().Get("X-Frame-Options"); x != "" {
+		t.Fatal(x)
+	}
+	csp := hw.Header().Get("Content-Security-Policy")
+	if strings.Contains(csp, "frame-ancestors 'none'") || !strings.Contains(csp, "frame-ancestors https://idp.example") {
+		t.Fatal(csp)
+	}
+	if !strings.Contains(csp, "default-src 'self'") {
+		t.Fatal(csp)
+	}
+
+	hw = httptest.NewRecorder()
+	DefaultSetHeaders(hw, true)
+	permitFraming(hw, "")
+	if x := hw.Header().Get("X-Frame-Options"); x != "DENY" {
+		t.Fatal(x)
+	}
+}
+
+func TestHandleFrontChannelLogout(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	const issuer = "https://issuer.example/realms/test"
+	srv := newWrapperTestServer(jw, issuer)
+	srv.issuer = issuer
+
+	for _, tc := range []struct {
+		name      string
+		query     string
+		wantClear bool
+	}{
+		{name: "match", query: "?iss=" + issuer + "&sid=sid-1", wantClear: true},
+		{name: "sidOnly", query: "?sid=sid-1"},
+		{name: "issOnly", query: "?iss=" + issuer},
+		{name: "noParams"},
+		{name: "wrongSid", query: "?iss=" + issuer + "&sid=sid-2"},
+		{name: "wrongIss", query: "?iss=https://other.example&sid=sid-1"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/oauth2/frontchannel-logout"+tc.query, nil)
+			sess := jw.NewSession(httptest.NewRecorder(), req)
+			sess.Set(srv.SessionKey, map[string]any{"iss": issuer, "sid": "sid-1"})
+			sess.Set(oauth2SidKey, "sid-1")
+			sess.Set(oauth2IDTokenExpiryKey, time.Now().Add(time.Hour))
+			var logoutEvents int
+			srv.LogoutEvent = func(*jaws.Session, *http.Request) { logoutEvents++ }
+
+			rec := httptest.NewRecorder()
+			srv.HandleFrontChannelLogout(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatal(rec.Code)
+			}
+			if rec.Body.Len() != 0 {
+				t.Fatal(rec.Body.String())
+			}
+			hdr := rec.Header()
+			if x := hdr.Get("Cache-Control"); x != "no-cache, no-store" {
+				t.Fatal(x)
+			}
+			if x := hdr.Get("X-Frame-Options"); x != "" {
+				t.Fatal(x)
+			}
+			if x := hdr.Get("Content-Security-Policy"); !strings.Contains(x, "frame-ancestors https://issuer.example") {
+				t.Fatal(x)
+			}
+			if tc.wantClear {
+				assertWrapperAuthCleared(t, srv, sess)
+				if value := sess.Get(oauth2SidKey); value != nil {
+					t.Fatal(value)
+				}
+				if logoutEvents != 1 {
+					t.Fatal(logoutEvents)
+				}
+			} else {
+				if sess.Get(srv.SessionKey) == nil {
+					t.Fatal("session was cleared")
+				}
+				if logoutEvents != 0 {
+					t.Fatal(logoutEvents)
+				}
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	srv.HandleFrontChannelLogout(rec, httptest.NewRequest(http.MethodPost, "http://example.com/oauth2/frontchannel-logout", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatal(rec.Code)
+	}
+}
+
+func TestStoreSessionAuthClaimsStoresSid(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	srv := newTimerTestServer(t, jw, "https://issuer.example", &testAuthTimerFactory{})
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/protected", nil)
+	sess := jw.NewSession(httptest.NewRecorder(), req)
+	err = srv.storeSessionAuthClaims(t.Context(), sess, srv.defaultProvider(), map[string]any{
+		"email": "user@example.com",
+		"sid":   "sid-123",
+	}, nil, time.Now().Add(time.Hour), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sid, _ := sess.Get(oauth2SidKey).(string); sid != "sid-123" {
+		t.Fatal(sid)
+	}
+}
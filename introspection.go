@@ -0,0 +1,195 @@
+package jawsauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// ErrIntrospectionStatus means the token introspection endpoint returned a non-200 HTTP status.
+var ErrIntrospectionStatus = errors.New("introspection status")
+
+var errIntrospectionInactive = errors.New("token not active")
+
+type introspectionEntry struct {
+	claims map[string]any
+	expiry time.Time
+}
+
+func introspectionKey(rawToken string) [32]byte {
+	return sha256.Sum256([]byte(rawToken))
+}
+
+// claimStrings returns the string or strings in a claim value such as "aud".
+func claimStrings(v any) (values []string) {
+	switch v := v.(type) {
+	case string:
+		values = append(values, v)
+	case []string:
+		values = append(values, v...)
+	case []any:
+		for _, x := range v {
+			if s, ok := x.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+	return
+}
+
+// claimTime returns the time of a NumericDate claim value such as "exp", or the zero time.
+func claimTime(v any) (t time.Time) {
+	if f, ok := v.(float64); ok && f > 0 {
+		t = time.Unix(int64(f), 0)
+	}
+	return
+}
+
+// introspectionProvider returns the provider that introspects opaque bearer
+// tokens: the one named by BearerProvider, or if that is empty, the only
+// provider with an introspection endpoint. It returns nil if there is none or
+// if BearerProvider is empty and several providers support introspection.
+func (srv *Server) introspectionProvider() (p *provider) {
+	if srv != nil {
+		if srv.BearerProvider != "" {
+			p = srv.getProvider(srv.BearerProvider)
+		} else {
+			for _, candidate := range srv.allProviders() {
+				if candidate.introspectionUrl != "" {
+					if p != nil {
+						return nil
+					}
+					p = candidate
+				}
+			}
+		}
+		if p != nil && (p.introspectionUrl == "" || p.oauth2cfg == nil) {
+			p = nil
+		}
+	}
+	return
+}
+
+func (srv *Server) introspectionConfigured() bool {
+	return srv.introspectionProvider() != nil
+}
+
+func (srv *Server) cachedIntrospection(key [32]byte, now time.Time) (claims map[string]any) {
+	srv.mu.Lock()
+	if entry, ok := srv.introspected[key]; ok {
+		if now.Before(entry.expiry) {
+			claims = maps.Clone(entry.claims)
+		} else {
+			delete(srv.introspected, key)
+		}
+	}
+	srv.mu.Unlock()
+	return
+}
+
+func (srv *Server) cacheIntrospection(key [32]byte, claims map[string]any, expiry, now time.Time) {
+	srv.mu.Lock()
+	if srv.introspected == nil {
+		srv.introspected = make(map[[32]byte]introspectionEntry)
+	}
+	for k, entry := range srv.introspected {
+		if !now.Before(entry.expiry) {
+			delete(srv.introspected, k)
+		}
+	}
+	srv.introspected[key] = introspectionEntry{claims: maps.Clone(claims), expiry: expiry}
+	srv.mu.Unlock()
+}
+
+// introspect calls the RFC 7662 token introspection endpoint of p using the
+// client credentials of p and returns the claims of an active token.
+func introspect(ctx context.Context, p *provider, rawToken string) (claims map[string]any, err error) {
+	form := url.Values{"token": {rawToken}, "token_type_hint": {"access_token"}}
+	var req *http.Request
+	if req, err = http.NewRequestWithContext(ctx, http.MethodPost, p.introspectionUrl, strings.NewReader(form.Encode())); err == nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Accept", "application/json")
+		req.SetBasicAuth(url.QueryEscape(p.oauth2cfg.ClientID), url.QueryEscape(p.oauth2cfg.ClientSecret))
+		client, _ := ctx.Value(oauth2.HTTPClient).(*http.Client)
+		if client == nil {
+			client = http.DefaultClient
+		}
+		var resp *http.Response
+		if resp, err = client.Do(req); /*#nosec G704*/ err == nil {
+			defer func() {
+				if closeErr := resp.Body.Close(); err == nil && closeErr != nil {
+					err = closeErr
+				}
+			}()
+			var body []byte
+			if body, err = io.ReadAll(io.LimitReader(resp.Body, 32768)); err == nil {
+				if resp.StatusCode == http.StatusOK {
+					if err = json.Unmarshal(body, &claims); err == nil {
+						err = errIntrospectionInactive
+						if active, _ := claims["active"].(bool); active {
+							delete(claims, "active")
+							err = nil
+						}
+					}
+				} else {
+					err = fmt.Errorf("%w %s", ErrIntrospectionStatus, resp.Status)
+				}
+			}
+		}
+	}
+	return
+}
+
+// introspectedAccessToken returns true unless the introspection result has a
+// "token_type" other than an access token. RFC 7662 uses the RFC 6749 token
+// type, such as "Bearer", but some providers report "access_token".
+func introspectedAccessToken(claims map[string]any) bool {
+	switch tokenType, _ := claims["token_type"].(string); strings.ToLower(tokenType) {
+	case "", "bearer", "access_token":
+		return true
+	}
+	return false
+}
+
+// introspectBearerToken validates an opaque access token using the token
+// introspection endpoint of the provider chosen by introspectionProvider.
+// Opaque tokens are never sent to any other provider.
+//
+// If BearerAudience is set, the result must have an accepted "aud", and a
+// "token_type", if present, must name an access token. Active results are cached
+// until their "exp" claim; results without "exp" are not cached.
+func (srv *Server) introspectBearerToken(ctx context.Context, rawToken string) (claims map[string]any, err error) {
+	key := introspectionKey(rawToken)
+	now := srv.now()
+	if claims = srv.cachedIntrospection(key, now); claims == nil {
+		err = ErrOAuth2NotConfigured
+		if p := srv.introspectionProvider(); p != nil {
+			if claims, err = introspect(srv.providerContext(ctx, p), p, rawToken); err == nil {
+				expiry := claimTime(claims["exp"])
+				if !expiry.IsZero() && !now.Before(expiry) {
+					err = errIntrospectionInactive
+				} else if !introspectedAccessToken(claims) {
+					err = errBearerTokenType
+				} else if len(srv.BearerAudience) > 0 && !srv.acceptsAudience(claimStrings(claims["aud"])) {
+					err = errBearerWrongAudience
+				} else if !expiry.IsZero() {
+					srv.cacheIntrospection(key, claims, expiry, now)
+				}
+			}
+			if err != nil {
+				claims = nil
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,196 @@
+package jawsauth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/linkdata/jaws"
+	"golang.org/x/oauth2"
+)
+
+func newIntrospectionServer(t *testing.T, calls *atomic.Int32, results map[string]map[string]any) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(hw http.ResponseWriter, hr *http.Request) {
+		calls.Add(1)
+		if user, pass, ok := hr.BasicAuth(); !ok || user != "client" || pass != "secret" {
+			hw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if hr.Method != http.MethodPost || hr.FormValue("token_type_hint") != "access_token" {
+			hw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		result, ok := results[hr.FormValue("token")]
+		if !ok {
+			result = map[string]any{"active": false}
+		}
+		hw.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(hw).Encode(result)
+	}))
+}
+
+func TestServerIntrospectBearerToken(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	exp := time.Now().Add(time.Hour).Unix()
+	var calls atomic.Int32
+	introspection := newIntrospectionServer(t, &calls, map[string]map[string]any{
+		"opaque":      {"active": true, "sub": "sub-123", "username": "api", "email": "api@example.com", "aud": "api", "exp": exp},
+		"no-exp":      {"active": true, "sub": "sub-456", "aud": "api"},
+		"expired":     {"active": true, "sub": "sub-789", "aud": "api", "exp": time.Now().Add(-time.Minute).Unix()},
+		"no-aud":      {"active": true, "sub": "sub-123", "exp": exp},
+		"other-aud":   {"active": true, "sub": "sub-123", "aud": []string{"other-api"}, "exp": exp},
+		"client-aud":  {"active": true, "sub": "sub-123", "aud": "client", "exp": exp},
+		"api-aud":     {"active": true, "sub": "sub-123", "aud": "api", "token_type": "Bearer", "exp": exp},
+		"refresh":     {"active": true, "sub": "sub-123", "aud": "api", "token_type": "refresh_token", "exp": exp},
+		"unavailable": {"active": "yes"},
+	})
+	defer introspection.Close()
+
+	srv := newBearerTestServer(jw)
+	srv.oauth2cfg.ClientSecret = "secret"
+	srv.introspectionUrl = introspection.URL
+
+	claims, err := srv.verifyBearerToken(t.Context(), "opaque")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := claims["active"]; ok || claims["sub"] != "sub-123" {
+		t.Fatal(claims)
+	}
+	claims["sub"] = "modified"
+	if claims, err = srv.verifyBearerToken(t.Context(), "opaque"); err != nil || claims["sub"] != "sub-123" {
+		t.Fatal(claims, err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatal(n)
+	}
+
+	if _, err = srv.verifyBearerToken(t.Context(), "no-exp"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = srv.verifyBearerToken(t.Context(), "no-exp"); err != nil {
+		t.Fatal(err)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Fatal(n)
+	}
+
+	for _, rawToken := range []string{"unknown", "expired", "unavailable"} {
+		if _, err = srv.verifyBearerToken(t.Context(), rawToken); !errors.Is(err, errIntrospectionInactive) || !errors.Is(err, ErrOIDCInvalidAccessToken) {
+			t.Fatal(rawToken, err)
+		}
+	}
+	for _, rawToken := range []string{"no-aud", "other-aud", "client-aud"} {
+		if _, err = srv.verifyBearerToken(t.Context(), rawToken); !errors.Is(err, errBearerWrongAudience) {
+			t.Fatal(rawToken, err)
+		}
+	}
+	if _, err = srv.verifyBearerToken(t.Context(), "refresh"); !errors.Is(err, errBearerTokenType) {
+		t.Fatal(err)
+	}
+	if _, err = srv.verifyBearerToken(t.Context(), "api-aud"); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.oauth2cfg.ClientSecret = "wrong"
+	if _, err = srv.verifyBearerToken(t.Context(), "no-exp"); !errors.Is(err, ErrIntrospectionStatus) {
+		t.Fatal(err)
+	}
+
+	var gotAuth *JawsAuth
+	h := srv.Wrap(http.HandlerFunc(func(hw http.ResponseWriter, hr *http.Request) {
+		gotAuth = srv.RequestAuth(hr)
+		hw.WriteHeader(http.StatusNoContent)
+	}))
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/api", nil)
+	req.Header.Set("Authorization", "Bearer opaque")
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent || gotAuth.Email() != "api@example.com" {
+		t.Fatal(rec.Code, gotAuth.Data())
+	}
+}
+
+func TestServerIntrospectionCacheExpiry(t *testing.T) {
+	srv := &Server{}
+	now := time.Now()
+	key := introspectionKey("token")
+	srv.cacheIntrospection(introspectionKey("old"), map[string]any{"sub": "old"}, now.Add(time.Second), now)
+	srv.cacheIntrospection(key, map[string]any{"sub": "sub-123"}, now.Add(time.Minute), now.Add(2*time.Second))
+	if _, ok := srv.introspected[introspectionKey("old")]; ok {
+		t.Fatal("expired entry not pruned")
+	}
+	if claims := srv.cachedIntrospection(key, now.Add(30*time.Second)); claims["sub"] != "sub-123" {
+		t.Fatal(claims)
+	}
+	if claims := srv.cachedIntrospection(key, now.Add(time.Minute)); claims != nil {
+		t.Fatal(claims)
+	}
+	if len(srv.introspected) != 0 {
+		t.Fatal(len(srv.introspected))
+	}
+}
+
+func TestServerIntrospectionProvider(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	results := map[string]map[string]any{"opaque": {"active": true, "sub": "sub-123", "aud": "api"}}
+	var primaryCalls, secondCalls atomic.Int32
+	primary := newIntrospectionServer(t, &primaryCalls, results)
+	defer primary.Close()
+	second := newIntrospectionServer(t, &secondCalls, results)
+	defer second.Close()
+
+	srv := newBearerTestServer(jw)
+	srv.providerName = "primary"
+	srv.oauth2cfg.ClientSecret = "secret"
+	srv.introspectionUrl = primary.URL
+	srv.providers = map[string]*provider{"second": {
+		name:             "second",
+		oauth2cfg:        &oauth2.Config{ClientID: "client", ClientSecret: "secret"},
+		introspectionUrl: second.URL,
+	}}
+
+	if p := srv.introspectionProvider(); p != nil {
+		t.Fatal(p.name)
+	}
+	if _, err = srv.verifyBearerToken(t.Context(), "opaque"); err == nil {
+		t.Fatal("ambiguous introspection provider accepted the token")
+	}
+	if n := primaryCalls.Load() + secondCalls.Load(); n != 0 {
+		t.Fatal(n)
+	}
+
+	srv.BearerProvider = "second"
+	if claims, err := srv.verifyBearerToken(t.Context(), "opaque"); err != nil || claims["sub"] != "sub-123" {
+		t.Fatal(claims, err)
+	}
+	if primaryCalls.Load() != 0 || secondCalls.Load() != 1 {
+		t.Fatal(primaryCalls.Load(), secondCalls.Load())
+	}
+
+	srv.BearerProvider = "missing"
+	if p := srv.introspectionProvider(); p != nil {
+		t.Fatal(p.name)
+	}
+
+	srv.BearerProvider = ""
+	srv.introspectionUrl = ""
+	if p := srv.introspectionProvider(); p == nil || p.name != "second" {
+		t.Fatal(p)
+	}
+}
@@ -7,22 +7,33 @@ import "github.com/linkdata/jaws"
 type JawsAuth struct {
 	server *Server
 	sess   *jaws.Session
+	claims map[string]any // verified bearer token claims, if any
 }
 
-// Data returns the verified OIDC claims stored in the session, or nil.
+// Data returns the verified OIDC claims stored in the session, or the verified
+// bearer token claims (see Server.RequestAuth), or nil.
 // It is safe to call on a nil or zero-value JawsAuth.
 func (a *JawsAuth) Data() (x map[string]any) {
-	if a != nil && a.server != nil && a.sess != nil {
-		x, _ = a.sess.Get(a.server.SessionKey).(map[string]any)
+	if a != nil {
+		if a.claims != nil {
+			x = a.claims
+		} else if a.server != nil && a.sess != nil {
+			x, _ = a.sess.Get(a.server.SessionKey).(map[string]any)
+		}
 	}
 	return
 }
 
-// Email returns the authenticated email stored in the session, or an empty string.
+// Email returns the authenticated email stored in the session or present in the
+// bearer token claims, or an empty string.
 // It is safe to call on a nil or zero-value JawsAuth.
 func (a *JawsAuth) Email() (s string) {
-	if a != nil && a.server != nil && a.sess != nil {
-		s, _ = a.sess.Get(a.server.SessionEmailKey).(string)
+	if a != nil && a.server != nil {
+		if a.claims != nil {
+			s = claimEmail(a.claims)
+		} else if a.sess != nil {
+			s, _ = a.sess.Get(a.server.SessionEmailKey).(string)
+		}
 	}
 	return
 }
@@ -30,19 +41,25 @@ func (a *JawsAuth) Email() (s string) {
 // EmailVerified returns whether the authenticated email was marked verified.
 // It is safe to call on a nil or zero-value JawsAuth.
 func (a *JawsAuth) EmailVerified() (yes bool) {
-	if a != nil && a.server != nil && a.sess != nil {
-		yes, _ = a.sess.Get(a.server.SessionEmailVerifiedKey).(bool)
+	if a != nil {
+		if a.claims != nil {
+			yes = extractEmailVerified(a.claims)
+		} else if a.server != nil && a.sess != nil {
+			yes, _ = a.sess.Get(a.server.SessionEmailVerifiedKey).(bool)
+		}
 	}
 	return
 }
 
-// IsAdmin reports whether the authenticated email is an administrator.
+// IsAdmin reports whether the authenticated email is an administrator. If
+// Server.AdminEmailVerified or Server.RequireEmailVerified is set, the email must
+// also be verified.
 // A nil or zero-value JawsAuth follows Server.IsAdmin's nil-server behavior and returns true.
 func (a *JawsAuth) IsAdmin() (yes bool) {
 	if a == nil || a.server == nil {
 		yes = true
 	} else {
-		yes = a.server.IsAdmin(a.Email())
+		yes = a.server.isVerifiedAdmin(a.Email(), a.EmailVerified())
 	}
 	return
 }
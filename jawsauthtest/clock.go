@@ -0,0 +1,92 @@
+package jawsauthtest
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/linkdata/jawsauth"
+)
+
+// Clock is a jawsauth.Clock whose time only moves when Advance is called.
+// Timers fire synchronously, in order, on the goroutine calling Advance.
+type Clock struct {
+	mu     sync.Mutex // protects following
+	now    time.Time
+	timers []*clockTimer
+}
+
+type clockTimer struct {
+	clock *Clock
+	at    time.Time
+	f     func()
+}
+
+// NewClock returns a Clock set to now.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now implements jawsauth.Clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// AfterFunc implements jawsauth.Clock.
+func (c *Clock) AfterFunc(d time.Duration, f func()) jawsauth.Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &clockTimer{clock: c, at: c.now.Add(max(d, 0)), f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the time forward by d, firing every timer that becomes due
+// with the time set to the timer's deadline. Timers started by fired timers
+// fire as well if they are due before the new time.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	target := c.now.Add(d)
+	for {
+		slices.SortStableFunc(c.timers, func(a, b *clockTimer) int { return a.at.Compare(b.at) })
+		if len(c.timers) == 0 || c.timers[0].at.After(target) {
+			break
+		}
+		t := c.timers[0]
+		c.timers = c.timers[1:]
+		if t.at.After(c.now) {
+			c.now = t.at
+		}
+		c.mu.Unlock()
+		t.f()
+		c.mu.Lock()
+	}
+	if target.After(c.now) {
+		c.now = target
+	}
+	c.mu.Unlock()
+}
+
+// Pending returns the number of timers that have not fired or been stopped.
+func (c *Clock) Pending() (n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// Stop implements jawsauth.Timer.
+func (t *clockTimer) Stop() (stopped bool) {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, other := range c.timers {
+		if other == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			stopped = true
+			break
+		}
+	}
+	return
+}
@@ -0,0 +1,93 @@
+package jawsauthtest
+
+import (
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/linkdata/jaws"
+	"github.com/linkdata/jawsauth"
+)
+
+func TestClock(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewClock(start)
+	var fired []time.Duration
+	record := func() { fired = append(fired, c.Now().Sub(start)) }
+	c.AfterFunc(2*time.Second, record)
+	c.AfterFunc(time.Second, func() {
+		record()
+		c.AfterFunc(time.Second/2, record)
+	})
+	stopped := c.AfterFunc(time.Second, record)
+	c.AfterFunc(time.Minute, record)
+	if !stopped.Stop() || stopped.Stop() {
+		t.Fatal("Stop")
+	}
+
+	c.Advance(3 * time.Second)
+	if len(fired) != 3 || fired[0] != time.Second || fired[1] != 1500*time.Millisecond || fired[2] != 2*time.Second {
+		t.Fatal(fired)
+	}
+	if got := c.Now().Sub(start); got != 3*time.Second || c.Pending() != 1 {
+		t.Fatal(got, c.Pending())
+	}
+}
+
+func TestClockFastForwardsSessions(t *testing.T) {
+	p := newTestProvider(t)
+	clock := NewClock(time.Now())
+	p.Clock = clock
+	p.IDTokenLifetime = time.Hour
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	mux := http.NewServeMux()
+	app := httptest.NewServer(mux)
+	defer app.Close()
+	srv, err := jawsauth.New(jw, p.Config(app.URL+"/oauth2/callback"), mux.Handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Clock = clock
+	var loggedOut int
+	srv.LogoutEvent = func(*jaws.Session, *http.Request) { loggedOut++ }
+	mux.Handle("/protected", srv.Wrap(http.HandlerFunc(func(hw http.ResponseWriter, hr *http.Request) {
+		_, _ = io.WriteString(hw, "ok")
+	})))
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Jar: jar}
+	resp, err := client.Get(app.URL + "/protected")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(resp.StatusCode)
+	}
+
+	// five hours of id_tokens are refreshed by the auth-refresh timer
+	clock.Advance(5 * time.Hour)
+	if n := p.Requests(EndpointToken); n != 6 {
+		t.Fatal(n)
+	}
+	if sessions := srv.Sessions(); len(sessions) != 1 || !sessions[0].IDTokenExpiry.After(clock.Now()) {
+		t.Fatal(sessions)
+	}
+
+	// once the provider ends the login, the session ends when its id_token expires
+	p.EndSessions("alice")
+	clock.Advance(time.Hour)
+	if len(srv.Sessions()) != 0 || loggedOut != 1 {
+		t.Fatal(srv.Sessions(), loggedOut)
+	}
+}
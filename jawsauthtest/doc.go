@@ -0,0 +1,18 @@
+// Package jawsauthtest provides an in-process mock OIDC provider for testing
+// applications that use jawsauth without network access or containers.
+//
+// A [Provider] serves discovery, JWKS, authorization, token (authorization
+// code and refresh), UserInfo, end-session and token revocation endpoints
+// from an httptest.Server. Users, their claims and token lifetimes are
+// programmable, and errors can be injected per endpoint with [Provider.Fail].
+// Users with a Password are asked for it with a login form, and [NewHandler]
+// creates a Provider to be mounted in an existing server, such as a demo app.
+// A [Clock] shared by the Provider and the jawsauth.Server lets tests
+// fast-forward token lifetimes and the auth-refresh timer deterministically.
+//
+//	p, err := jawsauthtest.New()
+//	...
+//	defer p.Close()
+//	p.AddUser(jawsauthtest.User{Subject: "alice", Email: "alice@example.com", EmailVerified: true})
+//	srv, err := jawsauth.New(jw, p.Config("http://app.example/oauth2/callback"), mux.Handle)
+package jawsauthtest
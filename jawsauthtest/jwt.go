@@ -0,0 +1,66 @@
+package jawsauthtest
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"strings"
+)
+
+const keyID = "jawsauthtest"
+
+// ErrMalformedJWT means a token passed to Parse is not a compact JWS.
+var ErrMalformedJWT = errors.New("malformed jwt")
+
+// Sign returns claims as a JWT signed with the Provider's key, so that it
+// verifies against the Provider's JWKS. Use it to craft tokens the endpoints
+// do not issue, such as back-channel logout tokens.
+func (p *Provider) Sign(claims map[string]any) (jwt string, err error) {
+	var payload []byte
+	if payload, err = json.Marshal(claims); err == nil {
+		signingInput := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT","kid":"`+keyID+`"}`)) +
+			"." + base64.RawURLEncoding.EncodeToString(payload)
+		sum := sha256.Sum256([]byte(signingInput))
+		var signature []byte
+		if signature, err = rsa.SignPKCS1v15(nil, p.key, crypto.SHA256, sum[:]); err == nil {
+			jwt = signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+		}
+	}
+	return
+}
+
+// Parse verifies the signature of a JWT signed by the Provider and returns
+// its claims. It does not check the expiry or any other claim.
+func (p *Provider) Parse(jwt string) (claims map[string]any, err error) {
+	err = ErrMalformedJWT
+	if parts := strings.Split(jwt, "."); len(parts) == 3 {
+		var signature, payload []byte
+		if signature, err = base64.RawURLEncoding.DecodeString(parts[2]); err == nil {
+			sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+			if err = rsa.VerifyPKCS1v15(&p.key.PublicKey, crypto.SHA256, sum[:], signature); err == nil {
+				if payload, err = base64.RawURLEncoding.DecodeString(parts[1]); err == nil {
+					err = json.Unmarshal(payload, &claims)
+				}
+			}
+		}
+	}
+	return
+}
+
+func (p *Provider) serveJWKS(hw http.ResponseWriter, hr *http.Request) {
+	writeJSON(hw, http.StatusOK, map[string]any{
+		"keys": []map[string]any{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": keyID,
+			"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	})
+}
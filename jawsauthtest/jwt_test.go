@@ -0,0 +1,46 @@
+package jawsauthtest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+)
+
+func TestProviderSignVerifiesWithJWKS(t *testing.T) {
+	p, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	jwt, err := p.Sign(map[string]any{"iss": p.Issuer(), "aud": p.ClientID, "sub": "alice", "exp": 4102444800})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := oidc.ClientContext(context.Background(), p.Client())
+	provider, err := oidc.NewProvider(ctx, p.Issuer())
+	if err != nil {
+		t.Fatal(err)
+	}
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: p.ClientID}).Verify(ctx, jwt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idToken.Subject != "alice" {
+		t.Fatal(idToken.Subject)
+	}
+
+	claims, err := p.Parse(jwt)
+	if err != nil || claims["sub"] != "alice" {
+		t.Fatal(claims, err)
+	}
+	if _, err = p.Parse(jwt[:strings.LastIndexByte(jwt, '.')] + ".AAAA"); err == nil {
+		t.Fatal("tampered signature verified")
+	}
+	if _, err = p.Parse("a.b"); !errors.Is(err, ErrMalformedJWT) {
+		t.Fatal(err)
+	}
+}
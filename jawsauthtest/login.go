@@ -0,0 +1,65 @@
+package jawsauthtest
+
+import (
+	"crypto/subtle"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var loginTemplate = template.Must(template.New("login").Parse(`<!doctype html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Sign in</title>
+</head>
+<body>
+  <h1>Sign in</h1>
+  {{with .Error}}<p id="error">{{.}}</p>{{end}}
+  <form method="post" action="{{.Action}}">
+    <p><label>Username <input name="username" value="{{.Username}}" autocomplete="username" required></label></p>
+    <p><label>Password <input name="password" type="password" autocomplete="current-password" required></label></p>
+    <p><button type="submit">Sign in</button> <button type="submit" name="cancel" value="1" formnovalidate>Cancel</button></p>
+  </form>
+</body>
+</html>
+`))
+
+// passwordLogin authenticates u at the authorization endpoint with a login form
+// that is posted back to it. It returns true if the posted username matches the
+// user's subject or email and the password is correct. Otherwise it has already
+// responded with the form or, if the login was cancelled or prompt=none was
+// requested, redirected to redirectURI with an error.
+func (p *Provider) passwordLogin(hw http.ResponseWriter, hr *http.Request, redirectURI *url.URL, u User) (ok bool) {
+	if hr.URL.Query().Get("prompt") == "none" {
+		redirectError(hw, hr, redirectURI, "login_required", "password required")
+		return
+	}
+	var username, loginError string
+	if hr.Method == http.MethodPost {
+		if err := hr.ParseForm(); err != nil {
+			http.Error(hw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if hr.PostForm.Get("cancel") != "" {
+			redirectError(hw, hr, redirectURI, "access_denied", "login cancelled")
+			return
+		}
+		username = strings.TrimSpace(hr.PostForm.Get("username"))
+		validUser := username == u.Subject || (u.Email != "" && strings.EqualFold(username, u.Email))
+		validPassword := subtle.ConstantTimeCompare([]byte(hr.PostForm.Get("password")), []byte(u.Password)) == 1
+		if ok = validUser && validPassword; ok {
+			return
+		}
+		loginError = "Invalid username or password."
+	}
+	hw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	hw.Header().Set("Cache-Control", "no-store")
+	_ = loginTemplate.Execute(hw, map[string]string{
+		"Action":   p.Issuer() + EndpointAuthorize + "?" + hr.URL.RawQuery,
+		"Username": username,
+		"Error":    loginError,
+	})
+	return
+}
@@ -0,0 +1,92 @@
+package jawsauthtest
+
+import (
+	"html"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestProviderPasswordLogin(t *testing.T) {
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	p, err := NewHandler(ts.URL + "/idp/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	mux.Handle("/idp/", http.StripPrefix("/idp", p))
+	if p.Issuer() != ts.URL+"/idp" || p.Client() != http.DefaultClient {
+		t.Fatal(p.Issuer(), p.Client())
+	}
+	p.AddUser(User{Subject: "alice", Email: "alice@example.com", Password: "s3cret"})
+
+	cfg := oauth2Config(p)
+	authURL := cfg.AuthCodeURL("state123")
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	post := func(username, password, cancel string) (resp *http.Response, body string) {
+		t.Helper()
+		form := url.Values{"username": {username}, "password": {password}}
+		if cancel != "" {
+			form.Set("cancel", cancel)
+		}
+		var err error
+		if resp, err = client.PostForm(authURL, form); err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		return resp, string(b)
+	}
+
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	action := regexp.MustCompile(`action="([^"]+)"`).FindSubmatch(page)
+	if resp.StatusCode != http.StatusOK || len(action) != 2 || html.UnescapeString(string(action[1])) != authURL {
+		t.Fatal(resp.StatusCode, string(page))
+	}
+
+	resp, err = client.Get(authURL + "&prompt=none")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if location, _ := url.Parse(resp.Header.Get("Location")); resp.StatusCode != http.StatusFound || location.Query().Get("error") != "login_required" {
+		t.Fatal(resp.StatusCode, location)
+	}
+
+	if resp, body := post("alice", "wrong", ""); resp.StatusCode != http.StatusOK || !strings.Contains(body, "Invalid username or password.") || !strings.Contains(body, `value="alice"`) {
+		t.Fatal(resp.StatusCode, body)
+	}
+	if resp, body := post("bob", "s3cret", ""); resp.StatusCode != http.StatusOK || !strings.Contains(body, "Invalid username or password.") {
+		t.Fatal(resp.StatusCode, body)
+	}
+	if resp, _ := post("", "", "1"); resp.StatusCode != http.StatusFound {
+		t.Fatal(resp.StatusCode)
+	} else if location, _ := url.Parse(resp.Header.Get("Location")); location.Query().Get("error") != "access_denied" || location.Query().Get("state") != "state123" {
+		t.Fatal(location)
+	}
+
+	resp, _ = post("Alice@Example.com", "s3cret", "")
+	location, _ := url.Parse(resp.Header.Get("Location"))
+	if resp.StatusCode != http.StatusFound || location.Query().Get("code") == "" {
+		t.Fatal(resp.StatusCode, location)
+	}
+	tok, err := cfg.Exchange(t.Context(), location.Query().Get("code"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := p.Parse(tok.Extra("id_token").(string))
+	if err != nil || claims["sub"] != "alice" || claims["iss"] != p.Issuer() {
+		t.Fatal(claims, err)
+	}
+}
@@ -0,0 +1,589 @@
+package jawsauthtest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/linkdata/jawsauth"
+)
+
+// Endpoint paths served by a Provider, for use with Fail and Requests.
+const (
+	EndpointDiscovery  = "/.well-known/openid-configuration"
+	EndpointJWKS       = "/jwks"
+	EndpointAuthorize  = "/authorize"
+	EndpointToken      = "/token"
+	EndpointUserInfo   = "/userinfo"
+	EndpointEndSession = "/end_session"
+	EndpointRevocation = "/revoke"
+)
+
+// User is an account of a Provider.
+type User struct {
+	Subject       string         // "sub" claim, required
+	Email         string         // "email" claim, if not empty
+	EmailVerified bool           // "email_verified" claim, set if Email is not empty
+	Claims        map[string]any // additional claims for id_tokens and UserInfo responses
+	Password      string         // if not empty, the authorization endpoint asks for it with a login form
+}
+
+// Failure is an error response injected with Provider.Fail.
+type Failure struct {
+	Status      int    // HTTP status code, if zero http.StatusBadRequest; EndpointAuthorize redirects with the error instead
+	Error       string // OAuth2 error code, e.g. "invalid_grant", or "login_required" for EndpointAuthorize
+	Description string // optional error_description
+	Times       int    // if positive, the number of requests that fail; otherwise requests fail until ClearFailures
+}
+
+// grant is what an authorization code, access token or refresh token stands for.
+type grant struct {
+	subject     string
+	sid         string
+	nonce       string
+	acr         string
+	authTime    time.Time
+	redirectURI string
+	challenge   string
+	expiry      time.Time // access tokens only
+	used        bool      // refresh tokens replaced by RotateRefreshTokens
+}
+
+// Provider is an in-memory OIDC provider served by an httptest.Server, or by
+// the caller as an http.Handler if created with NewHandler.
+//
+// The authorization endpoint logs in the user selected with Login (or the
+// "login_hint" parameter) without any user interaction, unless the user has a
+// Password. Exported fields must be set before clients use the Provider.
+type Provider struct {
+	ClientID            string         // accepted client_id, "jawsauthtest" by default
+	ClientSecret        string         // accepted client_secret, "secret" by default
+	IDTokenLifetime     time.Duration  // lifetime of issued id_tokens, one hour by default
+	AccessTokenLifetime time.Duration  // lifetime of issued access tokens, one hour by default
+	RotateRefreshTokens bool           // if true, refreshes issue a new refresh token, and reusing a replaced one ends the login
+	Clock               jawsauth.Clock // if not nil, the time source for issued tokens; should match the Server's Clock
+	server              *httptest.Server
+	handler             http.Handler
+	issuer              string
+	key                 *rsa.PrivateKey
+	mu                  sync.Mutex // protects following
+	users               map[string]User
+	login               string // subject of the user the authorization endpoint logs in
+	failures            map[string]*Failure
+	requests            map[string]int
+	codes               map[string]*grant
+	access              map[string]*grant
+	refresh             map[string]*grant
+	ended               map[string]struct{} // sids of ended logins
+}
+
+// New starts a Provider on a local httptest.Server. Call Close when done.
+func New() (p *Provider, err error) {
+	if p, err = newProvider(); err == nil {
+		p.server = httptest.NewServer(p.handler)
+		p.issuer = p.server.URL
+	}
+	return
+}
+
+// NewHandler returns a Provider with the given issuer URL that is not served
+// on its own. Serve it with ServeHTTP at the issuer URL, stripping the issuer's
+// path prefix, e.g. using http.StripPrefix.
+func NewHandler(issuer string) (p *Provider, err error) {
+	if p, err = newProvider(); err == nil {
+		p.issuer = strings.TrimSuffix(issuer, "/")
+	}
+	return
+}
+
+func newProvider() (p *Provider, err error) {
+	var key *rsa.PrivateKey
+	if key, err = rsa.GenerateKey(rand.Reader, 2048); err == nil {
+		p = &Provider{
+			ClientID:            "jawsauthtest",
+			ClientSecret:        "secret",
+			IDTokenLifetime:     time.Hour,
+			AccessTokenLifetime: time.Hour,
+			key:                 key,
+			users:               make(map[string]User),
+			failures:            make(map[string]*Failure),
+			requests:            make(map[string]int),
+			codes:               make(map[string]*grant),
+			access:              make(map[string]*grant),
+			refresh:             make(map[string]*grant),
+			ended:               make(map[string]struct{}),
+		}
+		mux := http.NewServeMux()
+		p.handle(mux, EndpointDiscovery, p.serveDiscovery)
+		p.handle(mux, EndpointJWKS, p.serveJWKS)
+		p.handle(mux, EndpointAuthorize, p.serveAuthorize)
+		p.handle(mux, EndpointToken, p.serveToken)
+		p.handle(mux, EndpointUserInfo, p.serveUserInfo)
+		p.handle(mux, EndpointEndSession, p.serveEndSession)
+		p.handle(mux, EndpointRevocation, p.serveRevocation)
+		p.handler = mux
+	}
+	return
+}
+
+// Close shuts down the Provider's server, if it has one.
+func (p *Provider) Close() {
+	if p.server != nil {
+		p.server.Close()
+	}
+}
+
+// ServeHTTP serves the Provider's endpoints.
+func (p *Provider) ServeHTTP(hw http.ResponseWriter, hr *http.Request) {
+	p.handler.ServeHTTP(hw, hr)
+}
+
+// Issuer returns the issuer URL of the Provider.
+func (p *Provider) Issuer() string {
+	return p.issuer
+}
+
+// Client returns an HTTP client for the Provider's server, or
+// http.DefaultClient if the Provider was created with NewHandler.
+func (p *Provider) Client() (client *http.Client) {
+	client = http.DefaultClient
+	if p.server != nil {
+		client = p.server.Client()
+	}
+	return
+}
+
+// Config returns a jawsauth.Config for the Provider's client, using redirectURL
+// as the OAuth2 callback.
+func (p *Provider) Config(redirectURL string) *jawsauth.Config {
+	return &jawsauth.Config{
+		RedirectURL:         redirectURL,
+		Issuer:              p.Issuer(),
+		AllowInsecureIssuer: true,
+		HTTPClient:          p.Client(),
+		ClientID:            p.ClientID,
+		ClientSecret:        p.ClientSecret,
+	}
+}
+
+// AddUser adds u, replacing any user with the same Subject. The first user
+// added is the one the authorization endpoint logs in until Login is called.
+func (p *Provider) AddUser(u User) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.users[u.Subject] = u
+	if p.login == "" {
+		p.login = u.Subject
+	}
+}
+
+// Login selects the user the authorization endpoint logs in by subject.
+// An unknown subject makes authorization requests fail with "login_required".
+func (p *Provider) Login(subject string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.login = subject
+}
+
+// EndSessions ends all logins of the user with the given subject, so that
+// their refresh and access tokens are rejected, and returns how many were ended.
+func (p *Provider) EndSessions(subject string) (n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, tokens := range []map[string]*grant{p.access, p.refresh} {
+		for _, g := range tokens {
+			if _, ok := p.ended[g.sid]; !ok && g.subject == subject {
+				p.ended[g.sid] = struct{}{}
+				n++
+			}
+		}
+	}
+	return
+}
+
+// Fail makes requests to endpoint return f instead of being served.
+func (p *Provider) Fail(endpoint string, f Failure) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failures[endpoint] = &f
+}
+
+// ClearFailures removes all failures injected with Fail.
+func (p *Provider) ClearFailures() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	clear(p.failures)
+}
+
+// Requests returns the number of requests made to endpoint, including failed ones.
+func (p *Provider) Requests(endpoint string) (n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.requests[endpoint]
+}
+
+func (p *Provider) now() time.Time {
+	if p.Clock != nil {
+		return p.Clock.Now()
+	}
+	return time.Now()
+}
+
+func (p *Provider) handle(mux *http.ServeMux, endpoint string, fn http.HandlerFunc) {
+	mux.HandleFunc(endpoint, func(hw http.ResponseWriter, hr *http.Request) {
+		if f := p.failure(endpoint); f != nil {
+			if endpoint == EndpointAuthorize {
+				if redirectURI, err := url.Parse(hr.URL.Query().Get("redirect_uri")); err == nil && redirectURI.IsAbs() {
+					redirectError(hw, hr, redirectURI, f.Error, f.Description)
+					return
+				}
+			}
+			status := f.Status
+			if status == 0 {
+				status = http.StatusBadRequest
+			}
+			writeError(hw, status, f.Error, f.Description)
+		} else {
+			fn(hw, hr)
+		}
+	})
+}
+
+// failure counts a request to endpoint and returns the failure to respond with, if any.
+func (p *Provider) failure(endpoint string) (f *Failure) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.requests[endpoint]++
+	if injected := p.failures[endpoint]; injected != nil {
+		f = new(Failure)
+		*f = *injected
+		if injected.Times > 0 {
+			if injected.Times--; injected.Times == 0 {
+				delete(p.failures, endpoint)
+			}
+		}
+	}
+	return
+}
+
+func (p *Provider) serveDiscovery(hw http.ResponseWriter, hr *http.Request) {
+	issuer := p.Issuer()
+	writeJSON(hw, http.StatusOK, map[string]any{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + EndpointAuthorize,
+		"token_endpoint":                        issuer + EndpointToken,
+		"userinfo_endpoint":                     issuer + EndpointUserInfo,
+		"jwks_uri":                              issuer + EndpointJWKS,
+		"end_session_endpoint":                  issuer + EndpointEndSession,
+		"revocation_endpoint":                   issuer + EndpointRevocation,
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code", "refresh_token"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"scopes_supported":                      []string{"openid", "email", "profile"},
+	})
+}
+
+func (p *Provider) serveAuthorize(hw http.ResponseWriter, hr *http.Request) {
+	q := hr.URL.Query()
+	redirectURI, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || !redirectURI.IsAbs() || q.Get("client_id") != p.ClientID {
+		http.Error(hw, "invalid client_id or redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if q.Get("response_type") != "code" {
+		redirectError(hw, hr, redirectURI, "unsupported_response_type", "")
+		return
+	}
+	if q.Get("code_challenge") != "" && q.Get("code_challenge_method") != "S256" {
+		redirectError(hw, hr, redirectURI, "invalid_request", "code_challenge_method must be S256")
+		return
+	}
+	p.mu.Lock()
+	u, ok := p.findUser(q.Get("login_hint"))
+	p.mu.Unlock()
+	if ok && u.Password != "" && !p.passwordLogin(hw, hr, redirectURI, u) {
+		return
+	}
+	p.mu.Lock()
+	code := randomString()
+	if ok {
+		acr, _, _ := strings.Cut(strings.TrimSpace(q.Get("acr_values")), " ")
+		p.codes[code] = &grant{
+			subject:     u.Subject,
+			sid:         randomString(),
+			nonce:       q.Get("nonce"),
+			acr:         acr,
+			authTime:    p.now(),
+			redirectURI: redirectURI.String(),
+			challenge:   q.Get("code_challenge"),
+		}
+	}
+	p.mu.Unlock()
+	if !ok {
+		redirectError(hw, hr, redirectURI, "login_required", "no such user")
+		return
+	}
+	v := redirectURI.Query()
+	v.Set("code", code)
+	if state := q.Get("state"); state != "" {
+		v.Set("state", state)
+	}
+	redirectURI.RawQuery = v.Encode()
+	http.Redirect(hw, hr, redirectURI.String(), http.StatusFound)
+}
+
+// findUser returns the user matching the subject or email in hint, or if hint
+// is empty, the user selected with Login.
+func (p *Provider) findUser(hint string) (u User, ok bool) {
+	if hint == "" {
+		u, ok = p.users[p.login]
+	} else if u, ok = p.users[hint]; !ok {
+		for _, candidate := range p.users {
+			if candidate.Email != "" && strings.EqualFold(candidate.Email, hint) {
+				return candidate, true
+			}
+		}
+	}
+	return
+}
+
+func (p *Provider) serveToken(hw http.ResponseWriter, hr *http.Request) {
+	if p.authenticateClient(hw, hr) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		switch hr.PostForm.Get("grant_type") {
+		case "authorization_code":
+			p.exchangeCode(hw, hr.PostForm)
+		case "refresh_token":
+			p.refreshToken(hw, hr.PostForm)
+		default:
+			writeError(hw, http.StatusBadRequest, "unsupported_grant_type", "")
+		}
+	}
+}
+
+// authenticateClient checks the client credentials of a POST request, using
+// either HTTP Basic authentication or form parameters, and writes an error
+// response if they are missing or wrong.
+func (p *Provider) authenticateClient(hw http.ResponseWriter, hr *http.Request) (ok bool) {
+	if hr.Method != http.MethodPost {
+		writeError(hw, http.StatusMethodNotAllowed, "invalid_request", "POST required")
+	} else if err := hr.ParseForm(); err != nil {
+		writeError(hw, http.StatusBadRequest, "invalid_request", err.Error())
+	} else {
+		clientID, clientSecret, basic := hr.BasicAuth()
+		if basic {
+			clientID, _ = url.QueryUnescape(clientID)
+			clientSecret, _ = url.QueryUnescape(clientSecret)
+		} else {
+			clientID, clientSecret = hr.PostForm.Get("client_id"), hr.PostForm.Get("client_secret")
+		}
+		if ok = clientID == p.ClientID && clientSecret == p.ClientSecret; !ok {
+			writeError(hw, http.StatusUnauthorized, "invalid_client", "")
+		}
+	}
+	return
+}
+
+func (p *Provider) exchangeCode(hw http.ResponseWriter, form url.Values) {
+	code := form.Get("code")
+	g := p.codes[code]
+	delete(p.codes, code)
+	switch {
+	case g == nil:
+		writeError(hw, http.StatusBadRequest, "invalid_grant", "unknown or used code")
+	case g.redirectURI != form.Get("redirect_uri"):
+		writeError(hw, http.StatusBadRequest, "invalid_grant", "redirect_uri mismatch")
+	case g.challenge != "" && s256(form.Get("code_verifier")) != g.challenge:
+		writeError(hw, http.StatusBadRequest, "invalid_grant", "code_verifier mismatch")
+	default:
+		p.issueTokens(hw, g, "")
+	}
+}
+
+func (p *Provider) refreshToken(hw http.ResponseWriter, form url.Values) {
+	refreshToken := form.Get("refresh_token")
+	g := p.refresh[refreshToken]
+	if g == nil {
+		writeError(hw, http.StatusBadRequest, "invalid_grant", "unknown refresh token")
+	} else if _, ended := p.ended[g.sid]; ended {
+		writeError(hw, http.StatusBadRequest, "invalid_grant", "login ended")
+	} else if g.used {
+		p.ended[g.sid] = struct{}{}
+		writeError(hw, http.StatusBadRequest, "invalid_grant", "refresh token reused")
+	} else {
+		if p.RotateRefreshTokens {
+			g.used = true
+			refreshToken = ""
+		}
+		p.issueTokens(hw, g, refreshToken)
+	}
+}
+
+// issueTokens writes a token response for g. A new refresh token is issued if
+// refreshToken is empty.
+func (p *Provider) issueTokens(hw http.ResponseWriter, g *grant, refreshToken string) {
+	u, ok := p.users[g.subject]
+	if !ok {
+		writeError(hw, http.StatusBadRequest, "invalid_grant", "no such user")
+		return
+	}
+	now := p.now()
+	accessToken := randomString()
+	accessGrant := *g
+	accessGrant.expiry = now.Add(p.AccessTokenLifetime)
+	p.access[accessToken] = &accessGrant
+	if refreshToken == "" {
+		refreshToken = randomString()
+		refreshGrant := *g
+		refreshGrant.nonce = ""
+		refreshGrant.used = false
+		p.refresh[refreshToken] = &refreshGrant
+	}
+	claims := userClaims(u)
+	claims["iss"] = p.Issuer()
+	claims["aud"] = p.ClientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(p.IDTokenLifetime).Unix()
+	claims["auth_time"] = g.authTime.Unix()
+	claims["sid"] = g.sid
+	if g.nonce != "" {
+		claims["nonce"] = g.nonce
+	}
+	if g.acr != "" {
+		claims["acr"] = g.acr
+	}
+	idToken, err := p.Sign(claims)
+	if err != nil {
+		writeError(hw, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	writeJSON(hw, http.StatusOK, map[string]any{
+		"access_token":  accessToken,
+		"token_type":    "Bearer",
+		"expires_in":    int64(p.AccessTokenLifetime / time.Second),
+		"refresh_token": refreshToken,
+		"id_token":      idToken,
+		"scope":         "openid email",
+	})
+}
+
+func (p *Provider) serveUserInfo(hw http.ResponseWriter, hr *http.Request) {
+	accessToken, _ := strings.CutPrefix(hr.Header.Get("Authorization"), "Bearer ")
+	p.mu.Lock()
+	var u User
+	g, ok := p.access[accessToken]
+	if ok {
+		_, ended := p.ended[g.sid]
+		ok = !ended && p.now().Before(g.expiry)
+		if ok {
+			u, ok = p.users[g.subject]
+		}
+	}
+	p.mu.Unlock()
+	if !ok {
+		hw.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeError(hw, http.StatusUnauthorized, "invalid_token", "")
+		return
+	}
+	writeJSON(hw, http.StatusOK, userClaims(u))
+}
+
+func (p *Provider) serveEndSession(hw http.ResponseWriter, hr *http.Request) {
+	q := hr.URL.Query()
+	if claims, err := p.Parse(q.Get("id_token_hint")); err == nil {
+		if sid, _ := claims["sid"].(string); sid != "" {
+			p.mu.Lock()
+			p.ended[sid] = struct{}{}
+			p.mu.Unlock()
+		}
+	}
+	if target, err := url.Parse(q.Get("post_logout_redirect_uri")); err == nil && target.IsAbs() {
+		if state := q.Get("state"); state != "" {
+			v := target.Query()
+			v.Set("state", state)
+			target.RawQuery = v.Encode()
+		}
+		http.Redirect(hw, hr, target.String(), http.StatusFound)
+		return
+	}
+	hw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = hw.Write([]byte("logged out\n"))
+}
+
+func (p *Provider) serveRevocation(hw http.ResponseWriter, hr *http.Request) {
+	if p.authenticateClient(hw, hr) {
+		token := hr.PostForm.Get("token")
+		p.mu.Lock()
+		delete(p.access, token)
+		delete(p.refresh, token)
+		p.mu.Unlock()
+		hw.WriteHeader(http.StatusOK)
+	}
+}
+
+// userClaims returns the claims describing u in id_tokens and UserInfo responses.
+func userClaims(u User) (claims map[string]any) {
+	claims = maps.Clone(u.Claims)
+	if claims == nil {
+		claims = make(map[string]any)
+	}
+	claims["sub"] = u.Subject
+	if u.Email != "" {
+		claims["email"] = u.Email
+		claims["email_verified"] = u.EmailVerified
+	}
+	return
+}
+
+func redirectError(hw http.ResponseWriter, hr *http.Request, redirectURI *url.URL, code, description string) {
+	target := *redirectURI
+	v := target.Query()
+	v.Set("error", code)
+	if description != "" {
+		v.Set("error_description", description)
+	}
+	if state := hr.URL.Query().Get("state"); state != "" {
+		v.Set("state", state)
+	}
+	target.RawQuery = v.Encode()
+	http.Redirect(hw, hr, target.String(), http.StatusFound)
+}
+
+func writeError(hw http.ResponseWriter, status int, code, description string) {
+	body := map[string]any{"error": code}
+	if description != "" {
+		body["error_description"] = description
+	}
+	writeJSON(hw, status, body)
+}
+
+func writeJSON(hw http.ResponseWriter, status int, v any) {
+	hw.Header().Set("Content-Type", "application/json")
+	hw.Header().Set("Cache-Control", "no-store")
+	hw.WriteHeader(status)
+	_ = json.NewEncoder(hw).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func s256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,259 @@
+package jawsauthtest
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/linkdata/jaws"
+	"github.com/linkdata/jawsauth"
+	"golang.org/x/oauth2"
+)
+
+func newTestProvider(t *testing.T) *Provider {
+	t.Helper()
+	p, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(p.Close)
+	p.AddUser(User{Subject: "alice", Email: "alice@example.com", EmailVerified: true, Claims: map[string]any{"name": "Alice"}})
+	p.AddUser(User{Subject: "bob", Email: "bob@example.com"})
+	return p
+}
+
+// authorize runs the authorization request for cfg and returns the code.
+func authorize(t *testing.T, p *Provider, cfg *oauth2.Config, verifier string, opts ...oauth2.AuthCodeOption) (code string) {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(cfg.AuthCodeURL("state123", append(opts, oauth2.S256ChallengeOption(verifier))...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.StatusCode != http.StatusFound || location.Query().Get("state") != "state123" {
+		t.Fatal(resp.StatusCode, location, err)
+	}
+	return location.Query().Get("code")
+}
+
+func oauth2Config(p *Provider) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.ClientID,
+		ClientSecret: p.ClientSecret,
+		Endpoint:     oauth2.Endpoint{AuthURL: p.Issuer() + EndpointAuthorize, TokenURL: p.Issuer() + EndpointToken, AuthStyle: oauth2.AuthStyleInHeader},
+		RedirectURL:  "http://app.example/callback",
+		Scopes:       []string{"openid", "email"},
+	}
+}
+
+func TestProviderJawsauthLogin(t *testing.T) {
+	p := newTestProvider(t)
+	p.Login("bob")
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	mux := http.NewServeMux()
+	app := httptest.NewServer(mux)
+	defer app.Close()
+	srv, err := jawsauth.New(jw, p.Config(app.URL+"/oauth2/callback"), mux.Handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux.Handle("/protected", srv.Wrap(http.HandlerFunc(func(hw http.ResponseWriter, hr *http.Request) {
+		email, _ := jw.GetSession(hr).Get(srv.SessionEmailKey).(string)
+		_, _ = io.WriteString(hw, email)
+	})))
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := (&http.Client{Jar: jar}).Get(app.URL + "/protected")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "bob@example.com" {
+		t.Fatal(resp.StatusCode, string(body))
+	}
+	if n := p.Requests(EndpointToken); n != 1 {
+		t.Fatal(n)
+	}
+	if n := p.Requests(EndpointUserInfo); n != 1 {
+		t.Fatal(n)
+	}
+}
+
+func TestProviderTokens(t *testing.T) {
+	p := newTestProvider(t)
+	cfg := oauth2Config(p)
+	verifier := oauth2.GenerateVerifier()
+	code := authorize(t, p, cfg, verifier, oauth2.SetAuthURLParam("nonce", "nonce123"), oauth2.SetAuthURLParam("acr_values", "mfa pwd"))
+
+	if _, err := cfg.Exchange(t.Context(), code, oauth2.VerifierOption("wrong")); !isOAuth2Error(err, "invalid_grant") {
+		t.Fatal(err)
+	}
+	// codes are single use, even after a failed exchange
+	if _, err := cfg.Exchange(t.Context(), code, oauth2.VerifierOption(verifier)); !isOAuth2Error(err, "invalid_grant") {
+		t.Fatal(err)
+	}
+	code = authorize(t, p, cfg, verifier, oauth2.SetAuthURLParam("nonce", "nonce123"), oauth2.SetAuthURLParam("acr_values", "mfa pwd"))
+	token, err := cfg.Exchange(t.Context(), code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	idToken, _ := token.Extra("id_token").(string)
+	claims, err := p.Parse(idToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims["iss"] != p.Issuer() || claims["aud"] != p.ClientID || claims["sub"] != "alice" || claims["nonce"] != "nonce123" ||
+		claims["acr"] != "mfa" || claims["name"] != "Alice" || claims["email_verified"] != true || claims["sid"] == "" {
+		t.Fatal(claims)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, p.Issuer()+EndpointUserInfo, nil)
+	token.SetAuthHeader(req)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `"email":"alice@example.com"`) {
+		t.Fatal(resp.StatusCode, string(body))
+	}
+
+	resp, err = http.PostForm(p.Issuer()+EndpointRevocation, url.Values{
+		"token":         {token.AccessToken},
+		"client_id":     {p.ClientID},
+		"client_secret": {p.ClientSecret},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp, err = http.DefaultClient.Do(req); err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") == "" {
+		t.Fatal(resp.StatusCode)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err = client.Get(p.Issuer() + EndpointEndSession + "?" + url.Values{
+		"id_token_hint":            {idToken},
+		"post_logout_redirect_uri": {"http://app.example/"},
+		"state":                    {"bye"},
+	}.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != "http://app.example/?state=bye" {
+		t.Fatal(resp.StatusCode, resp.Header.Get("Location"))
+	}
+	if _, err = cfg.TokenSource(t.Context(), &oauth2.Token{RefreshToken: token.RefreshToken}).Token(); !isOAuth2Error(err, "invalid_grant") {
+		t.Fatal(err)
+	}
+}
+
+func TestProviderRefreshTokenRotation(t *testing.T) {
+	p := newTestProvider(t)
+	p.RotateRefreshTokens = true
+	cfg := oauth2Config(p)
+	verifier := oauth2.GenerateVerifier()
+	token, err := cfg.Exchange(t.Context(), authorize(t, p, cfg, verifier), oauth2.VerifierOption(verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshed, err := cfg.TokenSource(t.Context(), &oauth2.Token{RefreshToken: token.RefreshToken}).Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshed.RefreshToken == token.RefreshToken || refreshed.AccessToken == token.AccessToken {
+		t.Fatal(refreshed)
+	}
+	// reusing the replaced token ends the login, so the newest token stops working too
+	if _, err = cfg.TokenSource(t.Context(), &oauth2.Token{RefreshToken: token.RefreshToken}).Token(); !isOAuth2Error(err, "invalid_grant") {
+		t.Fatal(err)
+	}
+	if _, err = cfg.TokenSource(t.Context(), &oauth2.Token{RefreshToken: refreshed.RefreshToken}).Token(); !isOAuth2Error(err, "invalid_grant") {
+		t.Fatal(err)
+	}
+
+	token, err = cfg.Exchange(t.Context(), authorize(t, p, cfg, verifier), oauth2.VerifierOption(verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := p.EndSessions("alice"); n != 1 {
+		t.Fatal(n)
+	}
+	if _, err = cfg.TokenSource(t.Context(), &oauth2.Token{RefreshToken: token.RefreshToken}).Token(); !isOAuth2Error(err, "invalid_grant") {
+		t.Fatal(err)
+	}
+}
+
+func TestProviderFail(t *testing.T) {
+	p := newTestProvider(t)
+	cfg := oauth2Config(p)
+	verifier := oauth2.GenerateVerifier()
+
+	p.Fail(EndpointToken, Failure{Status: http.StatusServiceUnavailable, Error: "temporarily_unavailable", Times: 1})
+	code := authorize(t, p, cfg, verifier)
+	var retrieveErr *oauth2.RetrieveError
+	if _, err := cfg.Exchange(t.Context(), code, oauth2.VerifierOption(verifier)); !errors.As(err, &retrieveErr) ||
+		retrieveErr.Response.StatusCode != http.StatusServiceUnavailable {
+		t.Fatal(err)
+	}
+	if _, err := cfg.Exchange(t.Context(), authorize(t, p, cfg, verifier), oauth2.VerifierOption(verifier)); err != nil {
+		t.Fatal(err)
+	}
+
+	p.Fail(EndpointAuthorize, Failure{Error: "login_required"})
+	for range 2 {
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		resp, err := client.Get(cfg.AuthCodeURL("state123", oauth2.SetAuthURLParam("prompt", "none")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		location, _ := url.Parse(resp.Header.Get("Location"))
+		if location.Query().Get("error") != "login_required" || location.Query().Get("state") != "state123" {
+			t.Fatal(location)
+		}
+	}
+	p.ClearFailures()
+	authorize(t, p, cfg, verifier)
+	if n := p.Requests(EndpointAuthorize); n != 5 {
+		t.Fatal(n)
+	}
+
+	p.Login("nobody")
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(cfg.AuthCodeURL("state123", oauth2.SetAuthURLParam("login_hint", "BOB@example.com")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if location, _ := url.Parse(resp.Header.Get("Location")); location.Query().Get("code") == "" {
+		t.Fatal(location)
+	}
+}
+
+func isOAuth2Error(err error, code string) bool {
+	var retrieveErr *oauth2.RetrieveError
+	return errors.As(err, &retrieveErr) && retrieveErr.ErrorCode == code
+}
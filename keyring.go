@@ -0,0 +1,207 @@
+package jawsauth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+)
+
+// ErrUnknownKeyID means sealed data names a key that is not in the KeyRing,
+// or that the primary key ID given to NewKeyRing has no key.
+var ErrUnknownKeyID = errors.New("unknown key id")
+
+// ErrKeyRingInvalidKey means a key or key ID given to NewKeyRing has an invalid length.
+var ErrKeyRingInvalidKey = errors.New("invalid key ring key")
+
+// ErrSealedData means sealed data is malformed or fails authentication.
+var ErrSealedData = errors.New("sealed data is invalid")
+
+// KeyRing seals and opens data using AES-GCM with a set of named keys.
+//
+// Data is always sealed with the primary key, and can be opened with any key
+// in the ring, so secrets can be rotated by adding a new primary key while
+// keeping the old ones until the data sealed with them has expired.
+type KeyRing struct {
+	primary string
+	aeads   map[string]cipher.AEAD
+}
+
+// NewKeyRing returns a KeyRing holding keys, indexed by key ID, that seals using
+// the key named primary. Keys must be 16, 24 or 32 bytes long, and key IDs
+// must be 1 to 255 bytes long. Returned failures match [ErrConfig].
+func NewKeyRing(primary string, keys map[string][]byte) (kr *KeyRing, err error) {
+	aeads := make(map[string]cipher.AEAD)
+	for _, id := range slices.Sorted(maps.Keys(keys)) {
+		if err == nil {
+			err = ErrKeyRingInvalidKey
+			if len(id) > 0 && len(id) < 256 {
+				if block, e := aes.NewCipher(keys[id]); e == nil {
+					aeads[id], err = cipher.NewGCM(block)
+				}
+			}
+		}
+	}
+	if err == nil {
+		err = ErrUnknownKeyID
+		if _, ok := aeads[primary]; ok {
+			kr = &KeyRing{primary: primary, aeads: aeads}
+			err = nil
+		}
+	}
+	if err != nil {
+		err = errConfig{field: "KeyRing", cause: err}
+	}
+	return
+}
+
+// Primary returns the ID of the key used for sealing.
+func (kr *KeyRing) Primary() string {
+	return kr.primary
+}
+
+// Seal encrypts and authenticates plaintext using the primary key.
+//
+// The result starts with the key ID so that Open can find the key after rotation.
+func (kr *KeyRing) Seal(plaintext []byte) (sealed []byte, err error) {
+	return kr.sealWith(plaintext, nil)
+}
+
+// sealWith is like Seal, but also authenticates the additional data ad,
+// which must be passed unchanged to openWith.
+func (kr *KeyRing) sealWith(plaintext, ad []byte) (sealed []byte, err error) {
+	aead := kr.aeads[kr.primary]
+	header := append([]byte{byte(len(kr.primary))}, kr.primary...)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err == nil {
+		sealed = aead.Seal(append(slices.Clip(header), nonce...), nonce, plaintext, append(slices.Clip(header), ad...))
+	}
+	return
+}
+
+// Open decrypts and authenticates data returned by Seal, and returns the
+// plaintext along with the ID of the key that sealed it.
+func (kr *KeyRing) Open(sealed []byte) (plaintext []byte, keyID string, err error) {
+	return kr.openWith(sealed, nil)
+}
+
+// openWith is like Open for data sealed by sealWith with additional data ad.
+func (kr *KeyRing) openWith(sealed, ad []byte) (plaintext []byte, keyID string, err error) {
+	err = ErrSealedData
+	if len(sealed) > 0 && len(sealed) > int(sealed[0]) {
+		header := sealed[:1+int(sealed[0])]
+		keyID = string(header[1:])
+		err = ErrUnknownKeyID
+		if aead, ok := kr.aeads[keyID]; ok {
+			err = ErrSealedData
+			if rest := sealed[len(header):]; len(rest) >= aead.NonceSize() {
+				nonce := rest[:aead.NonceSize()]
+				if plaintext, err = aead.Open(nil, nonce, rest[len(nonce):], append(slices.Clip(header), ad...)); err != nil {
+					err = ErrSealedData
+				}
+			}
+		}
+	}
+	return
+}
+
+// tokenSecrets are the TokenRecord fields that are sealed by a KeyRing.
+type tokenSecrets struct {
+	AccessToken  string         `json:"access_token,omitempty"`
+	TokenType    string         `json:"token_type,omitempty"`
+	RefreshToken string         `json:"refresh_token,omitempty"`
+	IDToken      string         `json:"id_token,omitempty"`
+	Claims       map[string]any `json:"claims,omitempty"`
+}
+
+// sealedRecordAD returns the additional data authenticated along with the
+// sealed part of rec stored under key: the key itself, Provider, the times and
+// RemoteIP, which are left in the clear. A record moved to another key or with any of
+// those fields changed fails to open.
+func sealedRecordAD(key string, rec *TokenRecord) []byte {
+	ad, _ := json.Marshal([]string{
+		key,
+		rec.Provider,
+		rec.Expiry.UTC().Format(time.RFC3339Nano),
+		rec.IDTokenExpiry.UTC().Format(time.RFC3339Nano),
+		rec.AuthTime.UTC().Format(time.RFC3339Nano),
+		rec.LoginTime.UTC().Format(time.RFC3339Nano),
+		rec.RemoteIP,
+	})
+	return ad
+}
+
+// Seal returns a copy of rec, to be stored under key, with the tokens and
+// claims sealed into Sealed using kr. Provider and the times are left in the
+// clear, but are authenticated together with key.
+func (rec *TokenRecord) Seal(kr *KeyRing, key string) (sealed *TokenRecord, err error) {
+	var data []byte
+	if data, err = json.Marshal(tokenSecrets{
+		AccessToken:  rec.AccessToken,
+		TokenType:    rec.TokenType,
+		RefreshToken: rec.RefreshToken,
+		IDToken:      rec.IDToken,
+		Claims:       rec.Claims,
+	}); err == nil {
+		var box []byte
+		if box, err = kr.sealWith(data, sealedRecordAD(key, rec)); err == nil {
+			sealed = &TokenRecord{
+				Provider:      rec.Provider,
+				Expiry:        rec.Expiry,
+				IDTokenExpiry: rec.IDTokenExpiry,
+				AuthTime:      rec.AuthTime,
+				LoginTime:     rec.LoginTime,
+				RemoteIP:      rec.RemoteIP,
+				Sealed:        box,
+			}
+		}
+	}
+	return
+}
+
+// Open returns a copy of rec, stored under key, with the tokens and claims
+// restored from Sealed using kr, along with the ID of the key that sealed them.
+//
+// Records that are not sealed, were sealed for another key, or whose clear
+// fields were changed fail with ErrSealedData.
+func (rec *TokenRecord) Open(kr *KeyRing, key string) (opened *TokenRecord, keyID string, err error) {
+	var data []byte
+	if data, keyID, err = kr.openWith(rec.Sealed, sealedRecordAD(key, rec)); err == nil {
+		var secrets tokenSecrets
+		if err = json.Unmarshal(data, &secrets); err == nil {
+			opened = &TokenRecord{
+				Provider:      rec.Provider,
+				AccessToken:   secrets.AccessToken,
+				TokenType:     secrets.TokenType,
+				RefreshToken:  secrets.RefreshToken,
+				Expiry:        rec.Expiry,
+				IDToken:       secrets.IDToken,
+				IDTokenExpiry: rec.IDTokenExpiry,
+				AuthTime:      rec.AuthTime,
+				LoginTime:     rec.LoginTime,
+				RemoteIP:      rec.RemoteIP,
+				Claims:        secrets.Claims,
+			}
+		}
+	}
+	return
+}
+
+// LogValue implements slog.LogValuer, leaving out the tokens and claims so
+// that records can be logged without leaking credentials.
+func (rec *TokenRecord) LogValue() slog.Value {
+	if rec == nil {
+		return slog.Value{}
+	}
+	return slog.GroupValue(
+		slog.String("provider", rec.Provider),
+		slog.Time("expiry", rec.Expiry),
+		slog.Time("id_token_expiry", rec.IDTokenExpiry),
+		slog.Bool("sealed", len(rec.Sealed) > 0),
+	)
+}
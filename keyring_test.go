@@ -0,0 +1,206 @@
+package jawsauth
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linkdata/jaws"
+)
+
+func TestNewKeyRing(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	if _, err := NewKeyRing("a", map[string][]byte{"a": key}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewKeyRing("b", map[string][]byte{"a": key}); !errors.Is(err, ErrUnknownKeyID) || !errors.Is(err, ErrConfig) {
+		t.Fatal(err)
+	}
+	if _, err := NewKeyRing("a", map[string][]byte{"a": key[:15]}); !errors.Is(err, ErrKeyRingInvalidKey) {
+		t.Fatal(err)
+	}
+	if _, err := NewKeyRing("", map[string][]byte{"": key}); !errors.Is(err, ErrKeyRingInvalidKey) {
+		t.Fatal(err)
+	}
+	if _, err := NewKeyRing(strings.Repeat("a", 256), map[string][]byte{strings.Repeat("a", 256): key}); !errors.Is(err, ErrKeyRingInvalidKey) {
+		t.Fatal(err)
+	}
+}
+
+func TestKeyRingSealOpen(t *testing.T) {
+	oldKey := bytes.Repeat([]byte{1}, 32)
+	newKey := bytes.Repeat([]byte{2}, 16)
+	oldRing, err := NewKeyRing("old", map[string][]byte{"old": oldKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := oldRing.Seal([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, []byte("secret")) {
+		t.Fatal("plaintext leaked")
+	}
+	again, _ := oldRing.Seal([]byte("secret"))
+	if bytes.Equal(sealed, again) {
+		t.Fatal("nonce reused")
+	}
+
+	ring, err := NewKeyRing("new", map[string][]byte{"old": oldKey, "new": newKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, keyID, err := ring.Open(sealed)
+	if err != nil || keyID != "old" || string(plaintext) != "secret" {
+		t.Fatal(string(plaintext), keyID, err)
+	}
+	if sealed, err = ring.Seal([]byte("rotated")); err != nil {
+		t.Fatal(err)
+	}
+	if plaintext, keyID, err = ring.Open(sealed); err != nil || keyID != "new" || string(plaintext) != "rotated" {
+		t.Fatal(string(plaintext), keyID, err)
+	}
+	if _, keyID, err = oldRing.Open(sealed); !errors.Is(err, ErrUnknownKeyID) || keyID != "new" {
+		t.Fatal(keyID, err)
+	}
+
+	tampered := bytes.Clone(sealed)
+	tampered[len(tampered)-1] ^= 1
+	for _, data := range [][]byte{nil, {9, 'x'}, sealed[:8], tampered} {
+		if plaintext, _, err = ring.Open(data); err == nil || plaintext != nil {
+			t.Fatal(data, err)
+		}
+	}
+	if _, _, err = ring.Open(tampered); !errors.Is(err, ErrSealedData) {
+		t.Fatal(err)
+	}
+}
+
+func TestTokenRecordSealOpen(t *testing.T) {
+	ring, err := NewKeyRing("k1", map[string][]byte{"k1": bytes.Repeat([]byte{3}, 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+	rec := &TokenRecord{
+		Provider:      "primary",
+		AccessToken:   "access",
+		TokenType:     "Bearer",
+		RefreshToken:  "refresh",
+		IDToken:       "idtoken",
+		IDTokenExpiry: expiry,
+		Claims:        map[string]any{"sub": "sub-123"},
+	}
+	sealed, err := rec.Seal(ring, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sealed.AccessToken != "" || sealed.RefreshToken != "" || sealed.IDToken != "" || sealed.Claims != nil || len(sealed.Sealed) == 0 {
+		t.Fatal(sealed)
+	}
+	if sealed.Provider != "primary" || !sealed.IDTokenExpiry.Equal(expiry) {
+		t.Fatal(sealed)
+	}
+	opened, keyID, err := sealed.Open(ring, "key")
+	if err != nil || keyID != "k1" {
+		t.Fatal(keyID, err)
+	}
+	if opened.AccessToken != "access" || opened.TokenType != "Bearer" || opened.RefreshToken != "refresh" ||
+		opened.IDToken != "idtoken" || opened.Claims["sub"] != "sub-123" || len(opened.Sealed) != 0 {
+		t.Fatal(opened)
+	}
+	if _, _, err = rec.Open(ring, "key"); !errors.Is(err, ErrSealedData) {
+		t.Fatal(err)
+	}
+	if _, _, err = sealed.Open(ring, "other"); !errors.Is(err, ErrSealedData) {
+		t.Fatal(err)
+	}
+	for _, tamper := range []func(rec *TokenRecord){
+		func(rec *TokenRecord) { rec.Provider = "other" },
+		func(rec *TokenRecord) { rec.Expiry = expiry },
+		func(rec *TokenRecord) { rec.IDTokenExpiry = expiry.Add(time.Hour) },
+		func(rec *TokenRecord) { rec.AuthTime = expiry },
+	} {
+		tampered := cloneTokenRecord(sealed)
+		tamper(tampered)
+		if _, _, err = tampered.Open(ring, "key"); !errors.Is(err, ErrSealedData) {
+			t.Fatal(tampered, err)
+		}
+	}
+
+	store, err := NewFileTokenStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed.IDTokenExpiry = sealed.IDTokenExpiry.In(time.FixedZone("test", 3600))
+	if _, _, err = sealed.Open(ring, "key"); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Save("key", sealed); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := store.Load("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = stored.Open(ring, "key"); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	slog.New(slog.NewTextHandler(&buf, nil)).Info("record", "rec", rec)
+	if s := buf.String(); strings.Contains(s, "access") || strings.Contains(s, "refresh") || !strings.Contains(s, "rec.provider=primary") {
+		t.Fatal(s)
+	}
+}
+
+func TestServerKeyRingTokenStore(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	oldKey := bytes.Repeat([]byte{4}, 32)
+	store := NewMemoryTokenStore()
+	srv := newWrapperTestServer(jw, "https://issuer.example")
+	srv.TokenStore = store
+	if srv.KeyRing, err = NewKeyRing("old", map[string][]byte{"old": oldKey}); err != nil {
+		t.Fatal(err)
+	}
+	rec := &TokenRecord{AccessToken: "access", IDTokenExpiry: time.Now().Add(time.Hour), Claims: map[string]any{"sub": "sub-123"}}
+	if err = srv.saveTokenRecord("key", rec); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := store.Load("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.AccessToken != "" || stored.Claims != nil || len(stored.Sealed) == 0 {
+		t.Fatal(stored)
+	}
+
+	if srv.KeyRing, err = NewKeyRing("new", map[string][]byte{"old": oldKey, "new": bytes.Repeat([]byte{5}, 32)}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := srv.loadTokenRecord("key")
+	if err != nil || got.AccessToken != "access" || got.Claims["sub"] != "sub-123" {
+		t.Fatal(got, err)
+	}
+	if stored, err = store.Load("key"); err != nil {
+		t.Fatal(err)
+	}
+	if _, keyID, err := stored.Open(srv.KeyRing, "key"); err != nil || keyID != "new" {
+		t.Fatal(keyID, err)
+	}
+
+	if srv.KeyRing, err = NewKeyRing("other", map[string][]byte{"other": bytes.Repeat([]byte{6}, 32)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = srv.loadTokenRecord("key"); !errors.Is(err, ErrUnknownKeyID) {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,73 @@
+package jawsauth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/linkdata/jaws"
+)
+
+const oauth2LastActivityKey = "oauth2lastactivity"
+const oauth2LoginTimeKey = "oauth2logintime"
+
+// ErrSessionIdle means the session was logged out after IdleTimeout without activity.
+var ErrSessionIdle = errors.New("session idle timeout")
+
+// ErrSessionLifetime means the session was logged out MaxLifetime after login.
+var ErrSessionLifetime = errors.New("session lifetime exceeded")
+
+// Touch records activity for the authenticated session, postponing its
+// IdleTimeout. Requests through Wrap and new JaWS requests are recorded
+// automatically, and a session that still has live JaWS requests, such as a
+// page connected over websocket, is not logged out as idle (see touchLive).
+// Call Touch to count other activity.
+func (srv *Server) Touch(sess *jaws.Session) {
+	if srv != nil && sess != nil && srv.IdleTimeout > 0 && sess.Get(srv.SessionKey) != nil {
+		sess.Set(oauth2LastActivityKey, srv.now())
+	}
+}
+
+// touchLive records activity for the session if it has live JaWS requests,
+// so that open pages are kept signed in while their websocket is connected.
+func (srv *Server) touchLive(sess *jaws.Session) {
+	if srv.IdleTimeout > 0 && len(sess.Requests()) > 0 {
+		srv.Touch(sess)
+	}
+}
+
+// sessionDeadline returns the earliest time the session must be logged out
+// due to IdleTimeout or MaxLifetime, or the zero time if neither applies.
+func (srv *Server) sessionDeadline(sess *jaws.Session) (deadline time.Time) {
+	if srv.IdleTimeout > 0 {
+		if lastActivity, ok := sess.Get(oauth2LastActivityKey).(time.Time); ok {
+			deadline = lastActivity.Add(srv.IdleTimeout)
+		}
+	}
+	if srv.MaxLifetime > 0 {
+		if loginTime, ok := sess.Get(oauth2LoginTimeKey).(time.Time); ok {
+			if end := loginTime.Add(srv.MaxLifetime); deadline.IsZero() || end.Before(deadline) {
+				deadline = end
+			}
+		}
+	}
+	return
+}
+
+// sessionExpired returns ErrSessionIdle or ErrSessionLifetime if the session
+// has reached IdleTimeout or MaxLifetime at now.
+//
+// MaxLifetime is measured from the original login, which unlike the auth time
+// used by Revoker is kept across silent re-authentication and restarts.
+func (srv *Server) sessionExpired(sess *jaws.Session, now time.Time) (err error) {
+	if srv.MaxLifetime > 0 {
+		if loginTime, ok := sess.Get(oauth2LoginTimeKey).(time.Time); ok && !now.Before(loginTime.Add(srv.MaxLifetime)) {
+			err = ErrSessionLifetime
+		}
+	}
+	if err == nil && srv.IdleTimeout > 0 {
+		if lastActivity, ok := sess.Get(oauth2LastActivityKey).(time.Time); ok && !now.Before(lastActivity.Add(srv.IdleTimeout)) {
+			err = ErrSessionIdle
+		}
+	}
+	return
+}
@@ -0,0 +1,175 @@
+package jawsauth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/linkdata/jaws"
+)
+
+func TestServerSessionExpired(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	srv := newWrapperTestServer(jw, "https://issuer.example")
+	sess := jw.NewSession(nil, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+	now := time.Now()
+	sess.Set(oauth2LoginTimeKey, now.Add(-2*time.Hour))
+	sess.Set(oauth2LastActivityKey, now.Add(-10*time.Minute))
+	if err = srv.sessionExpired(sess, now); err != nil || !srv.sessionDeadline(sess).IsZero() {
+		t.Fatal(err, srv.sessionDeadline(sess))
+	}
+
+	srv.IdleTimeout = 15 * time.Minute
+	if err = srv.sessionExpired(sess, now); err != nil {
+		t.Fatal(err)
+	}
+	if deadline := srv.sessionDeadline(sess); !deadline.Equal(now.Add(5 * time.Minute)) {
+		t.Fatal(deadline)
+	}
+	if err = srv.sessionExpired(sess, now.Add(5*time.Minute)); !errors.Is(err, ErrSessionIdle) {
+		t.Fatal(err)
+	}
+
+	srv.MaxLifetime = 2*time.Hour + time.Minute
+	if deadline := srv.sessionDeadline(sess); !deadline.Equal(now.Add(time.Minute)) {
+		t.Fatal(deadline)
+	}
+	if err = srv.sessionExpired(sess, now.Add(5*time.Minute)); !errors.Is(err, ErrSessionLifetime) {
+		t.Fatal(err)
+	}
+	if got := errorDebugClasses(err); len(got) != 1 || got[0] != "session_lifetime" {
+		t.Fatal(got)
+	}
+
+	srv.Touch(sess)
+	if lastActivity, _ := sess.Get(oauth2LastActivityKey).(time.Time); lastActivity.After(now) {
+		t.Fatal("touched unauthenticated session")
+	}
+	sess.Set(srv.SessionKey, map[string]any{"sub": "sub-123"})
+	srv.Touch(sess)
+	if lastActivity, _ := sess.Get(oauth2LastActivityKey).(time.Time); !lastActivity.After(now) {
+		t.Fatal(lastActivity)
+	}
+}
+
+func TestWrapIdleTimeout(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	srv := newWrapperTestServer(jw, "https://issuer.example")
+	srv.IdleTimeout = time.Minute
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/protected", nil)
+	sess := jw.NewSession(httptest.NewRecorder(), req)
+	sess.Set(srv.SessionKey, map[string]any{"sub": "sub-123"})
+	sess.Set(oauth2IDTokenExpiryKey, time.Now().Add(time.Hour))
+	sess.Set(oauth2LastActivityKey, time.Now().Add(-59*time.Second))
+
+	h := srv.Wrap(testStatusHandler{statusCode: http.StatusNoContent})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatal(rec.Code)
+	}
+	if lastActivity, _ := sess.Get(oauth2LastActivityKey).(time.Time); time.Since(lastActivity) > time.Second {
+		t.Fatal(lastActivity)
+	}
+
+	sess.Set(oauth2LastActivityKey, time.Now().Add(-time.Minute))
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusFound || sess.Get(srv.SessionKey) != nil || sess.Get(oauth2LastActivityKey) != nil {
+		t.Fatal(rec.Code)
+	}
+}
+
+func TestAuthTimerSessionLimits(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	factory := &testAuthTimerFactory{}
+	srv := newWrapperTestServer(jw, "https://issuer.example")
+	srv.Clock = factory
+	srv.IdleTimeout = time.Minute
+	srv.MaxLifetime = time.Hour
+	var loggedOut int
+	srv.LogoutEvent = func(*jaws.Session, *http.Request) { loggedOut++ }
+
+	sess, failedErr := runLoginCallback(t, jw, srv, nil)
+	if failedErr != nil {
+		t.Fatal(failedErr)
+	}
+	timer := factory.timer(factory.len() - 1)
+	if timer.delay > time.Minute || timer.delay < 50*time.Second {
+		t.Fatal(timer.delay)
+	}
+
+	// activity since scheduling postpones the idle deadline
+	sess.Set(oauth2LastActivityKey, time.Now().Add(30*time.Second))
+	n := factory.len()
+	timer.fire()
+	if factory.len() != n+1 || sess.Get(srv.SessionKey) == nil {
+		t.Fatal(factory.len(), n)
+	}
+	if delay := factory.timer(n).delay; delay < 80*time.Second {
+		t.Fatal(delay)
+	}
+
+	sess.Set(oauth2LastActivityKey, time.Now().Add(-time.Minute))
+	factory.timer(n).fire()
+	if sess.Get(srv.SessionKey) != nil || loggedOut != 1 {
+		t.Fatal(loggedOut)
+	}
+
+	if sess, failedErr = runLoginCallback(t, jw, srv, nil); failedErr != nil {
+		t.Fatal(failedErr)
+	}
+	sess.Set(oauth2LoginTimeKey, time.Now().Add(-time.Hour))
+	factory.timer(factory.len() - 1).fire()
+	if sess.Get(srv.SessionKey) != nil || loggedOut != 2 {
+		t.Fatal(loggedOut)
+	}
+}
+
+func TestAuthTimerIdleLiveRequests(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	factory := &testAuthTimerFactory{}
+	srv := newWrapperTestServer(jw, "https://issuer.example")
+	srv.Clock = factory
+	srv.IdleTimeout = time.Minute
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	sess := jw.NewSession(httptest.NewRecorder(), req)
+	sess.Set(srv.SessionKey, map[string]any{"sub": "sub-123"})
+	sess.Set(oauth2IDTokenExpiryKey, time.Now().Add(time.Hour))
+	sess.Set(oauth2LastActivityKey, time.Now())
+	srv.scheduleSessionAuthTimer(sess, time.Now().Add(time.Hour))
+
+	// a page still connected to JaWS counts as activity
+	_ = jw.NewRequest(req)
+	sess.Set(oauth2LastActivityKey, time.Now().Add(-time.Minute))
+	n := factory.len()
+	factory.timer(n - 1).fire()
+	if sess.Get(srv.SessionKey) == nil || factory.len() != n+1 {
+		t.Fatal(factory.len(), n)
+	}
+	if lastActivity, _ := sess.Get(oauth2LastActivityKey).(time.Time); time.Since(lastActivity) > time.Second {
+		t.Fatal(lastActivity)
+	}
+}
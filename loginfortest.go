@@ -0,0 +1,45 @@
+package jawsauth
+
+import (
+	"context"
+	"maps"
+	"time"
+
+	"github.com/linkdata/jaws"
+	"golang.org/x/oauth2"
+)
+
+// LoginForTest authenticates sess as the user described by claims without an
+// OAuth2 round trip. It stores the claims, email, expiry and token source in
+// the session exactly as a successful login does, applying the same login
+// checks (such as RequireEmailVerified and MaxSessionsPerUser) and scheduling
+// the auth-refresh timer. LoginEvent is not called and UserInfo is not fetched.
+//
+// If expiry is zero, the auth expires in one hour. If tokenSource is nil, a
+// static token source returning a fake access token is used; it cannot be
+// refreshed, so the auth is cleared when it expires.
+//
+// It is intended for handler tests and should not be used in production code.
+func (srv *Server) LoginForTest(sess *jaws.Session, claims map[string]any, expiry time.Time, tokenSource oauth2.TokenSource) (err error) {
+	err = ErrOAuth2NotConfigured
+	if srv != nil {
+		if expiry.IsZero() {
+			expiry = srv.now().Add(time.Hour)
+		}
+		if tokenSource == nil {
+			tokenSource = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "jawsauth-test", TokenType: "Bearer", Expiry: expiry})
+		}
+		if claims = maps.Clone(claims); claims == nil {
+			claims = make(map[string]any)
+		}
+		if _, ok := claims["exp"]; !ok {
+			claims["exp"] = float64(expiry.Unix())
+		}
+		p := srv.defaultProvider()
+		p.userinfoUrl = ""
+		if err = srv.storeSessionAuthClaims(context.Background(), sess, p, claims, tokenSource, expiry, nil); err == nil {
+			rememberRefreshToken(sess, nil)
+		}
+	}
+	return
+}
@@ -0,0 +1,71 @@
+package jawsauth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/linkdata/jaws"
+)
+
+func TestServerLoginForTest(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	var nilServer *Server
+	if err = nilServer.LoginForTest(nil, nil, time.Time{}, nil); !errors.Is(err, ErrOAuth2NotConfigured) {
+		t.Fatal(err)
+	}
+
+	factory := &testAuthTimerFactory{}
+	srv := newTimerTestServer(t, jw, "https://issuer.example", factory)
+	srv.userinfoUrl = "http://userinfo.invalid/"
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/protected", nil)
+	sess := jw.NewSession(httptest.NewRecorder(), req)
+	claims := map[string]any{"sub": "sub-123", "email": "User@Example.com", "email_verified": true}
+	if err = srv.LoginForTest(sess, claims, time.Time{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := claims["exp"]; ok {
+		t.Fatal("caller claims modified")
+	}
+	if email, _ := sess.Get(srv.SessionEmailKey).(string); email != "user@example.com" {
+		t.Fatal(email)
+	}
+	if verified, _ := sess.Get(srv.SessionEmailVerifiedKey).(bool); !verified {
+		t.Fatal(verified)
+	}
+	if expiry, _ := sess.Get(oauth2IDTokenExpiryKey).(time.Time); time.Until(expiry) < 59*time.Minute {
+		t.Fatal(expiry)
+	}
+	if factory.len() != 1 {
+		t.Fatal(factory.len())
+	}
+
+	rec := httptest.NewRecorder()
+	srv.Wrap(testStatusHandler{statusCode: http.StatusNoContent}).ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatal(rec.Code)
+	}
+
+	// the fake token source cannot refresh, so the auth ends at expiry
+	sess.Set(oauth2IDTokenExpiryKey, time.Now().Add(-time.Second))
+	factory.timer(0).fire()
+	if sess.Get(srv.SessionKey) != nil {
+		t.Fatal("auth not cleared")
+	}
+
+	srv.RequireEmailVerified = true
+	claims["email_verified"] = false
+	if err = srv.LoginForTest(sess, claims, time.Now().Add(time.Minute), nil); !errors.Is(err, ErrEmailNotVerified) {
+		t.Fatal(err)
+	}
+	if sess.Get(srv.SessionKey) != nil {
+		t.Fatal("unverified login stored")
+	}
+}
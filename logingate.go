@@ -0,0 +1,41 @@
+package jawsauth
+
+import (
+	"errors"
+	"slices"
+	"strings"
+)
+
+// ErrEmailNotVerified means a login was rejected because RequireEmailVerified
+// is set and the email_verified claim was not true.
+var ErrEmailNotVerified = errors.New("email not verified")
+
+// ErrDomainNotAllowed means a login was rejected because its email domain is not
+// in AllowedEmailDomains or its "hd" claim is not in AllowedHostedDomains.
+var ErrDomainNotAllowed = errors.New("domain not allowed")
+
+// domainAllowed returns true if domain case-insensitively equals one of allowed,
+// ignoring any leading "@" in allowed.
+func domainAllowed(allowed []string, domain string) bool {
+	return domain != "" && slices.ContainsFunc(allowed, func(s string) bool {
+		return strings.EqualFold(strings.TrimPrefix(strings.TrimSpace(s), "@"), domain)
+	})
+}
+
+// checkLoginClaims returns an error if the verified claims of a login or
+// refresh must be rejected before they are stored in the session.
+func (srv *Server) checkLoginClaims(claims map[string]any) (err error) {
+	if srv.RequireEmailVerified && !extractEmailVerified(claims) {
+		err = ErrEmailNotVerified
+	} else if len(srv.AllowedEmailDomains) > 0 {
+		if _, domain, _ := strings.Cut(claimEmail(claims), "@"); !domainAllowed(srv.AllowedEmailDomains, domain) {
+			err = ErrDomainNotAllowed
+		}
+	}
+	if err == nil && len(srv.AllowedHostedDomains) > 0 {
+		if hd, _ := claims["hd"].(string); !domainAllowed(srv.AllowedHostedDomains, hd) {
+			err = ErrDomainNotAllowed
+		}
+	}
+	return
+}
@@ -0,0 +1,170 @@
+package jawsauth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/linkdata/jaws"
+	"golang.org/x/oauth2"
+)
+
+// runLoginCallback completes a login on srv whose id_token has the given claims
+// added to the required ones, and returns the session and the error passed to LoginFailed.
+func runLoginCallback(t *testing.T, jw *jaws.Jaws, srv *Server, extra map[string]any) (sess *jaws.Session, failedErr error) {
+	t.Helper()
+	const issuer = "https://issuer.example"
+	claims := map[string]any{
+		"iss":   issuer,
+		"aud":   "client",
+		"exp":   time.Now().Add(10 * time.Minute).Unix(),
+		"nonce": "nonce123",
+		"sub":   "sub-123",
+	}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	idToken := makeIDToken(t, claims)
+	provider := httptest.NewServer(http.HandlerFunc(func(hw http.ResponseWriter, hr *http.Request) {
+		hw.Header().Set("Content-Type", "application/json")
+		_, _ = hw.Write([]byte(`{"access_token":"token123","token_type":"Bearer","expires_in":3600,"id_token":"` + idToken + `"}`))
+	}))
+	t.Cleanup(provider.Close)
+
+	srv.oauth2cfg = &oauth2.Config{
+		ClientID:    "client",
+		Endpoint:    oauth2.Endpoint{AuthURL: provider.URL + "/auth", TokenURL: provider.URL + "/token"},
+		RedirectURL: "http://example.com/oauth2/callback",
+	}
+	srv.idTokenVerifier = oidc.NewVerifier(issuer, passthroughKeySet{}, &oidc.Config{ClientID: "client"})
+	srv.LoginFailed = func(hw http.ResponseWriter, hr *http.Request, httpCode int, err error, email string) bool {
+		failedErr = err
+		return false
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/oauth2/callback?state=state123&code=code123", nil)
+	sess = jw.NewSession(rec, req)
+	sess.Set(oauth2StateKey, "state123")
+	sess.Set(oauth2PKCEVerifierKey, oauth2.GenerateVerifier())
+	sess.Set(oauth2NonceKey, "nonce123")
+	srv.HandleAuthResponse(rec, req)
+	return
+}
+
+func TestRequireEmailVerified(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	srv := newWrapperTestServer(jw, "https://issuer.example")
+	srv.RequireEmailVerified = true
+	sess, failedErr := runLoginCallback(t, jw, srv, map[string]any{"email": "user@example.com", "email_verified": false})
+	if !errors.Is(failedErr, ErrEmailNotVerified) {
+		t.Fatal(failedErr)
+	}
+	if v := sess.Get(srv.SessionKey); v != nil {
+		t.Fatal(v)
+	}
+	if got := errorDebugClasses(failedErr); len(got) != 1 || got[0] != "email_not_verified" {
+		t.Fatal(got)
+	}
+
+	sess, failedErr = runLoginCallback(t, jw, srv, map[string]any{"email": "user@example.com", "email_verified": true})
+	if failedErr != nil {
+		t.Fatal(failedErr)
+	}
+	if email, _ := sess.Get(srv.SessionEmailKey).(string); email != "user@example.com" {
+		t.Fatal(email)
+	}
+}
+
+func TestAdminEmailVerified(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	srv := newWrapperTestServer(jw, "https://issuer.example")
+	srv.SetAdmins([]string{"admin@example.com"})
+	if !srv.isVerifiedAdmin("admin@example.com", false) {
+		t.Fatal("verification should be ignored by default")
+	}
+	srv.AdminEmailVerified = true
+	if srv.isVerifiedAdmin("admin@example.com", false) || !srv.isVerifiedAdmin("admin@example.com", true) {
+		t.Fatal("verification not required")
+	}
+	if !srv.IsAdmin("admin@example.com") {
+		t.Fatal("IsAdmin should only check the admin list")
+	}
+	srv.AdminEmailVerified = false
+	srv.RequireEmailVerified = true
+	if srv.isVerifiedAdmin("admin@example.com", false) || !srv.isVerifiedAdmin("admin@example.com", true) {
+		t.Fatal("verification not required")
+	}
+	if !(*Server)(nil).isVerifiedAdmin("anyone@example.com", false) {
+		t.Fatal("nil server should follow IsAdmin")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	sess := jw.NewSession(httptest.NewRecorder(), req)
+	sess.Set(srv.SessionEmailKey, "admin@example.com")
+	auth := &JawsAuth{server: srv, sess: sess}
+	if auth.IsAdmin() {
+		t.Fatal("unverified admin accepted")
+	}
+	sess.Set(srv.SessionEmailVerifiedKey, true)
+	if !auth.IsAdmin() {
+		t.Fatal("verified admin rejected")
+	}
+
+	allowed, err := srv.AdminPolicy().Allow(t.Context(), map[string]any{"email": "admin@example.com"}, nil)
+	if allowed || err != nil {
+		t.Fatal(allowed, err)
+	}
+}
+
+func TestAllowedDomains(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	srv := newWrapperTestServer(jw, "https://issuer.example")
+	srv.AllowedEmailDomains = []string{"@Corp.com", "example.org"}
+	tests := []struct {
+		name  string
+		hd    []string
+		extra map[string]any
+		want  error
+	}{
+		{"allowed", nil, map[string]any{"email": "user@corp.com"}, nil},
+		{"allowedCase", nil, map[string]any{"email": "User@EXAMPLE.org"}, nil},
+		{"otherDomain", nil, map[string]any{"email": "user@evil.com"}, ErrDomainNotAllowed},
+		{"subdomain", nil, map[string]any{"email": "user@sub.corp.com"}, ErrDomainNotAllowed},
+		{"missingEmail", nil, map[string]any{}, ErrDomainNotAllowed},
+		{"hd", []string{"corp.com"}, map[string]any{"email": "user@corp.com", "hd": "corp.com"}, nil},
+		{"missingHd", []string{"corp.com"}, map[string]any{"email": "user@corp.com"}, ErrDomainNotAllowed},
+		{"otherHd", []string{"corp.com"}, map[string]any{"email": "user@corp.com", "hd": "example.org"}, ErrDomainNotAllowed},
+	}
+	for _, tt := range tests {
+		srv.AllowedHostedDomains = tt.hd
+		sess, failedErr := runLoginCallback(t, jw, srv, tt.extra)
+		if !errors.Is(failedErr, tt.want) || (tt.want == nil) != (failedErr == nil) {
+			t.Errorf("%s: got %v", tt.name, failedErr)
+		}
+		if stored := sess.Get(srv.SessionKey) != nil; stored != (tt.want == nil) {
+			t.Errorf("%s: stored %v", tt.name, stored)
+		}
+	}
+	if got := errorDebugClasses(ErrDomainNotAllowed); len(got) != 1 || got[0] != "domain_not_allowed" {
+		t.Fatal(got)
+	}
+}
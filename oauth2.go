@@ -26,6 +26,7 @@ const oauth2StateKey = "oauth2state"
 const oauth2PKCEVerifierKey = "oauth2pkceverifier"
 const oauth2NonceKey = "oauth2nonce"
 const oauth2IDTokenExpiryKey = "oauth2idtokenexpiry" // #nosec G101
+const oauth2SidKey = "oauth2sid"
 
 func normalizeHost(hostport string) (normalized string) {
 	normalized = strings.TrimSpace(hostport)
@@ -86,50 +87,97 @@ func (srv *Server) begin(hr *http.Request) (oauth2cfg *oauth2.Config, location s
 //
 // For GET requests it generates and stores the state, nonce and PKCE verifier in the
 // session, then responds with a 302 redirect to the provider's authorization URL.
-// Non-GET requests receive 405.
+// If more than one provider is configured (see AddProvider), the provider is selected
+// by the "provider" query parameter; without it the user is sent to ProviderChooser
+// or shown a built-in provider chooser page. Non-GET requests receive 405.
 func (srv *Server) HandleLogin(hw http.ResponseWriter, hr *http.Request) {
-	statusCode := http.StatusMethodNotAllowed
 	if hr.Method == http.MethodGet {
-		oauth2cfg, location := srv.begin(hr)
-		if oauth2cfg != nil {
-			sess := srv.Jaws.GetSession(hr)
-			if sess == nil {
-				sess = srv.Jaws.NewSession(hw, hr)
-			}
-			if sess != nil {
-				authOptions := append([]oauth2.AuthCodeOption{}, srv.Options...)
-				state := randomHexString()
-				sess.Set(oauth2StateKey, state)
-				nonce := randomHexString()
-				sess.Set(oauth2NonceKey, nonce)
-				authOptions = append(authOptions, oidc.Nonce(nonce))
-				verifier := oauth2.GenerateVerifier()
-				sess.Set(oauth2PKCEVerifierKey, verifier)
-				authOptions = append(authOptions, oauth2.S256ChallengeOption(verifier))
-				sess.Set(oauth2ReferrerKey, location)
-				location = oauth2cfg.AuthCodeURL(state, authOptions...)
-			}
+		_, location := srv.begin(hr)
+		if p := srv.chooseProvider(hr); p != nil {
+			srv.startLogin(hw, hr, p, location)
+		} else {
+			srv.writeProviderChooser(hw, hr)
 		}
-		hw.Header().Set("Location", location)
-		statusCode = http.StatusFound
+		return
 	}
 	SetHeaders(hw, srv.ishttps)
-	hw.WriteHeader(statusCode)
+	hw.WriteHeader(http.StatusMethodNotAllowed)
+}
+
+// startLogin stores the OAuth2 flow state in the session and redirects to the
+// authorization URL of p, with extra added to the authorization request. After
+// a successful login, the user is redirected to location.
+func (srv *Server) startLogin(hw http.ResponseWriter, hr *http.Request, p *provider, location string, extra ...oauth2.AuthCodeOption) {
+	if p != nil && p.oauth2cfg != nil {
+		oauth2cfg := p.oauth2cfg
+		sess := srv.Jaws.GetSession(hr)
+		if sess == nil {
+			sess = srv.Jaws.NewSession(hw, hr)
+		}
+		if sess != nil {
+			authOptions := append([]oauth2.AuthCodeOption{}, srv.Options...)
+			state := randomHexString()
+			sess.Set(oauth2StateKey, state)
+			nonce := randomHexString()
+			sess.Set(oauth2NonceKey, nonce)
+			authOptions = append(authOptions, oidc.Nonce(nonce))
+			verifier := oauth2.GenerateVerifier()
+			sess.Set(oauth2PKCEVerifierKey, verifier)
+			authOptions = append(authOptions, oauth2.S256ChallengeOption(verifier))
+			authOptions = append(authOptions, extra...)
+			sess.Set(oauth2ReferrerKey, location)
+			sess.Set(oauth2PendingProviderKey, p.name)
+			location = oauth2cfg.AuthCodeURL(state, authOptions...)
+		}
+	}
+	hw.Header().Set("Location", location)
+	SetHeaders(hw, srv.ishttps)
+	hw.WriteHeader(http.StatusFound)
 }
 
 // HandleLogout clears the session's stored authentication and redirects.
 //
 // For GET requests it clears the auth (firing LogoutEvent if set) and responds with a
-// 302 redirect back to the sanitized referrer (or "/"). Non-GET requests receive 405.
+// 302 redirect back to LogoutRedirect if set, otherwise the sanitized referrer (or "/").
+//
+// If RPInitiatedLogout is set and the provider has an end_session_endpoint, the
+// redirect instead goes to the provider with id_token_hint, client_id, state and
+// post_logout_redirect_uri set to this endpoint. When the provider redirects back,
+// the state is verified before the final redirect; a missing or wrong state
+// clears any local auth and responds with 400. Non-GET requests receive 405.
 func (srv *Server) HandleLogout(hw http.ResponseWriter, hr *http.Request) {
 	statusCode := http.StatusMethodNotAllowed
+	var err error
 	if hr.Method == http.MethodGet {
 		_, location := srv.begin(hr)
-		if sess := srv.Jaws.GetSession(hr); sess != nil {
-			srv.clearSessionAuth(sess, hr, true, false, nil)
+		if srv.LogoutRedirect != "" {
+			location = sanitizeRedirectTarget(hr.Host, srv.LogoutRedirect)
 		}
-		hw.Header().Set("Location", location)
 		statusCode = http.StatusFound
+		srv.clearTokenStoreCookie(hw)
+		if sess := srv.Jaws.GetSession(hr); sess != nil {
+			if gotState := hr.FormValue("state"); gotState != "" { // #nosec G120
+				var returnLocation string
+				if returnLocation, err = srv.endSessionReturn(sess, gotState); err == nil {
+					location = sanitizeRedirectTarget(hr.Host, returnLocation)
+				} else {
+					srv.clearSessionAuth(sess, hr, true, false, nil)
+					statusCode = http.StatusBadRequest
+				}
+			} else {
+				p := srv.sessionProvider(sess)
+				idTokenHint := srv.sessionIDTokenHint(sess)
+				srv.clearSessionAuth(sess, hr, true, false, nil)
+				location = srv.endSessionLocation(sess, p, idTokenHint, location)
+			}
+		}
+		if err == nil {
+			hw.Header().Set("Location", location)
+		}
+	}
+	if err != nil {
+		srv.writeResult(hw, statusCode, err, nil)
+		return
 	}
 	SetHeaders(hw, srv.ishttps)
 	hw.WriteHeader(statusCode)
@@ -197,7 +245,8 @@ func mergeMissingClaims(dst, src map[string]any) {
 	}
 }
 
-func (srv *Server) extractEmail(claims map[string]any) (sessEmailValue any) {
+// claimEmail returns the normalized email address found in claims, or an empty string.
+func claimEmail(claims map[string]any) (email string) {
 	for _, k := range []string{"email", "mail", "public_email"} {
 		if s, ok := claims[k].(string); ok {
 			if s = strings.TrimSpace(s); s != "" {
@@ -207,6 +256,13 @@ func (srv *Server) extractEmail(claims map[string]any) (sessEmailValue any) {
 			}
 		}
 	}
+	return
+}
+
+func (srv *Server) extractEmail(claims map[string]any) (sessEmailValue any) {
+	if email := claimEmail(claims); email != "" {
+		return email
+	}
 	if l := srv.Jaws.Logger; l != nil {
 		l.Warn("jawsauth: no email found", "userinfo", claims)
 	}
@@ -254,25 +310,33 @@ func (srv *Server) fetchUserInfo(ctx context.Context, userinfoURL string, tokenS
 //
 // For GET requests it validates the state, exchanges the authorization code using the
 // stored PKCE verifier, verifies the id_token and its nonce, stores the verified claims
-// in the session, and invokes LoginEvent on success or LoginFailed on failure. Non-GET
-// requests receive 405.
+// in the session, and invokes LoginEvent on success or LoginFailed on failure. The
+// provider is the one the login was started with; when more than one is configured,
+// the callback must arrive on that provider's callback path. If a silent
+// re-authentication (see SilentReauth) fails because the provider requires user
+// interaction, an interactive login is started instead. Non-GET requests
+// receive 405.
 func (srv *Server) HandleAuthResponse(hw http.ResponseWriter, hr *http.Request) {
 	statusCode := http.StatusMethodNotAllowed
 	err := ErrOAuth2Callback
 
 	if hr.Method == http.MethodGet {
-		oauth2Config, location := srv.begin(hr)
+		_, location := srv.begin(hr)
 		var sessValue any
 		var sessEmail string
-		authctx := srv.oauth2Context(hr.Context())
+		var silent bool
+		p := srv.defaultProvider()
 		sess := srv.Jaws.GetSession(hr)
 		if sess != nil {
 			sessEmail, _ = sess.Get(srv.SessionEmailKey).(string)
+			p = srv.pendingProvider(sess)
 		}
+		authctx := srv.providerContext(hr.Context(), p)
 		err = ErrOAuth2NotConfigured
 		statusCode = http.StatusInternalServerError
 
-		if oauth2Config != nil {
+		if p != nil && p.oauth2cfg != nil {
+			oauth2Config := p.oauth2cfg
 			err = ErrOAuth2MissingSession
 			statusCode = http.StatusBadRequest
 			if sess != nil {
@@ -280,14 +344,21 @@ func (srv *Server) HandleAuthResponse(hw http.ResponseWriter, hr *http.Request)
 				wantState, _ := sess.Get(oauth2StateKey).(string)
 				verifier, _ := sess.Get(oauth2PKCEVerifierKey).(string)
 				wantNonce, _ := sess.Get(oauth2NonceKey).(string)
+				silent, _ = sess.Get(oauth2SilentPendingKey).(bool)
+				sess.Set(oauth2SilentPendingKey, nil)
 				sess.Set(oauth2StateKey, nil)
 				sess.Set(oauth2PKCEVerifierKey, nil)
 				sess.Set(oauth2NonceKey, nil)
+				sess.Set(oauth2PendingProviderKey, nil)
 				err = ErrOAuth2MissingState
 				if wantState != "" {
 					err = ErrOAuth2WrongState
 					if wantState == gotState {
-						if statusCode, err = oauth2CallbackError(statusCode, hr); err == nil {
+						err = ErrOAuth2WrongProvider
+						if !srv.multipleProviders() || callbackPathFromURL(hr.URL) == p.callbackPath() {
+							statusCode, err = oauth2CallbackError(statusCode, hr)
+						}
+						if err == nil {
 							err = ErrOAuth2MissingPKCEVerifier
 							if verifier != "" {
 								var token *oauth2.Token
@@ -298,27 +369,30 @@ func (srv *Server) HandleAuthResponse(hw http.ResponseWriter, hr *http.Request)
 								if token, err = oauth2Config.Exchange(authctx, hr.FormValue("code") /* #nosec G120 */, exchangeOptions...); srv.Jaws.Log(err) == nil {
 									err = ErrOAuth2NotConfigured
 									statusCode = http.StatusInternalServerError
-									if srv.idTokenVerifier != nil {
+									if p.idTokenVerifier != nil {
 										rawIDToken, _ := token.Extra("id_token").(string)
 										statusCode = http.StatusUnauthorized
 										err = ErrOIDCMissingIDToken
 										if rawIDToken != "" {
 											var idToken *oidc.IDToken
-											if idToken, err = srv.idTokenVerifier.Verify(authctx, rawIDToken); wrapOIDC(ErrOIDCInvalidIDToken, &err) == nil {
+											if idToken, err = p.idTokenVerifier.Verify(authctx, rawIDToken); wrapOIDC(ErrOIDCInvalidIDToken, &err) == nil {
 												err = ErrOIDCMissingNonce
 												if wantNonce != "" {
 													err = ErrOIDCNonceMismatch
 													if idToken.Nonce == wantNonce {
 														var claims map[string]any
 														if err = idToken.Claims(&claims); wrapOIDC(ErrOIDCInvalidIDToken, &err) == nil {
-															tokenSource := oauth2Config.TokenSource(srv.oauth2Context(context.Background()), token)
-															if err = srv.storeSessionAuthClaims(authctx, sess, claims, tokenSource, idToken.Expiry, nil); err == nil {
+															tokenSource := oauth2Config.TokenSource(srv.providerContext(context.Background(), p), token)
+															if err = srv.storeSessionAuthClaims(authctx, sess, p, claims, tokenSource, idToken.Expiry, nil); err == nil {
+																rememberRefreshToken(sess, token)
+																stepUpReturned(sess, wantState)
 																sessValue = claims
 																sessEmail, _ = sess.Get(srv.SessionEmailKey).(string)
 																if s, ok := sess.Get(oauth2ReferrerKey).(string); ok {
 																	location = sanitizeRedirectTarget(hr.Host, s)
 																}
 																sess.Set(oauth2ReferrerKey, nil)
+																srv.setTokenStoreCookie(hw, sess)
 																hw.Header().Set("Location", location)
 																statusCode = http.StatusFound
 															}
@@ -337,8 +411,17 @@ func (srv *Server) HandleAuthResponse(hw http.ResponseWriter, hr *http.Request)
 		}
 		if sess != nil {
 			if sessValue == nil {
+				referrer, _ := sess.Get(oauth2ReferrerKey).(string)
 				clearSessionOAuthFlow(sess)
+				if sess.Get(srv.SessionKey) == nil {
+					sess.Set(oauth2LoginTimeKey, nil)
+				}
 				srv.Jaws.Dirty(sess)
+				if silent && interactionRequired(err) {
+					srv.debugErrorLog("jawsauth: silent re-authentication needs interaction", err, "session_id", sess.ID())
+					srv.startLogin(hw, hr, p, sanitizeRedirectTarget(hr.Host, referrer))
+					return
+				}
 			} else if srv.LoginEvent != nil {
 				srv.LoginEvent(sess, hr)
 			}
@@ -0,0 +1,140 @@
+package jawsauth
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Policy decides whether an authenticated user may access a handler.
+//
+// claims are the verified OIDC claims stored in the session, or the verified
+// bearer token claims. Allow returns false to have the 403 handler served
+// instead; a non-nil error fails the request with 500 Internal Server Error.
+type Policy interface {
+	Allow(ctx context.Context, claims map[string]any, hr *http.Request) (allowed bool, err error)
+}
+
+// PolicyFunc adapts an ordinary function to a Policy.
+type PolicyFunc func(ctx context.Context, claims map[string]any, hr *http.Request) (allowed bool, err error)
+
+// Allow returns f(ctx, claims, hr).
+func (f PolicyFunc) Allow(ctx context.Context, claims map[string]any, hr *http.Request) (allowed bool, err error) {
+	return f(ctx, claims, hr)
+}
+
+// claimsPolicy returns a Policy that allows claims for which fn returns true.
+func claimsPolicy(fn func(claims map[string]any) bool) Policy {
+	return PolicyFunc(func(_ context.Context, claims map[string]any, _ *http.Request) (bool, error) {
+		return fn(claims), nil
+	})
+}
+
+// AllOf returns a Policy that allows the request only if all of policies allow it.
+// It stops at the first policy that denies or fails. With no policies, it allows.
+func AllOf(policies ...Policy) Policy {
+	return PolicyFunc(func(ctx context.Context, claims map[string]any, hr *http.Request) (allowed bool, err error) {
+		allowed = true
+		for _, p := range policies {
+			if allowed, err = p.Allow(ctx, claims, hr); !allowed || err != nil {
+				break
+			}
+		}
+		return
+	})
+}
+
+// AnyOf returns a Policy that allows the request if any of policies allows it.
+// It stops at the first policy that allows or fails. With no policies, it denies.
+func AnyOf(policies ...Policy) Policy {
+	return PolicyFunc(func(ctx context.Context, claims map[string]any, hr *http.Request) (allowed bool, err error) {
+		for _, p := range policies {
+			if allowed, err = p.Allow(ctx, claims, hr); allowed || err != nil {
+				break
+			}
+		}
+		return
+	})
+}
+
+// Not returns a Policy that allows the request if policy denies it.
+// Errors from policy are returned as-is.
+func Not(policy Policy) Policy {
+	return PolicyFunc(func(ctx context.Context, claims map[string]any, hr *http.Request) (allowed bool, err error) {
+		allowed, err = policy.Allow(ctx, claims, hr)
+		allowed = !allowed && err == nil
+		return
+	})
+}
+
+// EmailIn returns a Policy that allows users whose email is one of emails.
+// Emails are normalized as by Server.SetAdmins.
+func EmailIn(emails ...string) Policy {
+	set := make(map[string]struct{})
+	for _, s := range emails {
+		if s = normalizeEmail(s); s != "" {
+			set[s] = struct{}{}
+		}
+	}
+	return claimsPolicy(func(claims map[string]any) bool {
+		_, ok := set[claimEmail(claims)]
+		return ok
+	})
+}
+
+// DomainIn returns a Policy that allows users whose email address is in one of
+// domains, e.g. "example.com" or "@example.com". Matching is case-insensitive.
+func DomainIn(domains ...string) Policy {
+	var set []string
+	for _, s := range domains {
+		if s = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(s), "@")); s != "" {
+			set = append(set, s)
+		}
+	}
+	return claimsPolicy(func(claims map[string]any) bool {
+		_, domain, ok := strings.Cut(claimEmail(claims), "@")
+		return ok && slices.Contains(set, domain)
+	})
+}
+
+// ClaimEquals returns a Policy that allows users whose claim at the dot-separated
+// path (see Server.RoleClaims) equals value, or is an array containing value.
+// Boolean and numeric claims are compared using their JSON text, e.g. "true".
+func ClaimEquals(path, value string) Policy {
+	return claimsPolicy(func(claims map[string]any) bool {
+		got, found := lookupClaim(claims, path)
+		switch v := got.(type) {
+		case bool:
+			got = strconv.FormatBool(v)
+		case float64:
+			got = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		return found && slices.Contains(claimStrings(got), value)
+	})
+}
+
+// EmailVerified returns a Policy that allows users whose "email_verified" claim is true.
+func EmailVerified() Policy {
+	return claimsPolicy(extractEmailVerified)
+}
+
+// AdminPolicy returns a Policy that allows users whose email is an administrator
+// (see SetAdmins and IsAdmin) and, if AdminEmailVerified or RequireEmailVerified
+// is set, whose "email_verified" claim is true. It is the policy used by WrapAdmin
+// and HandlerAdmin.
+func (srv *Server) AdminPolicy() Policy {
+	return claimsPolicy(func(claims map[string]any) bool {
+		return srv.isVerifiedAdmin(claimEmail(claims), extractEmailVerified(claims))
+	})
+}
+
+// RolePolicy returns a Policy that allows users having at least one of roles,
+// as read from the claims at the paths in RoleClaims. It is the policy used by
+// WrapRole and HandlerRole.
+func (srv *Server) RolePolicy(roles ...string) Policy {
+	return claimsPolicy(func(claims map[string]any) bool {
+		return srv.hasRole(claims, roles)
+	})
+}
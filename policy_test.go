@@ -0,0 +1,104 @@
+package jawsauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/linkdata/jaws"
+)
+
+func TestPolicies(t *testing.T) {
+	claims := map[string]any{
+		"email":          "Ops.User@Corp.com",
+		"email_verified": true,
+		"groups":         []any{"ops", "staff"},
+		"tenant":         map[string]any{"id": "t1", "level": float64(3), "active": true},
+	}
+	errPolicy := errors.New("policy failed")
+	failing := PolicyFunc(func(context.Context, map[string]any, *http.Request) (bool, error) {
+		return false, errPolicy
+	})
+	srv := &Server{admins: map[string]struct{}{"ops.user@corp.com": {}}}
+	tests := []struct {
+		name    string
+		policy  Policy
+		allowed bool
+		err     error
+	}{
+		{"EmailIn", EmailIn("Someone <ops.user@corp.com>"), true, nil},
+		{"EmailInOther", EmailIn("other@corp.com"), false, nil},
+		{"DomainIn", DomainIn("@CORP.com"), true, nil},
+		{"DomainInOther", DomainIn("example.com"), false, nil},
+		{"ClaimEqualsArray", ClaimEquals("groups", "ops"), true, nil},
+		{"ClaimEqualsNested", ClaimEquals("tenant.id", "t1"), true, nil},
+		{"ClaimEqualsNumber", ClaimEquals("tenant.level", "3"), true, nil},
+		{"ClaimEqualsBool", ClaimEquals("tenant.active", "true"), true, nil},
+		{"ClaimEqualsMissing", ClaimEquals("tenant.missing", ""), false, nil},
+		{"EmailVerified", EmailVerified(), true, nil},
+		{"Admin", srv.AdminPolicy(), true, nil},
+		{"Role", srv.RolePolicy("staff"), true, nil},
+		{"AllOf", AllOf(EmailVerified(), DomainIn("corp.com"), ClaimEquals("groups", "ops")), true, nil},
+		{"AllOfDenied", AllOf(EmailVerified(), ClaimEquals("groups", "dev")), false, nil},
+		{"AllOfEmpty", AllOf(), true, nil},
+		{"AnyOf", AnyOf(ClaimEquals("groups", "dev"), DomainIn("corp.com")), true, nil},
+		{"AnyOfEmpty", AnyOf(), false, nil},
+		{"Not", Not(ClaimEquals("groups", "dev")), true, nil},
+		{"NotDenied", Not(EmailVerified()), false, nil},
+		{"AllOfError", AllOf(EmailVerified(), failing), false, errPolicy},
+		{"AnyOfError", AnyOf(failing, EmailVerified()), false, errPolicy},
+		{"NotError", Not(failing), false, errPolicy},
+	}
+	for _, tt := range tests {
+		allowed, err := tt.policy.Allow(t.Context(), claims, nil)
+		if allowed != tt.allowed || !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v %v", tt.name, allowed, err)
+		}
+	}
+}
+
+func TestWrapPolicy(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+	srv := newBearerTestServer(jw)
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/protected", nil)
+	sess := jw.NewSession(httptest.NewRecorder(), req)
+	sess.Set(srv.SessionKey, map[string]any{
+		"email":          "user@corp.com",
+		"email_verified": true,
+		"groups":         []any{"ops"},
+	})
+	sess.Set(oauth2IDTokenExpiryKey, time.Now().Add(time.Hour))
+
+	ok := testStatusHandler{statusCode: http.StatusNoContent}
+	failing := PolicyFunc(func(context.Context, map[string]any, *http.Request) (bool, error) {
+		return false, errors.New("policy failed")
+	})
+	srv.SetAdmins([]string{"admin@corp.com"})
+	var middleware func(http.Handler) http.Handler = srv.Wrap
+	tests := []struct {
+		name string
+		h    http.Handler
+		want int
+	}{
+		{"none", middleware(ok), http.StatusNoContent},
+		{"allowed", srv.WrapPolicy(ok, EmailVerified(), DomainIn("corp.com")), http.StatusNoContent},
+		{"denied", srv.WrapPolicy(ok, EmailVerified(), ClaimEquals("groups", "dev")), http.StatusForbidden},
+		{"admin", srv.WrapAdmin(ok), http.StatusForbidden},
+		{"error", srv.WrapPolicy(ok, failing), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		tt.h.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: got %d", tt.name, rec.Code)
+		}
+	}
+}
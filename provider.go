@@ -0,0 +1,224 @@
+package jawsauth
+
+import (
+	"context"
+	"errors"
+	"html"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/linkdata/jaws"
+	"golang.org/x/oauth2"
+)
+
+const oauth2ProviderKey = "oauth2provider"
+const oauth2PendingProviderKey = "oauth2pendingprovider"
+
+// ErrConfigDuplicateProvider means a provider name or callback path is already registered.
+var ErrConfigDuplicateProvider = errors.New("provider already registered")
+
+// ErrOAuth2WrongProvider means the callback was received on a different provider's
+// callback path than the one the login was started with.
+var ErrOAuth2WrongProvider = errors.New("oauth2 wrong provider")
+
+// provider holds the discovered OIDC/OAuth2 settings for one identity provider.
+type provider struct {
+	name             string
+	oauth2cfg        *oauth2.Config
+	idTokenVerifier  *oidc.IDTokenVerifier
+	accessVerifier   *oidc.IDTokenVerifier // verifies JWT access tokens, the audience is checked separately
+	userinfoUrl      string
+	endSessionUrl    string
+	introspectionUrl string
+	issuer           string
+	httpClient       *http.Client
+}
+
+func (p *provider) valid() bool {
+	return p != nil && p.oauth2cfg != nil && p.idTokenVerifier != nil
+}
+
+func (p *provider) callbackPath() (callbackPath string) {
+	if p != nil && p.oauth2cfg != nil {
+		if u, err := url.Parse(p.oauth2cfg.RedirectURL); err == nil {
+			callbackPath = callbackPathFromURL(u)
+		}
+	}
+	return
+}
+
+func (p *provider) issuerOrigin() (origin string) {
+	if p != nil {
+		if u, err := url.Parse(p.issuer); err == nil && u.Scheme != "" && u.Host != "" {
+			origin = u.Scheme + "://" + u.Host
+		}
+	}
+	return
+}
+
+func (cfg *Config) buildProvider(ctx context.Context, overrideUrl string, now func() time.Time) (p *provider, err error) {
+	p = &provider{
+		name:       strings.TrimSpace(cfg.Name),
+		issuer:     cfg.Issuer,
+		httpClient: cfg.HTTPClient,
+	}
+	p.oauth2cfg, p.userinfoUrl, p.endSessionUrl, p.introspectionUrl, p.idTokenVerifier, p.accessVerifier, err = cfg.buildContext(ctx, overrideUrl, now)
+	return
+}
+
+// defaultProvider returns the provider configured by New or NewDebug.
+func (srv *Server) defaultProvider() (p *provider) {
+	if srv != nil {
+		p = &provider{
+			name:             srv.providerName,
+			oauth2cfg:        srv.oauth2cfg,
+			idTokenVerifier:  srv.idTokenVerifier,
+			accessVerifier:   srv.accessVerifier,
+			userinfoUrl:      srv.userinfoUrl,
+			endSessionUrl:    srv.endSessionUrl,
+			introspectionUrl: srv.introspectionUrl,
+			issuer:           srv.issuer,
+			httpClient:       srv.httpClient,
+		}
+	}
+	return
+}
+
+// getProvider returns the named provider, or nil if there is no such provider.
+// An empty name selects the provider configured by New or NewDebug.
+func (srv *Server) getProvider(name string) (p *provider) {
+	if srv != nil {
+		if name == "" || name == srv.providerName {
+			p = srv.defaultProvider()
+		} else {
+			srv.mu.Lock()
+			p = srv.providers[name]
+			srv.mu.Unlock()
+		}
+	}
+	return
+}
+
+// allProviders returns the default provider followed by any added providers sorted by name.
+func (srv *Server) allProviders() (providers []*provider) {
+	if srv != nil {
+		providers = append(providers, srv.defaultProvider())
+		srv.mu.Lock()
+		for _, p := range srv.providers {
+			providers = append(providers, p)
+		}
+		srv.mu.Unlock()
+		slices.SortFunc(providers[1:], func(a, b *provider) int { return strings.Compare(a.name, b.name) })
+	}
+	return
+}
+
+// sessionProvider returns the provider the session is authenticated with.
+func (srv *Server) sessionProvider(sess *jaws.Session) *provider {
+	name, _ := sess.Get(oauth2ProviderKey).(string)
+	return srv.getProvider(name)
+}
+
+// pendingProvider returns the provider the session's login flow was started with.
+func (srv *Server) pendingProvider(sess *jaws.Session) *provider {
+	name, _ := sess.Get(oauth2PendingProviderKey).(string)
+	return srv.getProvider(name)
+}
+
+func (srv *Server) multipleProviders() (yes bool) {
+	if srv != nil {
+		srv.mu.Lock()
+		yes = len(srv.providers) > 0
+		srv.mu.Unlock()
+	}
+	return
+}
+
+// Providers returns the names of the configured identity providers, starting
+// with the one configured by New or NewDebug.
+func (srv *Server) Providers() (names []string) {
+	for _, p := range srv.allProviders() {
+		names = append(names, p.name)
+	}
+	return
+}
+
+// AddProvider configures an additional named identity provider from cfg and
+// registers its OAuth2 callback endpoint via handleFn.
+//
+// cfg.Name must be set and unique, and cfg.RedirectURL must use a callback path
+// not already registered. Once more than one provider is configured, HandleLogin
+// lets the user choose one (see ProviderChooser). Returned name and callback
+// conflicts match both ErrConfig and ErrConfigDuplicateProvider.
+func (srv *Server) AddProvider(cfg *Config, handleFn HandleFunc) (err error) {
+	err = ErrOAuth2NotConfigured
+	if srv != nil && cfg != nil && handleFn != nil {
+		name := strings.TrimSpace(cfg.Name)
+		if err = requireStr("Name", name); err == nil {
+			err = errConfig{field: "Name", cause: ErrConfigDuplicateProvider}
+			if srv.getProvider(name) == nil {
+				var p *provider
+				if p, err = cfg.buildProvider(context.Background(), "", srv.now); err == nil {
+					callbackPath := p.callbackPath()
+					err = errConfig{field: "RedirectURL", cause: ErrConfigDuplicateProvider}
+					if _, handled := srv.HandledPaths[callbackPath]; !handled {
+						srv.mu.Lock()
+						if srv.providers == nil {
+							srv.providers = make(map[string]*provider)
+						}
+						srv.providers[name] = p
+						srv.mu.Unlock()
+						srv.handlePath(callbackPath, handleFn, http.HandlerFunc(srv.HandleAuthResponse))
+						err = nil
+					}
+				}
+			}
+		}
+	}
+	return
+}
+
+// chooseProvider returns the provider selected by the "provider" query parameter.
+// If no provider was selected and more than one is configured, it returns nil.
+func (srv *Server) chooseProvider(hr *http.Request) (p *provider) {
+	if query := hr.URL.Query(); query.Has("provider") {
+		p = srv.getProvider(query.Get("provider"))
+	} else if !srv.multipleProviders() {
+		p = srv.defaultProvider()
+	}
+	return
+}
+
+// writeProviderChooser redirects to ProviderChooser if set, otherwise it renders
+// a page linking to the login endpoint for each configured provider.
+func (srv *Server) writeProviderChooser(hw http.ResponseWriter, hr *http.Request) {
+	if srv.ProviderChooser != "" {
+		hw.Header().Set("Location", sanitizeRedirectTarget(hr.Host, srv.ProviderChooser))
+		srv.writeResult(hw, http.StatusFound, nil, nil)
+		return
+	}
+	var loginPath string
+	if u, err := url.Parse(srv.endpointURL("login")); err == nil {
+		loginPath = u.Path
+	}
+	var sb strings.Builder
+	sb.WriteString(`<html><body><h2>Sign in with</h2><ul>`)
+	for _, p := range srv.allProviders() {
+		label := p.name
+		if label == "" {
+			label = p.issuer
+		}
+		sb.WriteString(`<li><a href="`)
+		sb.WriteString(html.EscapeString(loginPath + "?" + url.Values{"provider": {p.name}}.Encode()))
+		sb.WriteString(`">`)
+		sb.WriteString(html.EscapeString(label))
+		sb.WriteString(`</a></li>`)
+	}
+	sb.WriteString(`</ul></body></html>`)
+	hw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	srv.writeResult(hw, http.StatusOK, nil, []byte(sb.String()))
+}
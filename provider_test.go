@@ -0,0 +1,227 @@
+package jawsauth
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/linkdata/jaws"
+	"golang.org/x/oauth2"
+)
+
+func newProviderTestServer(t *testing.T, jw *jaws.Jaws, discovery *httptest.Server) (srv *Server, handled []string) {
+	t.Helper()
+	srv = &Server{
+		Jaws:                    jw,
+		SessionKey:              "oidc_claims",
+		SessionTokenKey:         "oauth2_tokensource",
+		SessionEmailKey:         "email",
+		SessionEmailVerifiedKey: "email_verified",
+		HandledPaths:            map[string]struct{}{"/oauth2/callback": {}, "/oauth2/login": {}},
+		oauth2cfg: &oauth2.Config{
+			ClientID:    "client",
+			Endpoint:    oauth2.Endpoint{AuthURL: "https://primary.example/auth", TokenURL: "https://primary.example/token"},
+			RedirectURL: "http://example.com/oauth2/callback",
+		},
+		idTokenVerifier: oidc.NewVerifier("https://primary.example", passthroughKeySet{}, &oidc.Config{ClientID: "client"}),
+		issuer:          "https://primary.example",
+		providerName:    "primary",
+	}
+	err := srv.AddProvider(&Config{
+		Name:                "second",
+		RedirectURL:         "http://example.com/oauth2/second/callback",
+		Issuer:              discovery.URL,
+		AllowInsecureIssuer: true,
+		ClientID:            "second-client",
+	}, func(uri string, handler http.Handler) {
+		handled = append(handled, uri)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestServerAddProvider(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+	discovery := newOIDCDiscoveryServer(t)
+	defer discovery.Close()
+
+	srv, handled := newProviderTestServer(t, jw, discovery)
+	if !slices.Equal(handled, []string{"/oauth2/second/callback"}) {
+		t.Fatal(handled)
+	}
+	if got := srv.Providers(); !slices.Equal(got, []string{"primary", "second"}) {
+		t.Fatal(got)
+	}
+	if !srv.multipleProviders() {
+		t.Fatal("expected multiple providers")
+	}
+	if p := srv.getProvider("second"); !p.valid() || p.oauth2cfg.ClientID != "second-client" || p.issuer != discovery.URL {
+		t.Fatal(p)
+	}
+	if p := srv.getProvider(""); p == nil || p.name != "primary" {
+		t.Fatal(p)
+	}
+	if p := srv.getProvider("missing"); p != nil {
+		t.Fatal(p)
+	}
+
+	noop := func(string, http.Handler) {}
+	err = srv.AddProvider(&Config{RedirectURL: "http://example.com/oauth2/third/callback"}, noop)
+	if !errors.Is(err, ErrConfigMissingValue) {
+		t.Fatal(err)
+	}
+	err = srv.AddProvider(&Config{Name: "second"}, noop)
+	if !errors.Is(err, ErrConfigDuplicateProvider) || !errors.Is(err, ErrConfig) {
+		t.Fatal(err)
+	}
+	err = srv.AddProvider(&Config{
+		Name:                "third",
+		RedirectURL:         "http://example.com/oauth2/callback",
+		Issuer:              discovery.URL,
+		AllowInsecureIssuer: true,
+		ClientID:            "third-client",
+	}, noop)
+	if !errors.Is(err, ErrConfigDuplicateProvider) {
+		t.Fatal(err)
+	}
+	if err = (*Server)(nil).AddProvider(&Config{}, noop); !errors.Is(err, ErrOAuth2NotConfigured) {
+		t.Fatal(err)
+	}
+}
+
+func TestHandleLoginProviderChooser(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+	discovery := newOIDCDiscoveryServer(t)
+	defer discovery.Close()
+	srv, _ := newProviderTestServer(t, jw, discovery)
+
+	rec := httptest.NewRecorder()
+	srv.HandleLogin(rec, httptest.NewRequest(http.MethodGet, "http://example.com/oauth2/login", nil))
+	resp := rec.Result()
+	body, _ := io.ReadAll(resp.Body)
+	closeResponseBody(t, resp)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(resp.Status)
+	}
+	for _, want := range []string{`href="/oauth2/login?provider=primary"`, `href="/oauth2/login?provider=second"`} {
+		if !strings.Contains(string(body), want) {
+			t.Fatal(string(body))
+		}
+	}
+
+	srv.ProviderChooser = "/choose"
+	rec = httptest.NewRecorder()
+	srv.HandleLogin(rec, httptest.NewRequest(http.MethodGet, "http://example.com/oauth2/login?provider=unknown", nil))
+	resp = rec.Result()
+	closeResponseBody(t, resp)
+	if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != "/choose" {
+		t.Fatal(resp.Status, resp.Header.Get("Location"))
+	}
+
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/oauth2/login?provider=second", nil)
+	sess := jw.NewSession(rec, req)
+	srv.HandleLogin(rec, req)
+	resp = rec.Result()
+	closeResponseBody(t, resp)
+	if resp.StatusCode != http.StatusFound {
+		t.Fatal(resp.Status)
+	}
+	u, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.Scheme + "://" + u.Host + u.Path; got != discovery.URL+"/oauth2/auth" {
+		t.Fatal(got)
+	}
+	if got := u.Query().Get("client_id"); got != "second-client" {
+		t.Fatal(got)
+	}
+	if got, _ := sess.Get(oauth2PendingProviderKey).(string); got != "second" {
+		t.Fatal(got)
+	}
+	if p := srv.pendingProvider(sess); p == nil || p.name != "second" {
+		t.Fatal(p)
+	}
+}
+
+func TestHandleAuthResponseWrongProvider(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+	discovery := newOIDCDiscoveryServer(t)
+	defer discovery.Close()
+	srv, _ := newProviderTestServer(t, jw, discovery)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/oauth2/callback?state=state123&code=code123", nil)
+	sess := jw.NewSession(rec, req)
+	sess.Set(oauth2StateKey, "state123")
+	sess.Set(oauth2PKCEVerifierKey, oauth2.GenerateVerifier())
+	sess.Set(oauth2NonceKey, "nonce123")
+	sess.Set(oauth2PendingProviderKey, "second")
+
+	srv.HandleAuthResponse(rec, req)
+	resp := rec.Result()
+	body, _ := io.ReadAll(resp.Body)
+	closeResponseBody(t, resp)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatal(resp.Status)
+	}
+	if !strings.Contains(string(body), ErrOAuth2WrongProvider.Error()) {
+		t.Fatal(string(body))
+	}
+	if got := sess.Get(oauth2PendingProviderKey); got != nil {
+		t.Fatal(got)
+	}
+}
+
+func TestSessionProvider(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+	discovery := newOIDCDiscoveryServer(t)
+	defer discovery.Close()
+	srv, _ := newProviderTestServer(t, jw, discovery)
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	sess := jw.NewSession(httptest.NewRecorder(), req)
+	if p := srv.sessionProvider(sess); p == nil || p.name != "primary" {
+		t.Fatal(p)
+	}
+	err = srv.storeSessionAuthClaims(t.Context(), sess, srv.getProvider("second"), map[string]any{"sub": "sub-123"}, nil, time.Now().Add(time.Hour), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := srv.sessionProvider(sess); p == nil || p.name != "second" {
+		t.Fatal(p)
+	}
+	if got := srv.issuerOrigins(); got != "https://primary.example "+discovery.URL {
+		t.Fatal(got)
+	}
+	srv.clearSessionAuth(sess, nil, false, false, nil)
+	if got := sess.Get(oauth2ProviderKey); got != nil {
+		t.Fatal(got)
+	}
+}
@@ -0,0 +1,84 @@
+package jawsauth
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// RefreshPolicy controls when the auth-refresh timer refreshes session tokens
+// and how it retries failed refreshes.
+//
+// The zero value refreshes 10 seconds before the ID token expires, but no sooner
+// than a quarter of its remaining lifetime, retries a
+// failed refresh once when the ID token expires and runs any number of
+// refreshes concurrently.
+type RefreshPolicy struct {
+	Skew        time.Duration // refresh this long before the ID token expires, if zero 10 seconds
+	Jitter      time.Duration // if positive, refreshes are moved up and retries delayed by a random duration up to this long
+	Backoff     time.Duration // if positive, the delay before retrying a failed refresh, doubled for every further retry
+	MaxBackoff  time.Duration // if positive, the upper bound of the retry delay before jitter
+	MaxRetries  int           // if positive, the number of Backoff retries before waiting for the ID token to expire
+	MaxInFlight int           // if positive, the maximum number of refreshes running concurrently
+}
+
+func (rp RefreshPolicy) skew() time.Duration {
+	if rp.Skew > 0 {
+		return rp.Skew
+	}
+	return authRefreshSkew
+}
+
+func (rp RefreshPolicy) jitter() (d time.Duration) {
+	if rp.Jitter > 0 {
+		d = rand.N(rp.Jitter) // #nosec G404
+	}
+	return
+}
+
+// refreshAt returns when a session whose ID token expires at expiry should be
+// refreshed, scheduled at now. Skew and jitter are capped at three quarters of
+// the remaining lifetime, so that a short-lived token is not refreshed at once.
+func (rp RefreshPolicy) refreshAt(expiry, now time.Time) time.Time {
+	lead := rp.skew() + rp.jitter()
+	if remaining := expiry.Sub(now); lead > remaining*3/4 {
+		lead = max(remaining*3/4, 0)
+	}
+	return expiry.Add(-lead)
+}
+
+// retryDelay returns how long to wait at time now before the next attempt
+// after retries failed retries. Retries never wait past expiry.
+func (rp RefreshPolicy) retryDelay(retries int, expiry, now time.Time) (delay time.Duration) {
+	delay = max(expiry.Sub(now), 0)
+	if rp.Backoff > 0 && (rp.MaxRetries <= 0 || retries < rp.MaxRetries) {
+		backoff := rp.Backoff
+		for range retries {
+			if backoff >= delay {
+				break
+			}
+			backoff *= 2
+		}
+		if rp.MaxBackoff > 0 {
+			backoff = min(backoff, rp.MaxBackoff)
+		}
+		delay = min(delay, backoff+rp.jitter())
+	}
+	return
+}
+
+// acquireRefresh waits until fewer than MaxInFlight refreshes are running and
+// returns a function that must be called when the refresh is done.
+func (srv *Server) acquireRefresh() (release func()) {
+	release = func() {}
+	if n := srv.RefreshPolicy.MaxInFlight; n > 0 {
+		srv.mu.Lock()
+		if cap(srv.refreshSem) != n {
+			srv.refreshSem = make(chan struct{}, n)
+		}
+		sem := srv.refreshSem
+		srv.mu.Unlock()
+		sem <- struct{}{}
+		release = func() { <-sem }
+	}
+	return
+}
@@ -0,0 +1,133 @@
+package jawsauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/linkdata/jaws"
+	"golang.org/x/oauth2"
+)
+
+func TestRefreshPolicyRefreshAt(t *testing.T) {
+	now := time.Now()
+	expiry := now.Add(time.Hour)
+	if got := (RefreshPolicy{}).refreshAt(expiry, now); !got.Equal(expiry.Add(-authRefreshSkew)) {
+		t.Fatal(got)
+	}
+	rp := RefreshPolicy{Skew: time.Minute, Jitter: 30 * time.Second}
+	for range 100 {
+		if got := rp.refreshAt(expiry, now); got.After(expiry.Add(-time.Minute)) || !got.After(expiry.Add(-90*time.Second)) {
+			t.Fatal(got)
+		}
+	}
+
+	// a lead longer than the token lifetime still leaves a quarter of it
+	expiry = now.Add(time.Minute)
+	for range 100 {
+		if got := rp.refreshAt(expiry, now); !got.Equal(now.Add(15 * time.Second)) {
+			t.Fatal(got)
+		}
+	}
+	if got := rp.refreshAt(now.Add(-time.Second), now); !got.Equal(now.Add(-time.Second)) {
+		t.Fatal(got)
+	}
+}
+
+func TestRefreshPolicyRetryDelay(t *testing.T) {
+	now := time.Now()
+	expiry := now.Add(time.Hour)
+	tests := []struct {
+		rp      RefreshPolicy
+		retries int
+		want    time.Duration
+	}{
+		{RefreshPolicy{}, 0, time.Hour},
+		{RefreshPolicy{Backoff: time.Second}, 0, time.Second},
+		{RefreshPolicy{Backoff: time.Second}, 3, 8 * time.Second},
+		{RefreshPolicy{Backoff: time.Second}, 100, time.Hour},
+		{RefreshPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Second}, 3, 5 * time.Second},
+		{RefreshPolicy{Backoff: time.Second, MaxRetries: 2}, 1, 2 * time.Second},
+		{RefreshPolicy{Backoff: time.Second, MaxRetries: 2}, 2, time.Hour},
+		{RefreshPolicy{Backoff: 2 * time.Hour}, 0, time.Hour},
+	}
+	for i, tt := range tests {
+		if got := tt.rp.retryDelay(tt.retries, expiry, now); got != tt.want {
+			t.Error(i, got)
+		}
+	}
+	if got := (RefreshPolicy{Backoff: time.Second}).retryDelay(0, now.Add(-time.Minute), now); got != 0 {
+		t.Fatal(got)
+	}
+	rp := RefreshPolicy{Backoff: time.Second, Jitter: time.Second}
+	for range 100 {
+		if got := rp.retryDelay(0, expiry, now); got < time.Second || got >= 2*time.Second {
+			t.Fatal(got)
+		}
+	}
+}
+
+func TestAuthTimerRefreshPolicyBackoff(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	factory := &testAuthTimerFactory{}
+	srv := newTimerTestServer(t, jw, "https://issuer.example", factory)
+	srv.RefreshPolicy = RefreshPolicy{Skew: time.Minute, Backoff: time.Second, MaxRetries: 2}
+	sess := jw.NewSession(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+	expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+	if err = srv.storeSessionAuthClaims(t.Context(), sess, srv.defaultProvider(), map[string]any{
+		"exp":   expiry.Unix(),
+		"email": "user@example.com",
+	}, tokenSourceFunc(func() (*oauth2.Token, error) {
+		return nil, errAuthSessionTestToken
+	}), expiry, nil); err != nil {
+		t.Fatal(err)
+	}
+	if delay := factory.timer(0).delay; delay > time.Hour-time.Minute || delay < time.Hour-time.Minute-2*time.Second {
+		t.Fatal(delay)
+	}
+
+	factory.timer(0).fire()
+	factory.timer(1).fire()
+	factory.timer(2).fire()
+	if factory.len() != 4 || sess.Get(srv.SessionKey) == nil {
+		t.Fatal(factory.len())
+	}
+	if delay := factory.timer(1).delay; delay != time.Second {
+		t.Fatal(delay)
+	}
+	if delay := factory.timer(2).delay; delay != 2*time.Second {
+		t.Fatal(delay)
+	}
+	// the retry budget is spent, so the last attempt waits for the ID token to expire
+	if delay := factory.timer(3).delay; delay < time.Hour-2*time.Second {
+		t.Fatal(delay)
+	}
+}
+
+func TestServerAcquireRefresh(t *testing.T) {
+	srv := &Server{}
+	srv.acquireRefresh()()
+
+	srv.RefreshPolicy.MaxInFlight = 1
+	release := srv.acquireRefresh()
+	acquired := make(chan func())
+	go func() { acquired <- srv.acquireRefresh() }()
+	select {
+	case <-acquired:
+		t.Fatal("acquired beyond MaxInFlight")
+	case <-time.After(10 * time.Millisecond):
+	}
+	release()
+	select {
+	case release = <-acquired:
+		release()
+	case <-time.After(time.Second):
+		t.Fatal("not acquired after release")
+	}
+}
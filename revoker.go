@@ -0,0 +1,202 @@
+package jawsauth
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/linkdata/jaws"
+)
+
+const oauth2AuthTimeKey = "oauth2authtime"
+const oauth2RevocationCheckKey = "oauth2revocationcheck"
+
+// ErrSessionRevoked means the session or bearer token was revoked using the Revoker.
+var ErrSessionRevoked = errors.New("session revoked")
+
+// Revocation identifies sessions by OIDC subject, OIDC session ID or email.
+//
+// When revoking, every non-empty field is revoked. When checking, a session
+// is revoked if any of its non-empty fields is. Subject and SID are only unique
+// per issuer, so a revocation with an Issuer only matches sessions of that
+// issuer, while one without matches sessions of any issuer.
+type Revocation struct {
+	Issuer  string // "iss" claim, if not empty Subject and SID are scoped to it
+	Subject string // "sub" claim
+	SID     string // "sid" claim
+	Email   string // email address, normalized as by Server.SetAdmins
+}
+
+// Revoker records revoked sessions so that all Server instances sharing it
+// deny them. Implementations backed by a shared store make revocations
+// cluster-wide. Implementations must be safe for concurrent use.
+type Revoker interface {
+	// Revoke denies access to all sessions matching rev that authenticated
+	// at or before the time of the call.
+	Revoke(ctx context.Context, rev Revocation) (err error)
+	// Revoked returns true if a session matching rev that authenticated at
+	// authTime has been revoked.
+	Revoked(ctx context.Context, rev Revocation, authTime time.Time) (revoked bool, err error)
+}
+
+// revocationKeys returns the non-empty identifiers in rev prefixed with their
+// kind, with Subject and SID scoped to Issuer if it is not empty.
+func revocationKeys(rev Revocation) (keys []string) {
+	var scope string
+	if rev.Issuer != "" {
+		scope = rev.Issuer + " "
+	}
+	if rev.Subject != "" {
+		keys = append(keys, "sub:"+scope+rev.Subject)
+	}
+	if rev.SID != "" {
+		keys = append(keys, "sid:"+scope+rev.SID)
+	}
+	if email := normalizeEmail(rev.Email); email != "" {
+		keys = append(keys, "email:"+email)
+	}
+	return
+}
+
+// revocationMatchKeys returns the keys of revocations that match a session
+// identified by rev: those scoped to its Issuer as well as unscoped ones.
+func revocationMatchKeys(rev Revocation) (keys []string) {
+	keys = revocationKeys(rev)
+	if rev.Issuer != "" {
+		rev.Issuer = ""
+		keys = append(keys, revocationKeys(rev)...)
+		slices.Sort(keys)
+		keys = slices.Compact(keys)
+	}
+	return
+}
+
+// MemoryRevoker is a Revoker that keeps revocations in memory.
+//
+// It only covers a single process, but is useful for tests and as a building
+// block. The zero value is ready to use.
+type MemoryRevoker struct {
+	MaxAge  time.Duration // if positive, revocations older than this are forgotten
+	Clock   Clock         // if not nil, the time source for revocation times; should match Server.Clock
+	mu      sync.Mutex
+	revoked map[string]time.Time
+}
+
+// NewMemoryRevoker returns a new, empty MemoryRevoker that forgets revocations
+// older than maxAge, if positive. maxAge should be at least the longest
+// lifetime of a session.
+func NewMemoryRevoker(maxAge time.Duration) *MemoryRevoker {
+	return &MemoryRevoker{MaxAge: maxAge}
+}
+
+// Revoke implements Revoker.
+func (mr *MemoryRevoker) Revoke(ctx context.Context, rev Revocation) (err error) {
+	now := mr.now()
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	if mr.revoked == nil {
+		mr.revoked = make(map[string]time.Time)
+	}
+	if mr.MaxAge > 0 {
+		for k, at := range mr.revoked {
+			if now.Sub(at) > mr.MaxAge {
+				delete(mr.revoked, k)
+			}
+		}
+	}
+	for _, k := range revocationKeys(rev) {
+		mr.revoked[k] = now
+	}
+	return
+}
+
+func (mr *MemoryRevoker) now() time.Time {
+	if mr.Clock != nil {
+		return mr.Clock.Now()
+	}
+	return time.Now()
+}
+
+// Revoked implements Revoker.
+func (mr *MemoryRevoker) Revoked(ctx context.Context, rev Revocation, authTime time.Time) (revoked bool, err error) {
+	now := mr.now()
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	for _, k := range revocationMatchKeys(rev) {
+		if at, ok := mr.revoked[k]; ok && !authTime.After(at) && (mr.MaxAge <= 0 || now.Sub(at) <= mr.MaxAge) {
+			revoked = true
+			break
+		}
+	}
+	return
+}
+
+// claimsRevocation returns the Revocation identifying claims.
+func claimsRevocation(claims map[string]any) (rev Revocation) {
+	rev.Issuer, _ = claims["iss"].(string)
+	rev.Subject, _ = claims["sub"].(string)
+	rev.SID, _ = claims["sid"].(string)
+	rev.Email = claimEmail(claims)
+	return
+}
+
+// Revoke clears the auth of the matching sessions of this Server immediately,
+// and if Revoker is set, revokes rev using it so that every Server sharing the
+// Revoker denies the matching sessions.
+//
+// Other Server instances deny the sessions on their next request through Wrap
+// (within RevocationInterval) or auth refresh. Users may log in again afterwards.
+// The local sessions are cleared even if Revoker fails, and its error is returned.
+func (srv *Server) Revoke(ctx context.Context, rev Revocation) (err error) {
+	if srv.Revoker != nil {
+		err = srv.Revoker.Revoke(ctx, rev)
+	}
+	keys := revocationKeys(rev)
+	n := srv.logoutMatching(func(_ *jaws.Session, claims map[string]any) bool {
+		return slices.ContainsFunc(revocationMatchKeys(claimsRevocation(claims)), func(k string) bool {
+			return slices.Contains(keys, k)
+		})
+	})
+	srv.debugErrorLog("jawsauth: revoked", err, "issuer", rev.Issuer, "sub", rev.Subject, "sid", rev.SID, "email", rev.Email, "sessions_cleared", n, "shared", srv.Revoker != nil)
+	return
+}
+
+// sessionRevoked returns true if Revoker reports the authenticated session as
+// revoked. Unless force is true, Revoker is consulted at most once per
+// RevocationInterval for each session. Revoker failures are logged and the
+// session is not considered revoked.
+func (srv *Server) sessionRevoked(ctx context.Context, sess *jaws.Session, force bool) (revoked bool) {
+	if srv.Revoker != nil && sess != nil {
+		now := srv.now()
+		lastCheck, _ := sess.Get(oauth2RevocationCheckKey).(time.Time)
+		if force || srv.RevocationInterval <= 0 || now.Sub(lastCheck) >= srv.RevocationInterval {
+			claims, _ := sess.Get(srv.SessionKey).(map[string]any)
+			authTime, _ := sess.Get(oauth2AuthTimeKey).(time.Time)
+			var err error
+			if revoked, err = srv.Revoker.Revoked(ctx, claimsRevocation(claims), authTime); srv.Jaws.Log(err) == nil {
+				sess.Set(oauth2RevocationCheckKey, now)
+			} else {
+				revoked = false
+			}
+			if revoked {
+				srv.debugErrorLog("jawsauth: session revoked", ErrSessionRevoked, "session_id", sess.ID())
+			}
+		}
+	}
+	return
+}
+
+// bearerRevoked returns true if Revoker reports the bearer token claims as
+// revoked, using the "iat" claim as the auth time. Revoker failures are logged
+// and the token is not considered revoked.
+func (srv *Server) bearerRevoked(ctx context.Context, claims map[string]any) (revoked bool) {
+	if srv.Revoker != nil {
+		var err error
+		if revoked, err = srv.Revoker.Revoked(ctx, claimsRevocation(claims), claimTime(claims["iat"])); srv.Jaws.Log(err) != nil {
+			revoked = false
+		}
+	}
+	return
+}
@@ -0,0 +1,253 @@
+package jawsauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/linkdata/jaws"
+)
+
+type failingRevoker struct{}
+
+func (failingRevoker) Revoke(context.Context, Revocation) error { return errors.New("revoker down") }
+
+func (failingRevoker) Revoked(context.Context, Revocation, time.Time) (bool, error) {
+	return true, errors.New("revoker down")
+}
+
+func TestMemoryRevoker(t *testing.T) {
+	ctx := t.Context()
+	mr := NewMemoryRevoker(0)
+	before := time.Now().Add(-time.Second)
+	if revoked, err := mr.Revoked(ctx, Revocation{Subject: "sub-123"}, before); err != nil || revoked {
+		t.Fatal(revoked, err)
+	}
+	if err := mr.Revoke(ctx, Revocation{Subject: "sub-123", Email: " User@Example.com "}); err != nil {
+		t.Fatal(err)
+	}
+	if err := mr.Revoke(ctx, Revocation{Issuer: "https://a.example", SID: "sid-a"}); err != nil {
+		t.Fatal(err)
+	}
+	after := time.Now().Add(time.Second)
+	tests := []struct {
+		rev      Revocation
+		authTime time.Time
+		want     bool
+	}{
+		{Revocation{Subject: "sub-123"}, before, true},
+		{Revocation{Subject: "sub-123"}, after, false},
+		{Revocation{Subject: "sub-456", Email: "user@example.com"}, before, true},
+		{Revocation{Subject: "sub-456", SID: "sub-123"}, before, false},
+		{Revocation{Issuer: "https://a.example", Subject: "sub-123"}, before, true},
+		{Revocation{Issuer: "https://a.example", SID: "sid-a"}, before, true},
+		{Revocation{Issuer: "https://b.example", SID: "sid-a"}, before, false},
+		{Revocation{SID: "sid-a"}, before, false},
+		{Revocation{}, before, false},
+	}
+	for i, tt := range tests {
+		if revoked, err := mr.Revoked(ctx, tt.rev, tt.authTime); err != nil || revoked != tt.want {
+			t.Error(i, revoked, err)
+		}
+	}
+
+	mr.MaxAge = time.Minute
+	mr.mu.Lock()
+	mr.revoked["sub:sub-123"] = time.Now().Add(-2 * time.Minute)
+	mr.mu.Unlock()
+	if revoked, _ := mr.Revoked(ctx, Revocation{Subject: "sub-123"}, time.Time{}); revoked {
+		t.Fatal("expired revocation applied")
+	}
+	if err := mr.Revoke(ctx, Revocation{SID: "sid-1"}); err != nil {
+		t.Fatal(err)
+	}
+	mr.mu.Lock()
+	_, kept := mr.revoked["sub:sub-123"]
+	n := len(mr.revoked)
+	mr.mu.Unlock()
+	if kept || n != 3 {
+		t.Fatal(kept, n)
+	}
+}
+
+func TestWrapDeniesRevokedSession(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	revoker := NewMemoryRevoker(0)
+	srv := newWrapperTestServer(jw, "https://issuer.example")
+	srv.Revoker = revoker
+	srv.RevocationInterval = time.Hour
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/protected", nil)
+	sess := jw.NewSession(httptest.NewRecorder(), req)
+	sess.Set(srv.SessionKey, map[string]any{"sub": "sub-123", "email": "user@example.com"})
+	sess.Set(oauth2IDTokenExpiryKey, time.Now().Add(time.Hour))
+	sess.Set(oauth2AuthTimeKey, time.Now().Add(-time.Minute))
+
+	h := srv.Wrap(testStatusHandler{statusCode: http.StatusNoContent})
+	serve := func() int {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := serve(); code != http.StatusNoContent {
+		t.Fatal(code)
+	}
+
+	// revoked on another node; the cached check defers denial until the interval passes
+	if err = revoker.Revoke(t.Context(), Revocation{Email: "USER@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if code := serve(); code != http.StatusNoContent {
+		t.Fatal(code)
+	}
+	sess.Set(oauth2RevocationCheckKey, time.Now().Add(-2*time.Hour))
+	if code := serve(); code != http.StatusFound {
+		t.Fatal(code)
+	}
+	if sess.Get(srv.SessionKey) != nil || sess.Get(oauth2AuthTimeKey) != nil {
+		t.Fatal("auth not cleared")
+	}
+
+	// logging in again after the revocation is allowed
+	sess, failedErr := runLoginCallback(t, jw, srv, map[string]any{"email": "user@example.com"})
+	if failedErr != nil {
+		t.Fatal(failedErr)
+	}
+	if authTime, _ := sess.Get(oauth2AuthTimeKey).(time.Time); authTime.IsZero() {
+		t.Fatal("missing auth time")
+	}
+	if srv.sessionRevoked(t.Context(), sess, true) {
+		t.Fatal("new login revoked")
+	}
+
+	srv.Revoker = failingRevoker{}
+	if srv.sessionRevoked(t.Context(), sess, true) {
+		t.Fatal("failing revoker revoked")
+	}
+}
+
+func TestAuthTimerDeniesRevokedSession(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	factory := &testAuthTimerFactory{}
+	srv := newWrapperTestServer(jw, "https://issuer.example")
+	srv.Clock = factory
+	srv.Revoker = NewMemoryRevoker(0)
+	sess := newBackChannelTestSession(t, jw, srv, "sid-1", "sub-123")
+	if err = srv.Revoker.Revoke(t.Context(), Revocation{Subject: "sub-123"}); err != nil {
+		t.Fatal(err)
+	}
+	factory.timer(factory.len() - 1).fire()
+	if sess.Get(srv.SessionKey) != nil {
+		t.Fatal("auth not cleared")
+	}
+}
+
+func TestServerRevoke(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	srv := newWrapperTestServer(jw, "https://issuer.example")
+	factory := &testAuthTimerFactory{}
+	srv.Clock = factory
+	sess0 := newBackChannelTestSession(t, jw, srv, "sid-0", "sub-000")
+	if err = srv.Revoke(t.Context(), Revocation{Subject: "sub-000"}); err != nil || sess0.Get(srv.SessionKey) != nil {
+		t.Fatal(err)
+	}
+
+	srv.Revoker = NewMemoryRevoker(0)
+	sess1 := newBackChannelTestSession(t, jw, srv, "sid-1", "sub-123")
+	sess2 := newBackChannelTestSession(t, jw, srv, "sid-2", "sub-456")
+	if err = srv.Revoke(t.Context(), Revocation{SID: "sid-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if sess1.Get(srv.SessionKey) != nil || sess2.Get(srv.SessionKey) == nil {
+		t.Fatal("wrong sessions cleared")
+	}
+
+	srv.Revoker = failingRevoker{}
+	if err = srv.Revoke(t.Context(), Revocation{SID: "sid-2"}); err == nil || sess2.Get(srv.SessionKey) != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWrapBearerTokenRevoked(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	srv := newBearerTestServer(jw)
+	srv.Revoker = NewMemoryRevoker(0)
+	token := makeAccessToken(t, "api", time.Now().Add(time.Hour))
+	h := srv.Wrap(testStatusHandler{statusCode: http.StatusNoContent})
+	serve := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/api", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := serve(); rec.Code != http.StatusNoContent {
+		t.Fatal(rec.Code)
+	}
+	claims, err := srv.verifyBearerToken(t.Context(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = srv.Revoker.Revoke(t.Context(), claimsRevocation(claims)); err != nil {
+		t.Fatal(err)
+	}
+	if rec := serve(); rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "Bearer" {
+		t.Fatal(rec.Code, rec.Header())
+	}
+}
+
+func TestHandleBackChannelLogoutRevokes(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	const issuer = "https://issuer.example"
+	srv := newTimerTestServer(t, jw, issuer, &testAuthTimerFactory{})
+	revoker := NewMemoryRevoker(0)
+	srv.Revoker = revoker
+	authTime := time.Now().Add(-time.Minute)
+
+	if rec := postLogoutToken(srv, makeLogoutToken(t, issuer, map[string]any{"sid": "sid-a1", "sub": "sub-a"})); rec.Code != http.StatusOK {
+		t.Fatal(rec.Code, rec.Body.String())
+	}
+	if revoked, _ := revoker.Revoked(t.Context(), Revocation{Issuer: issuer, SID: "sid-a1"}, authTime); !revoked {
+		t.Fatal("sid not revoked")
+	}
+	if revoked, _ := revoker.Revoked(t.Context(), Revocation{Issuer: "https://other.example", SID: "sid-a1"}, authTime); revoked {
+		t.Fatal("sid of other issuer revoked")
+	}
+	if revoked, _ := revoker.Revoked(t.Context(), Revocation{Issuer: issuer, Subject: "sub-a"}, authTime); revoked {
+		t.Fatal("sub revoked")
+	}
+
+	if rec := postLogoutToken(srv, makeLogoutToken(t, issuer, map[string]any{"sub": "sub-b"})); rec.Code != http.StatusOK {
+		t.Fatal(rec.Code, rec.Body.String())
+	}
+	if revoked, _ := revoker.Revoked(t.Context(), Revocation{Issuer: issuer, Subject: "sub-b"}, authTime); !revoked {
+		t.Fatal("sub not revoked")
+	}
+}
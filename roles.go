@@ -0,0 +1,92 @@
+package jawsauth
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/linkdata/jaws/lib/ui"
+)
+
+// DefaultRoleClaims are the claim paths searched for roles and groups if
+// Server.RoleClaims is empty. They cover Keycloak realm roles and the "groups"
+// and "roles" claims emitted by Entra ID and others.
+var DefaultRoleClaims = []string{"realm_access.roles", "groups", "roles"}
+
+// lookupClaim returns the value at the dot-separated path in claims,
+// descending into nested objects.
+//
+// Keys that themselves contain dots are matched before the path is split,
+// so "resource_access.my.app.roles" finds the "roles" of client "my.app".
+func lookupClaim(claims any, path string) (value any, found bool) {
+	if m, ok := claims.(map[string]any); ok {
+		if value, found = m[path]; !found {
+			for i := 0; i < len(path) && !found; i++ {
+				if path[i] == '.' {
+					if next, ok := m[path[:i]]; ok {
+						value, found = lookupClaim(next, path[i+1:])
+					}
+				}
+			}
+		}
+	}
+	return
+}
+
+// claimRoles returns the roles and groups found in claims at the paths in
+// RoleClaims, or DefaultRoleClaims if RoleClaims is empty.
+func (srv *Server) claimRoles(claims map[string]any) (roles []string) {
+	paths := DefaultRoleClaims
+	if srv != nil && len(srv.RoleClaims) > 0 {
+		paths = srv.RoleClaims
+	}
+	for _, path := range paths {
+		if value, found := lookupClaim(claims, path); found {
+			roles = append(roles, claimStrings(value)...)
+		}
+	}
+	return
+}
+
+// hasRole returns true if claims grant at least one of roles.
+func (srv *Server) hasRole(claims map[string]any, roles []string) bool {
+	return slices.ContainsFunc(srv.claimRoles(claims), func(role string) bool { return slices.Contains(roles, role) })
+}
+
+func (srv *Server) rolePolicies(roles []string) (policies []Policy) {
+	if len(roles) > 0 {
+		policies = append(policies, srv.RolePolicy(roles...))
+	}
+	return
+}
+
+// WrapRole returns a http.Handler that requires an authenticated user having at
+// least one of roles before invoking h.
+//
+// Roles and groups are read from the stored OIDC claims at the paths in
+// RoleClaims. Unauthenticated requests are redirected into the OIDC login flow
+// (HandleLogin); authenticated users without any of the roles are served the 403
+// handler instead of h. With no roles, it behaves like Wrap. If the Server is not
+// Valid, returns h.
+func (srv *Server) WrapRole(h http.Handler, roles ...string) (rh http.Handler) {
+	return srv.wrap(h, srv.rolePolicies(roles)...)
+}
+
+// HandlerRole returns a http.Handler that renders the named jaws.Template with dot
+// and requires an authenticated user having at least one of roles.
+//
+// Authenticated users without any of the roles are served the 403 handler. If the
+// Server is not Valid, the template handler is returned without the authentication
+// requirement.
+func (srv *Server) HandlerRole(name string, dot any, roles ...string) http.Handler {
+	return srv.wrap(ui.Handler(srv.Jaws, name, dot), srv.rolePolicies(roles)...)
+}
+
+// HasRole reports whether the authenticated user has at least one of roles,
+// as read from the claims at the paths in Server.RoleClaims.
+// It is safe to call on a nil or zero-value JawsAuth.
+func (a *JawsAuth) HasRole(roles ...string) (yes bool) {
+	if a != nil && a.server != nil {
+		yes = a.server.hasRole(a.Data(), roles)
+	}
+	return
+}
@@ -0,0 +1,107 @@
+package jawsauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/linkdata/jaws"
+)
+
+func TestLookupClaim(t *testing.T) {
+	var claims map[string]any
+	if err := json.Unmarshal([]byte(`{
+		"realm_access": {"roles": ["offline_access", "ops"]},
+		"resource_access": {"my.app": {"roles": ["viewer"]}},
+		"http://schemas.example.com/role": "editor",
+		"groups": ["g1"]
+	}`), &claims); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path  string
+		want  []string
+		found bool
+	}{
+		{"realm_access.roles", []string{"offline_access", "ops"}, true},
+		{"resource_access.my.app.roles", []string{"viewer"}, true},
+		{"http://schemas.example.com/role", []string{"editor"}, true},
+		{"groups", []string{"g1"}, true},
+		{"realm_access.missing", nil, false},
+		{"groups.g1", nil, false},
+	}
+	for _, tt := range tests {
+		value, found := lookupClaim(claims, tt.path)
+		if got := claimStrings(value); found != tt.found || !slices.Equal(got, tt.want) {
+			t.Errorf("%q: got %v %v", tt.path, got, found)
+		}
+	}
+}
+
+func TestServerHasRole(t *testing.T) {
+	claims := map[string]any{
+		"realm_access": map[string]any{"roles": []any{"ops"}},
+		"groups":       []any{"staff"},
+		"roles":        "Reader",
+		"custom":       map[string]any{"teams": []any{"blue"}},
+	}
+	srv := &Server{}
+	if got := srv.claimRoles(claims); !slices.Equal(got, []string{"ops", "staff", "Reader"}) {
+		t.Fatal(got)
+	}
+	if !srv.hasRole(claims, []string{"nope", "staff"}) {
+		t.Fatal("expected staff role")
+	}
+	if srv.hasRole(claims, []string{"reader"}) || srv.hasRole(nil, []string{"ops"}) {
+		t.Fatal("unexpected role")
+	}
+	srv.RoleClaims = []string{"custom.teams"}
+	if !srv.hasRole(claims, []string{"blue"}) || srv.hasRole(claims, []string{"ops"}) {
+		t.Fatal(srv.claimRoles(claims))
+	}
+}
+
+func TestWrapRole(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+	srv := newBearerTestServer(jw)
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/protected", nil)
+	sess := jw.NewSession(httptest.NewRecorder(), req)
+	sess.Set(srv.SessionKey, map[string]any{
+		"realm_access": map[string]any{"roles": []any{"ops"}},
+	})
+	sess.Set(oauth2IDTokenExpiryKey, time.Now().Add(time.Hour))
+
+	ok := testStatusHandler{statusCode: http.StatusNoContent}
+	tests := []struct {
+		h    http.Handler
+		want int
+	}{
+		{srv.WrapRole(ok, "ops"), http.StatusNoContent},
+		{srv.WrapRole(ok, "dev", "ops"), http.StatusNoContent},
+		{srv.WrapRole(ok, "dev"), http.StatusForbidden},
+		{srv.WrapRole(ok), http.StatusNoContent},
+	}
+	for i, tt := range tests {
+		rec := httptest.NewRecorder()
+		tt.h.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%d: got %d", i, rec.Code)
+		}
+	}
+
+	auth := &JawsAuth{server: srv, sess: sess}
+	if !auth.HasRole("ops") || auth.HasRole("dev") {
+		t.Fatal(auth.Data())
+	}
+	if (&JawsAuth{}).HasRole("ops") {
+		t.Fatal("zero-value auth reported role")
+	}
+}
@@ -0,0 +1,113 @@
+package jawsauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"time"
+
+	"github.com/linkdata/jaws"
+	"golang.org/x/oauth2"
+)
+
+const oauth2RefreshTokenKey = "oauth2refreshtoken"
+
+// ErrRefreshTokenReuse means the provider rejected a refresh token with
+// "invalid_grant" and the refresh token presented was older than the one saved
+// in TokenStore. An older token of the same family was presented and the
+// provider may have revoked the family, so the session is revoked. Other
+// "invalid_grant" errors are ordinary refresh failures, since providers do not
+// report reuse in a standard way.
+var ErrRefreshTokenReuse = errors.New("refresh token reuse detected")
+
+type errRefreshTokenReuse struct {
+	cause error
+}
+
+func (e errRefreshTokenReuse) Error() string {
+	return ErrRefreshTokenReuse.Error() + ": " + e.cause.Error()
+}
+
+func (e errRefreshTokenReuse) Unwrap() error {
+	return e.cause
+}
+
+func (e errRefreshTokenReuse) Is(target error) bool {
+	return target == ErrRefreshTokenReuse
+}
+
+func refreshTokenSum(token *oauth2.Token) (sum [32]byte, ok bool) {
+	if token != nil && token.RefreshToken != "" {
+		sum = sha256.Sum256([]byte(token.RefreshToken))
+		ok = true
+	}
+	return
+}
+
+// rememberRefreshToken records the refresh token a newly logged in or resumed
+// session starts with. Only a fingerprint of the token is kept.
+func rememberRefreshToken(sess *jaws.Session, token *oauth2.Token) {
+	sess.Set(oauth2RefreshTokenKey, nil)
+	if sum, ok := refreshTokenSum(token); ok {
+		sess.Set(oauth2RefreshTokenKey, sum)
+	}
+}
+
+// captureRefreshToken makes tokenSource the session's token source and saves
+// it in TokenStore if the refresh token it returned differs from the one the
+// session had, so that a rotated refresh token is kept even if the refresh
+// does not otherwise update the session auth.
+func (srv *Server) captureRefreshToken(sess *jaws.Session, p *provider, tokenSource oauth2.TokenSource, token *oauth2.Token) {
+	if sum, ok := refreshTokenSum(token); ok {
+		if old, had := sess.Get(oauth2RefreshTokenKey).([32]byte); old != sum {
+			sess.Set(oauth2RefreshTokenKey, sum)
+			sess.Set(srv.SessionTokenKey, tokenSource)
+			if had {
+				claims, _ := sess.Get(srv.SessionKey).(map[string]any)
+				expiry, _ := sess.Get(oauth2IDTokenExpiryKey).(time.Time)
+				srv.persistSessionAuth(sess, p, claims, tokenSource, expiry)
+				srv.debugLog("jawsauth: captured rotated refresh token", "session_id", sess.ID())
+			}
+		}
+	}
+}
+
+// checkRefreshTokenReuse returns err wrapped as ErrRefreshTokenReuse if it is
+// an "invalid_grant" error and the refresh token the session presented is not
+// the newest one saved in TokenStore.
+func (srv *Server) checkRefreshTokenReuse(sess *jaws.Session, err error) error {
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) && retrieveErr.ErrorCode == "invalid_grant" && srv.refreshTokenStale(sess) {
+		err = errRefreshTokenReuse{cause: err}
+	}
+	return err
+}
+
+// refreshTokenStale returns true if TokenStore holds a different refresh token
+// for the session than the one it presented, meaning the token was rotated
+// elsewhere and the session presented an old one.
+func (srv *Server) refreshTokenStale(sess *jaws.Session) (stale bool) {
+	if key, ok := sess.Get(oauth2StoreKey).(string); ok && srv.TokenStore != nil {
+		if presented, ok := sess.Get(oauth2RefreshTokenKey).([32]byte); ok {
+			if rec, err := srv.loadTokenRecord(key); err == nil && rec.RefreshToken != "" {
+				stale = sha256.Sum256([]byte(rec.RefreshToken)) != presented
+			}
+		}
+	}
+	return
+}
+
+// refreshTokenReused handles refresh token reuse as a security event. The
+// error is always logged, and if Revoker is set, the provider session is
+// revoked so that other Server instances deny it as well. The caller clears
+// the session auth.
+func (srv *Server) refreshTokenReused(ctx context.Context, sess *jaws.Session, err error) {
+	_ = srv.Jaws.Log(err)
+	if sid, _ := sess.Get(oauth2SidKey).(string); sid != "" && srv.Revoker != nil {
+		rev := Revocation{SID: sid}
+		if p := srv.sessionProvider(sess); p != nil {
+			rev.Issuer = p.issuer
+		}
+		_ = srv.Jaws.Log(srv.Revoke(ctx, rev))
+	}
+}
@@ -0,0 +1,159 @@
+package jawsauth
+
+import (
+	"crypto/sha256"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/linkdata/jaws"
+	"golang.org/x/oauth2"
+)
+
+func TestCheckRefreshTokenReuse(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	srv := newWrapperTestServer(jw, "https://issuer.example")
+	sess := jw.NewSession(nil, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+	rememberRefreshToken(sess, makeOAuth2Token("access", "", "refresh123"))
+	invalidGrant := &oauth2.RetrieveError{ErrorCode: "invalid_grant", ErrorDescription: "Token is not active"}
+	if err = srv.checkRefreshTokenReuse(sess, invalidGrant); err != invalidGrant {
+		t.Fatal(err)
+	}
+	// the provider's description of the error is not trusted to signal reuse
+	reused := &oauth2.RetrieveError{ErrorCode: "invalid_grant", ErrorDescription: "Maximum allowed refresh token reuse exceeded"}
+	if err = srv.checkRefreshTokenReuse(sess, reused); err != reused {
+		t.Fatal(err)
+	}
+
+	// invalid_grant is reuse only if the presented token is not the newest stored
+	srv.TokenStore = NewMemoryTokenStore()
+	sess.Set(oauth2StoreKey, "key")
+	if err = srv.TokenStore.Save("key", &TokenRecord{RefreshToken: "refresh123"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = srv.checkRefreshTokenReuse(sess, invalidGrant); err != invalidGrant {
+		t.Fatal(err)
+	}
+	if err = srv.TokenStore.Save("key", &TokenRecord{RefreshToken: "refresh456"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = srv.checkRefreshTokenReuse(sess, invalidGrant); !errors.Is(err, ErrRefreshTokenReuse) || !errors.Is(err, invalidGrant) {
+		t.Fatal(err)
+	}
+	if got := errorDebugClasses(err); !testStringSliceContains(got, "refresh_token_reuse") {
+		t.Fatal(got)
+	}
+	if err = srv.checkRefreshTokenReuse(sess, &oauth2.RetrieveError{ErrorCode: "invalid_request"}); errors.Is(err, ErrRefreshTokenReuse) {
+		t.Fatal(err)
+	}
+}
+
+func TestAuthTimerCapturesRotatedRefreshTokenAndRevokesOnReuse(t *testing.T) {
+	t.Run("reuse", func(t *testing.T) { testAuthTimerRefreshTokenRotation(t, true) })
+	t.Run("invalid", func(t *testing.T) { testAuthTimerRefreshTokenRotation(t, false) })
+}
+
+func testAuthTimerRefreshTokenRotation(t *testing.T, wantReuse bool) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	const issuer = "https://issuer.example"
+	expiry := time.Now().Add(30 * time.Second).Truncate(time.Second)
+	idToken := makeIDToken(t, map[string]any{
+		"iss": issuer,
+		"aud": "client",
+		"exp": expiry.Unix(),
+		"iat": time.Now().Unix(),
+		"sub": "sub-123",
+		"sid": "sid-1",
+	})
+
+	var mu sync.Mutex
+	var refreshTokens []string
+	provider := httptest.NewServer(http.HandlerFunc(func(hw http.ResponseWriter, hr *http.Request) {
+		_ = hr.ParseForm()
+		mu.Lock()
+		refreshTokens = append(refreshTokens, hr.FormValue("refresh_token"))
+		n := len(refreshTokens)
+		mu.Unlock()
+		hw.Header().Set("Content-Type", "application/json")
+		if n > 1 {
+			hw.WriteHeader(http.StatusBadRequest)
+			_, _ = hw.Write([]byte(`{"error":"invalid_grant","error_description":"Token is not active"}`))
+			return
+		}
+		// rotates the refresh token without issuing a newer id_token
+		_, _ = hw.Write([]byte(`{"access_token":"access2","token_type":"Bearer","expires_in":3600,"refresh_token":"refresh456","id_token":"` + idToken + `"}`))
+	}))
+	defer provider.Close()
+
+	factory := &testAuthTimerFactory{}
+	srv := newTimerTestServer(t, jw, issuer, factory)
+	srv.oauth2cfg.Endpoint.TokenURL = provider.URL
+	srv.TokenStore = NewMemoryTokenStore()
+	srv.Revoker = NewMemoryRevoker(time.Hour)
+	var loggedOut int
+	srv.LogoutEvent = func(*jaws.Session, *http.Request) { loggedOut++ }
+	sess := jw.NewSession(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+	token := makeOAuth2Token("access1", idToken, "refresh123")
+	if err = srv.storeSessionAuthClaims(t.Context(), sess, srv.defaultProvider(), map[string]any{
+		"exp": expiry.Unix(),
+		"sub": "sub-123",
+		"sid": "sid-1",
+	}, oauth2.StaticTokenSource(token), expiry, nil); err != nil {
+		t.Fatal(err)
+	}
+	rememberRefreshToken(sess, token)
+
+	factory.timer(0).fire()
+	if sum, _ := sess.Get(oauth2RefreshTokenKey).([32]byte); sess.Get(srv.SessionKey) == nil || sum != sha256.Sum256([]byte("refresh456")) {
+		t.Fatal("rotation not captured")
+	}
+	key, _ := sess.Get(oauth2StoreKey).(string)
+	if rec, err := srv.TokenStore.Load(key); err != nil || rec.RefreshToken != "refresh456" {
+		t.Fatal(rec, err)
+	}
+
+	// the provider rejects the token, which another instance may have rotated
+	if wantReuse {
+		rec, _ := srv.TokenStore.Load(key)
+		rec.RefreshToken = "refresh789"
+		if err = srv.TokenStore.Save(key, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	factory.timer(1).fire()
+	mu.Lock()
+	got := refreshTokens
+	mu.Unlock()
+	if len(got) != 2 || got[0] != "refresh123" || got[1] != "refresh456" {
+		t.Fatal(got)
+	}
+	if revoked, _ := srv.Revoker.Revoked(t.Context(), Revocation{Issuer: issuer, SID: "sid-1"}, time.Now().Add(-time.Minute)); revoked != wantReuse {
+		t.Fatal("revoked", revoked)
+	}
+	if !wantReuse {
+		// an ordinary refresh failure keeps the still valid auth and retries
+		if sess.Get(srv.SessionKey) == nil || loggedOut != 0 || factory.len() != 3 {
+			t.Fatal(loggedOut, factory.len())
+		}
+		return
+	}
+	if sess.Get(srv.SessionKey) != nil || sess.Get(oauth2RefreshTokenKey) != nil || loggedOut != 1 {
+		t.Fatal(loggedOut)
+	}
+	if factory.len() != 2 {
+		t.Fatal(factory.len())
+	}
+}
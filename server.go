@@ -12,6 +12,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/linkdata/jaws"
@@ -43,6 +44,26 @@ func callbackPathFromURL(u *url.URL) (callbackPath string) {
 	return
 }
 
+// HandlerPaths are the URI paths of the endpoints New and NewDebug register,
+// derived from the path of Config.RedirectURL.
+type HandlerPaths struct {
+	Callback           string // OAuth2 callback, the path of Config.RedirectURL
+	Login              string // HandleLogin, "login" next to Callback
+	Logout             string // HandleLogout, "logout" next to Callback
+	BackChannelLogout  string // HandleBackChannelLogout, "backchannel-logout" next to Callback
+	FrontChannelLogout string // HandleFrontChannelLogout, "frontchannel-logout" next to Callback
+}
+
+func handlerPaths(redirectURL *url.URL) (paths HandlerPaths) {
+	paths.Callback = callbackPathFromURL(redirectURL)
+	dir := path.Dir(path.Clean(paths.Callback))
+	paths.Login = path.Join(dir, "login")
+	paths.Logout = path.Join(dir, "logout")
+	paths.BackChannelLogout = path.Join(dir, "backchannel-logout")
+	paths.FrontChannelLogout = path.Join(dir, "frontchannel-logout")
+	return
+}
+
 // HandleFunc registers handler to serve requests for the given URI path.
 //
 // It matches the shape of http.ServeMux.Handle and is supplied to New and NewDebug
@@ -51,8 +72,8 @@ type HandleFunc func(uri string, handler http.Handler)
 
 // EventFunc is called for login and logout lifecycle events.
 //
-// For a LogoutEvent triggered by an auth-refresh timer rather than an HTTP request,
-// hr may be nil.
+// For a LogoutEvent triggered by an auth-refresh timer or a back-channel logout
+// rather than the user's own HTTP request, hr may be nil.
 type EventFunc func(sess *jaws.Session, hr *http.Request)
 
 // FailedFunc is called when a login attempt fails.
@@ -73,19 +94,51 @@ type Server struct {
 	SessionEmailVerifiedKey string                  // default is "email_verified", value will be of type bool
 	HandledPaths            map[string]struct{}     // URI paths we have registered handlers for
 	LoginEvent              EventFunc               // if not nil, called after a successful login
-	LogoutEvent             EventFunc               // if not nil, called before logout; hr may be nil for timer-driven logout
+	LogoutEvent             EventFunc               // if not nil, called before logout; hr may be nil for timer-driven or back-channel logout
 	LoginFailed             FailedFunc              // if not nil, called on failed login
 	Options                 []oauth2.AuthCodeOption // options to use, see https://pkg.go.dev/golang.org/x/oauth2#AuthCodeOption
+	RPInitiatedLogout       bool                    // if true, HandleLogout also ends the session at the provider's end_session_endpoint
+	LogoutRedirect          string                  // if not empty, the local URI HandleLogout finally redirects to instead of the referrer
+	ProviderChooser         string                  // if not empty, the local URI HandleLogin redirects to when the user must choose a provider
+	BearerAuth              bool                    // if true, Wrap and WrapAdmin also accept "Authorization: Bearer" JWT or introspected opaque access tokens
+	BearerAudience          []string                // audiences accepted for bearer tokens, required for JWT access tokens
+	BearerProvider          string                  // name of the provider that introspects opaque bearer tokens, if empty the only provider with an introspection endpoint
+	RoleClaims              []string                // claim paths holding roles or groups, if empty DefaultRoleClaims
+	RequireEmailVerified    bool                    // if true, logins whose email_verified claim is not true fail with ErrEmailNotVerified, and such users are not administrators
+	AdminEmailVerified      bool                    // if true, only users whose email_verified claim is true can be administrators, without rejecting other logins
+	AllowedEmailDomains     []string                // if not empty, logins whose email domain is not listed fail with ErrDomainNotAllowed
+	AllowedHostedDomains    []string                // if not empty, logins whose "hd" (Google hosted domain) claim is not listed fail with ErrDomainNotAllowed
+	TokenStore              TokenStore              // if not nil, persists session auth so that it survives restarts
+	KeyRing                 *KeyRing                // if not nil, tokens and claims saved in TokenStore are sealed with it
+	Revoker                 Revoker                 // if not nil, consulted by Wrap and the auth-refresh timer to deny revoked sessions
+	RevocationInterval      time.Duration           // how often Wrap consults Revoker for a session, if zero on every request
+	IdleTimeout             time.Duration           // if positive, sessions without activity for this long are logged out
+	MaxLifetime             time.Duration           // if positive, sessions are logged out this long after login even if tokens are refreshed
+	MaxSessionsPerUser      int                     // if positive, the maximum number of simultaneously authenticated sessions per user in this process
+	SessionLimitPolicy      SessionLimitPolicy      // what to do when a login would exceed MaxSessionsPerUser
+	SilentReauth            bool                    // if true, sessions whose auth refresh fails first retry login with prompt=none on their next request
+	RefreshPolicy           RefreshPolicy           // skew, jitter, retry backoff and concurrency of the auth-refresh timer
+	Clock                   Clock                   // if not nil, the time source for expiry checks and the auth-refresh timer
 	oauth2cfg               *oauth2.Config
 	idTokenVerifier         *oidc.IDTokenVerifier
+	accessVerifier          *oidc.IDTokenVerifier
 	userinfoUrl             string
+	endSessionUrl           string
+	introspectionUrl        string
+	issuer                  string
+	providerName            string
 	httpClient              *http.Client
 	ishttps                 bool
-	mu                      sync.Mutex          // protects following
-	admins                  map[string]struct{} // if not empty, emails of admins
-	handle403               http.Handler        // handler for 403 Forbidden
+	loginMu                 sync.Mutex                     // protects pendingLogins
+	pendingLogins           map[*jaws.Session]pendingLogin // logins admitted by limitUserSessions but not yet stored
+	mu                      sync.Mutex                     // protects following
+	admins                  map[string]struct{}            // if not empty, emails of admins
+	handle403               http.Handler                   // handler for 403 Forbidden
 	authTimers              map[uint64]*authTimerState
-	authTimerAfterFunc      authTimerAfterFunc
+	refreshSem              chan struct{}        // limits concurrent refreshes to RefreshPolicy.MaxInFlight
+	providers               map[string]*provider // providers added with AddProvider
+	introspected            map[[32]byte]introspectionEntry
+	restored                map[string]*jaws.Session // sessions restored by ResumeSessions, by TokenStore key
 }
 
 // NewDebug behaves like New but can override the scheme and host of cfg.RedirectURL.
@@ -95,9 +148,10 @@ type Server struct {
 // development.
 //
 // A nil jw returns ErrServerNilJaws and a nil Server. Otherwise a non-nil Server is
-// always returned. OIDC is configured, and the login, logout and callback handlers
-// registered via handleFn, only when cfg, handleFn and cfg.RedirectURL are all provided;
-// any error from OIDC discovery is returned alongside the not-yet-Valid Server.
+// always returned. OIDC is configured, and the login, logout, back- and front-channel
+// logout and callback handlers registered via handleFn, only when cfg, handleFn and
+// cfg.RedirectURL are all provided; any error from OIDC discovery is returned
+// alongside the not-yet-Valid Server.
 func NewDebug(jw *jaws.Jaws, cfg *Config, handleFn HandleFunc, overrideUrl string) (srv *Server, err error) {
 	if jw == nil {
 		err = ErrServerNilJaws
@@ -113,19 +167,28 @@ func NewDebug(jw *jaws.Jaws, cfg *Config, handleFn HandleFunc, overrideUrl strin
 		admins:                  make(map[string]struct{}),
 		handle403:               default403handler{},
 		authTimers:              make(map[uint64]*authTimerState),
-		authTimerAfterFunc:      realAuthTimerAfterFunc,
 	} // #nosec G101
 	if cfg != nil && handleFn != nil && cfg.RedirectURL != "" {
-		if srv.oauth2cfg, srv.userinfoUrl, srv.idTokenVerifier, err = cfg.buildContext(context.Background(), overrideUrl); err == nil {
-			srv.httpClient = cfg.HTTPClient
+		var p *provider
+		if p, err = cfg.buildProvider(context.Background(), overrideUrl, srv.now); err == nil {
+			srv.providerName = p.name
+			srv.oauth2cfg = p.oauth2cfg
+			srv.idTokenVerifier = p.idTokenVerifier
+			srv.accessVerifier = p.accessVerifier
+			srv.userinfoUrl = p.userinfoUrl
+			srv.endSessionUrl = p.endSessionUrl
+			srv.introspectionUrl = p.introspectionUrl
+			srv.issuer = p.issuer
+			srv.httpClient = p.httpClient
 			var u *url.URL
 			if u, err = url.Parse(srv.oauth2cfg.RedirectURL); err == nil {
 				srv.ishttps = (u.Scheme == "https")
-				callbackPath := callbackPathFromURL(u)
-				dir := path.Dir(path.Clean(callbackPath))
-				srv.handlePath(callbackPath, handleFn, http.HandlerFunc(srv.HandleAuthResponse))
-				srv.handlePath(path.Join(dir, "login"), handleFn, http.HandlerFunc(srv.HandleLogin))
-				srv.handlePath(path.Join(dir, "logout"), handleFn, http.HandlerFunc(srv.HandleLogout))
+				paths := handlerPaths(u)
+				srv.handlePath(paths.Callback, handleFn, http.HandlerFunc(srv.HandleAuthResponse))
+				srv.handlePath(paths.Login, handleFn, http.HandlerFunc(srv.HandleLogin))
+				srv.handlePath(paths.Logout, handleFn, http.HandlerFunc(srv.HandleLogout))
+				srv.handlePath(paths.BackChannelLogout, handleFn, http.HandlerFunc(srv.HandleBackChannelLogout))
+				srv.handlePath(paths.FrontChannelLogout, handleFn, http.HandlerFunc(srv.HandleFrontChannelLogout))
 				jw.MakeAuth = srv.makeAuth
 			}
 		}
@@ -135,15 +198,18 @@ func NewDebug(jw *jaws.Jaws, cfg *Config, handleFn HandleFunc, overrideUrl strin
 
 // New creates a Server providing OIDC-verified authentication for JaWS sessions.
 //
-// It configures the Server from cfg and registers the login, logout and OAuth2
-// callback endpoints via handleFn. A nil jw returns ErrServerNilJaws. Use Valid to
-// test whether OIDC authentication was successfully configured.
+// It configures the Server from cfg and registers the login, logout, back- and
+// front-channel logout and OAuth2 callback endpoints via handleFn. A nil jw returns
+// ErrServerNilJaws. Use Valid to test whether OIDC authentication was successfully
+// configured, and AddProvider to configure additional identity providers.
 func New(jw *jaws.Jaws, cfg *Config, handleFn HandleFunc) (srv *Server, err error) {
 	return NewDebug(jw, cfg, handleFn, "")
 }
 
 func (srv *Server) makeAuth(rq *jaws.Request) jaws.Auth {
-	return &JawsAuth{server: srv, sess: srv.Jaws.GetSession(rq.Initial())}
+	sess := srv.Jaws.GetSession(rq.Initial())
+	srv.Touch(sess)
+	return &JawsAuth{server: srv, sess: sess}
 }
 
 func (srv *Server) handlePath(p string, handleFn HandleFunc, h http.Handler) {
@@ -154,6 +220,11 @@ func (srv *Server) handlePath(p string, handleFn HandleFunc, h http.Handler) {
 }
 
 // IsAdmin returns true if email belongs to an admin, if the list of admins is empty, or if srv is nil.
+//
+// IsAdmin only looks email up in the list set by SetAdmins. It is given an email
+// rather than claims, so it cannot know whether the email was verified and
+// ignores AdminEmailVerified and RequireEmailVerified. Use JawsAuth.IsAdmin or
+// AdminPolicy (which WrapAdmin uses) to check an authenticated user.
 func (srv *Server) IsAdmin(email string) (yes bool) {
 	yes = true
 	if srv != nil {
@@ -166,6 +237,15 @@ func (srv *Server) IsAdmin(email string) (yes bool) {
 	return
 }
 
+// isVerifiedAdmin is like IsAdmin, but if AdminEmailVerified or
+// RequireEmailVerified is set it also requires emailVerified to be true.
+func (srv *Server) isVerifiedAdmin(email string, emailVerified bool) (yes bool) {
+	if srv == nil || emailVerified || !(srv.AdminEmailVerified || srv.RequireEmailVerified) {
+		yes = srv.IsAdmin(email)
+	}
+	return
+}
+
 // SetAdmins sets the emails of administrators. If empty, everyone is considered an administrator.
 func (srv *Server) SetAdmins(emails []string) {
 	if srv != nil {
@@ -228,15 +308,23 @@ func (srv *Server) Valid() bool {
 
 // wrap returns a http.Handler that requires an authenticated user before invoking h.
 //
-// When admin is true the user must additionally be an administrator (see SetAdmins),
-// otherwise the 403 handler is served. Unauthenticated requests are redirected into the
-// OIDC login flow (HandleLogin), which verifies the id_token and stores the claims in
-// srv.SessionKey (with optional UserInfo fallback) before the user returns. If the
-// Server is not Valid, returns h.
-func (srv *Server) wrap(h http.Handler, admin bool) (rh http.Handler) {
+// The user must additionally be allowed by all of policies, otherwise the 403 handler
+// is served. Unauthenticated requests are redirected into the OIDC login flow
+// (HandleLogin), which verifies the id_token and stores the claims in srv.SessionKey
+// (with optional UserInfo fallback) before the user returns. If the Server is not
+// Valid, returns h.
+func (srv *Server) wrap(h http.Handler, policies ...Policy) (rh http.Handler) {
 	rh = h
 	if srv.Valid() {
-		rh = wrapper{server: srv, handler: h, admin: admin}
+		w := wrapper{server: srv, handler: h}
+		switch len(policies) {
+		case 0:
+		case 1:
+			w.policy = policies[0]
+		default:
+			w.policy = AllOf(policies...)
+		}
+		rh = w
 	}
 	return
 }
@@ -246,18 +334,28 @@ func (srv *Server) wrap(h http.Handler, admin bool) (rh http.Handler) {
 //
 // Unauthenticated requests are redirected into the OIDC login flow (HandleLogin);
 // authenticated users whose email is not an admin (see SetAdmins and IsAdmin) are
-// served the 403 handler instead of h. If the Server is not Valid, returns h.
+// served the 403 handler instead of h. Bearer tokens are accepted as for Wrap. It is
+// the same as WrapPolicy(h, srv.AdminPolicy()). If the Server is not Valid, returns h.
 func (srv *Server) WrapAdmin(h http.Handler) (rh http.Handler) {
-	return srv.wrap(h, true)
+	return srv.wrap(h, srv.AdminPolicy())
 }
 
 // Wrap returns a http.Handler that requires an authenticated user before invoking h.
 //
 // Unauthenticated requests are redirected into the OIDC login flow (HandleLogin), which
 // verifies the id_token and stores the claims in srv.SessionKey (with optional UserInfo
-// fallback) before the user returns. If the Server is not Valid, returns h.
+// fallback) before the user returns. If BearerAuth is set, requests with an
+// Authorization header are instead authenticated by their bearer access token and
+// rejected with 401 if it is missing or invalid; see RequestAuth. If the Server is
+// not Valid, returns h.
 func (srv *Server) Wrap(h http.Handler) (rh http.Handler) {
-	return srv.wrap(h, false)
+	return srv.wrap(h)
+}
+
+// WrapPolicy is like Wrap, but the user must also be allowed by all of policies,
+// otherwise the 403 handler is served instead of h.
+func (srv *Server) WrapPolicy(h http.Handler, policies ...Policy) (rh http.Handler) {
+	return srv.wrap(h, policies...)
 }
 
 // HandlerAdmin returns a http.Handler that renders the named jaws.Template with dot
@@ -268,7 +366,7 @@ func (srv *Server) Wrap(h http.Handler) (rh http.Handler) {
 // If the Server is not Valid, the template handler is returned without the
 // authentication requirement.
 func (srv *Server) HandlerAdmin(name string, dot any) http.Handler {
-	return srv.wrap(ui.Handler(srv.Jaws, name, dot), true)
+	return srv.wrap(ui.Handler(srv.Jaws, name, dot), srv.AdminPolicy())
 }
 
 // Handler returns a http.Handler that renders the named jaws.Template with dot
@@ -279,5 +377,11 @@ func (srv *Server) HandlerAdmin(name string, dot any) http.Handler {
 // UserInfo fallback) before the user returns. If the Server is not Valid, the template
 // handler is returned without the authentication requirement.
 func (srv *Server) Handler(name string, dot any) http.Handler {
-	return srv.wrap(ui.Handler(srv.Jaws, name, dot), false)
+	return srv.wrap(ui.Handler(srv.Jaws, name, dot))
+}
+
+// HandlerPolicy is like Handler, but the user must also be allowed by all of
+// policies, otherwise the 403 handler is served.
+func (srv *Server) HandlerPolicy(name string, dot any, policies ...Policy) http.Handler {
+	return srv.wrap(ui.Handler(srv.Jaws, name, dot), policies...)
 }
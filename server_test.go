@@ -328,7 +328,7 @@ func TestNewDebugPreservesCallbackTrailingSlash(t *testing.T) {
 	if !srv.Valid() {
 		t.Fatal("server was not valid")
 	}
-	for _, want := range []string{"/oauth2/callback/", "/oauth2/login", "/oauth2/logout"} {
+	for _, want := range []string{"/oauth2/callback/", "/oauth2/login", "/oauth2/logout", "/oauth2/backchannel-logout", "/oauth2/frontchannel-logout"} {
 		if handled[want] == nil {
 			t.Fatalf("missing handled path %s: %#v", want, handled)
 		}
@@ -0,0 +1,127 @@
+package jawsauth
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/linkdata/jaws"
+)
+
+// ErrTooManySessions means a login was rejected because the user already has
+// MaxSessionsPerUser authenticated sessions and SessionLimitPolicy is SessionLimitReject.
+var ErrTooManySessions = errors.New("too many sessions")
+
+// SessionLimitPolicy selects what happens when a login would exceed MaxSessionsPerUser.
+//
+// The limit applies per process: sessions held by other processes sharing a
+// TokenStore are not counted.
+type SessionLimitPolicy int
+
+const (
+	// SessionLimitEvictOldest logs out the user's sessions with the oldest
+	// logins, firing LogoutEvent and reloading them, to make room for the new one.
+	SessionLimitEvictOldest SessionLimitPolicy = iota
+	// SessionLimitReject fails the new login with ErrTooManySessions, which is
+	// passed to LoginFailed.
+	SessionLimitReject
+)
+
+// pendingLogin is a login that passed limitUserSessions but whose session is
+// not yet stored, along with the sessions it will evict.
+type pendingLogin struct {
+	provider string
+	sub      string
+	email    string
+	evict    []*jaws.Session
+}
+
+// matches returns true if the login is for the user with the given sub, or
+// if sub is empty, the given email, at provider p.
+func (pl pendingLogin) matches(p *provider, sub, email string) bool {
+	if pl.provider != p.name {
+		return false
+	}
+	if sub != "" {
+		return pl.sub == sub
+	}
+	return email != "" && pl.email == email
+}
+
+// sameUser returns true if sess is authenticated with provider p as the user
+// with the given sub, or if sub is empty, the given email.
+func (srv *Server) sameUser(sess *jaws.Session, p *provider, sub, email string) bool {
+	claims, _ := sess.Get(srv.SessionKey).(map[string]any)
+	gotProvider, _ := sess.Get(oauth2ProviderKey).(string)
+	if claims == nil || gotProvider != p.name {
+		return false
+	}
+	if sub != "" {
+		gotSub, _ := claims["sub"].(string)
+		return gotSub == sub
+	}
+	return email != "" && claimEmail(claims) == email
+}
+
+// limitUserSessions enforces MaxSessionsPerUser for a new login to sess with
+// the given claims. It either returns ErrTooManySessions, or registers the
+// login as pending and returns the user's oldest sessions that the caller must
+// evict once sess is stored, and then call endPendingLogin. Logins still pending
+// cannot be evicted, so if they alone reach the limit the login is rejected
+// even with SessionLimitEvictOldest.
+//
+// Only the sessions of this process are counted, including those restored by
+// ResumeSessions; records in a TokenStore shared with other processes are not.
+//
+// Only the decision is made under loginMu, so that concurrent logins are
+// counted correctly; storing the session and evicting happen after unlocking.
+func (srv *Server) limitUserSessions(sess *jaws.Session, p *provider, claims map[string]any) (evict []*jaws.Session, err error) {
+	sub, _ := claims["sub"].(string)
+	email := claimEmail(claims)
+	srv.loginMu.Lock()
+	defer srv.loginMu.Unlock()
+	pending := 0
+	var evicting []*jaws.Session
+	for other, pl := range srv.pendingLogins {
+		evicting = append(evicting, pl.evict...)
+		if other != sess && pl.matches(p, sub, email) {
+			pending++
+		}
+	}
+	others := srv.authSessions(func(other *jaws.Session) bool {
+		return other != sess && !slices.Contains(evicting, other) && srv.sameUser(other, p, sub, email)
+	})
+	if excess := pending + len(others) - srv.MaxSessionsPerUser + 1; excess > 0 {
+		if srv.SessionLimitPolicy == SessionLimitReject || excess > len(others) {
+			err = ErrTooManySessions
+		} else {
+			slices.SortFunc(others, func(a, b *jaws.Session) int {
+				aTime, _ := a.Get(oauth2AuthTimeKey).(time.Time)
+				bTime, _ := b.Get(oauth2AuthTimeKey).(time.Time)
+				return cmp.Or(aTime.Compare(bTime), cmp.Compare(a.ID(), b.ID()))
+			})
+			evict = others[:excess]
+		}
+		srv.debugErrorLog("jawsauth: session limit reached", ErrTooManySessions,
+			"session_id", sess.ID(),
+			"sessions", pending+len(others),
+			"max_sessions", srv.MaxSessionsPerUser,
+			"evicted", err == nil,
+		)
+	}
+	if err == nil {
+		if srv.pendingLogins == nil {
+			srv.pendingLogins = make(map[*jaws.Session]pendingLogin)
+		}
+		srv.pendingLogins[sess] = pendingLogin{provider: p.name, sub: sub, email: email, evict: evict}
+	}
+	return
+}
+
+// endPendingLogin removes the pending login for sess registered by limitUserSessions.
+func (srv *Server) endPendingLogin(sess *jaws.Session) {
+	srv.loginMu.Lock()
+	delete(srv.pendingLogins, sess)
+	srv.loginMu.Unlock()
+}
@@ -0,0 +1,133 @@
+package jawsauth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/linkdata/jaws"
+)
+
+func TestMaxSessionsPerUserEvictOldest(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	srv := newWrapperTestServer(jw, "https://issuer.example")
+	srv.Clock = &testAuthTimerFactory{}
+	srv.MaxSessionsPerUser = 2
+	var loggedOut []uint64
+	srv.LogoutEvent = func(sess *jaws.Session, _ *http.Request) {
+		if !srv.loginMu.TryLock() {
+			t.Error("LogoutEvent called with loginMu held")
+		} else {
+			srv.loginMu.Unlock()
+		}
+		loggedOut = append(loggedOut, sess.ID())
+	}
+
+	var sessions []*jaws.Session
+	for range 3 {
+		sess, failedErr := runLoginCallback(t, jw, srv, map[string]any{"email": "user@example.com"})
+		if failedErr != nil {
+			t.Fatal(failedErr)
+		}
+		sessions = append(sessions, sess)
+	}
+	other, failedErr := runLoginCallback(t, jw, srv, map[string]any{"sub": "sub-456", "email": "other@example.com"})
+	if failedErr != nil {
+		t.Fatal(failedErr)
+	}
+	if sessions[0].Get(srv.SessionKey) != nil || sessions[1].Get(srv.SessionKey) == nil || sessions[2].Get(srv.SessionKey) == nil {
+		t.Fatal("oldest session not evicted")
+	}
+	if other.Get(srv.SessionKey) == nil {
+		t.Fatal("other user evicted")
+	}
+	if len(loggedOut) != 1 || loggedOut[0] != sessions[0].ID() {
+		t.Fatal(loggedOut)
+	}
+
+	// refreshing an existing session does not count as a new login
+	if err = srv.refreshSessionAuth(t.Context(), sessions[1], time.Time{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if sessions[2].Get(srv.SessionKey) == nil || len(srv.Sessions()) != 3 {
+		t.Fatal(srv.Sessions())
+	}
+}
+
+func TestMaxSessionsPerUserReject(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	srv := newWrapperTestServer(jw, "https://issuer.example")
+	srv.Clock = &testAuthTimerFactory{}
+	srv.MaxSessionsPerUser = 1
+	srv.SessionLimitPolicy = SessionLimitReject
+
+	first, failedErr := runLoginCallback(t, jw, srv, nil)
+	if failedErr != nil {
+		t.Fatal(failedErr)
+	}
+	second, failedErr := runLoginCallback(t, jw, srv, nil)
+	if !errors.Is(failedErr, ErrTooManySessions) {
+		t.Fatal(failedErr)
+	}
+	if second.Get(srv.SessionKey) != nil || first.Get(srv.SessionKey) == nil {
+		t.Fatal("wrong session authenticated")
+	}
+	if got := errorDebugClasses(failedErr); len(got) != 1 || got[0] != "too_many_sessions" {
+		t.Fatal(got)
+	}
+
+	srv.Logout(first, nil)
+	if _, failedErr = runLoginCallback(t, jw, srv, nil); failedErr != nil {
+		t.Fatal(failedErr)
+	}
+}
+
+func TestMaxSessionsPerUserPendingLogin(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	srv := newWrapperTestServer(jw, "https://issuer.example")
+	srv.MaxSessionsPerUser = 1
+	srv.SessionLimitPolicy = SessionLimitReject
+	p := srv.defaultProvider()
+	claims := map[string]any{"sub": "sub-123"}
+	first := jw.NewSession(nil, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+	second := jw.NewSession(nil, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+
+	if evict, err := srv.limitUserSessions(first, p, claims); err != nil || len(evict) != 0 {
+		t.Fatal(evict, err)
+	}
+	if _, err = srv.limitUserSessions(second, p, claims); !errors.Is(err, ErrTooManySessions) {
+		t.Fatal(err)
+	}
+	srv.endPendingLogin(first)
+	if _, err = srv.limitUserSessions(second, p, claims); err != nil {
+		t.Fatal(err)
+	}
+	srv.endPendingLogin(second)
+
+	// a pending login cannot be evicted, so evicting cannot make room
+	srv.SessionLimitPolicy = SessionLimitEvictOldest
+	if _, err = srv.limitUserSessions(first, p, claims); err != nil {
+		t.Fatal(err)
+	}
+	if evict, err := srv.limitUserSessions(second, p, claims); !errors.Is(err, ErrTooManySessions) {
+		t.Fatal(evict, err)
+	}
+	srv.endPendingLogin(first)
+}
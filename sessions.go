@@ -0,0 +1,90 @@
+package jawsauth
+
+import (
+	"cmp"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/linkdata/jaws"
+)
+
+const oauth2LastRefreshKey = "oauth2lastrefresh"
+
+// SessionInfo describes an authenticated session, as returned by Server.Sessions.
+type SessionInfo struct {
+	ID            uint64     // JaWS session ID
+	Email         string     // email address of the user
+	Issuer        string     // "iss" claim
+	Subject       string     // "sub" claim
+	LoginTime     time.Time  // when the user logged in, zero if unknown
+	IDTokenExpiry time.Time  // when the current id_token expires
+	LastRefresh   time.Time  // when the session auth was last stored or refreshed
+	RemoteIP      netip.Addr // IP address the session is bound to
+}
+
+// Sessions returns a snapshot of the authenticated sessions, ordered by session ID.
+func (srv *Server) Sessions() (infos []SessionInfo) {
+	for _, sess := range srv.authSessions(func(sess *jaws.Session) bool { return sess.Get(srv.SessionKey) != nil }) {
+		claims, _ := sess.Get(srv.SessionKey).(map[string]any)
+		info := SessionInfo{ID: sess.ID(), RemoteIP: sess.IP()}
+		info.Email, _ = sess.Get(srv.SessionEmailKey).(string)
+		info.Issuer, _ = claims["iss"].(string)
+		info.Subject, _ = claims["sub"].(string)
+		info.LoginTime, _ = sess.Get(oauth2LoginTimeKey).(time.Time)
+		info.IDTokenExpiry, _ = sess.Get(oauth2IDTokenExpiryKey).(time.Time)
+		info.LastRefresh, _ = sess.Get(oauth2LastRefreshKey).(time.Time)
+		infos = append(infos, info)
+	}
+	slices.SortFunc(infos, func(a, b SessionInfo) int { return cmp.Compare(a.ID, b.ID) })
+	return
+}
+
+// logoutMatching clears the auth of all authenticated sessions for which match
+// returns true, firing LogoutEvent with a nil request and reloading the session,
+// and returns the number of sessions cleared.
+func (srv *Server) logoutMatching(match func(sess *jaws.Session, claims map[string]any) bool) (n int) {
+	sessions := srv.authSessions(func(sess *jaws.Session) bool {
+		claims, _ := sess.Get(srv.SessionKey).(map[string]any)
+		return claims != nil && match(sess, claims)
+	})
+	for _, sess := range sessions {
+		if srv.clearSessionAuth(sess, nil, true, true, nil) {
+			n++
+		}
+	}
+	return
+}
+
+// LogoutEmail clears the auth of all sessions of the user with the given email
+// address, firing LogoutEvent with a nil request and reloading each session, and
+// returns the number of sessions cleared. Emails are normalized as by SetAdmins.
+//
+// Only sessions of this Server are affected; see Revoke for other instances.
+func (srv *Server) LogoutEmail(email string) (n int) {
+	if email = normalizeEmail(email); email != "" {
+		n = srv.logoutMatching(func(_ *jaws.Session, claims map[string]any) bool {
+			return claimEmail(claims) == email
+		})
+		srv.debugLog("jawsauth: logout email", "email", email, "sessions_cleared", n)
+	}
+	return
+}
+
+// LogoutSubject clears the auth of all sessions whose "iss" and "sub" claims
+// are iss and sub, firing LogoutEvent with a nil request and reloading each
+// session, and returns the number of sessions cleared. Subjects are only unique
+// per issuer, so both are required.
+//
+// Only sessions of this Server are affected; see Revoke for other instances.
+func (srv *Server) LogoutSubject(iss, sub string) (n int) {
+	if iss != "" && sub != "" {
+		n = srv.logoutMatching(func(_ *jaws.Session, claims map[string]any) bool {
+			gotIss, _ := claims["iss"].(string)
+			gotSub, _ := claims["sub"].(string)
+			return gotIss == iss && gotSub == sub
+		})
+		srv.debugLog("jawsauth: logout subject", "iss", iss, "sub", sub, "sessions_cleared", n)
+	}
+	return
+}
@@ -0,0 +1,103 @@
+package jawsauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/linkdata/jaws"
+)
+
+func TestServerSessions(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	srv := newWrapperTestServer(jw, "https://issuer.example")
+	srv.Clock = &testAuthTimerFactory{}
+	if infos := srv.Sessions(); len(infos) != 0 {
+		t.Fatal(infos)
+	}
+	before := time.Now()
+	sess, failedErr := runLoginCallback(t, jw, srv, map[string]any{"email": "User@Example.com"})
+	if failedErr != nil {
+		t.Fatal(failedErr)
+	}
+	other := newBackChannelTestSession(t, jw, srv, "sid-2", "sub-456")
+
+	infos := srv.Sessions()
+	if len(infos) != 2 || infos[0].ID != sess.ID() || infos[1].ID != other.ID() {
+		t.Fatal(infos)
+	}
+	info := infos[0]
+	if info.Email != "user@example.com" || info.Issuer != "https://issuer.example" || info.Subject != "sub-123" || info.RemoteIP != sess.IP() {
+		t.Fatal(info)
+	}
+	if info.LoginTime.Before(before) || !info.LastRefresh.Equal(info.LoginTime) || !info.IDTokenExpiry.After(before) {
+		t.Fatal(info)
+	}
+	if infos[1].Email != "" || infos[1].Subject != "sub-456" || !infos[1].LoginTime.IsZero() {
+		t.Fatal(infos[1])
+	}
+}
+
+func TestServerLogoutEmailAndSubject(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	srv := newWrapperTestServer(jw, "https://issuer.example")
+	srv.Clock = &testAuthTimerFactory{}
+	var loggedOut []uint64
+	srv.LogoutEvent = func(sess *jaws.Session, hr *http.Request) {
+		if hr != nil {
+			t.Error("expected nil request")
+		}
+		loggedOut = append(loggedOut, sess.ID())
+	}
+	newSession := func(iss, sub, email string) *jaws.Session {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/protected", nil)
+		sess := jw.NewSession(httptest.NewRecorder(), req)
+		expiry := time.Now().Add(time.Hour)
+		sess.Set(srv.SessionKey, map[string]any{"iss": iss, "sub": sub, "email": email})
+		sess.Set(srv.SessionEmailKey, email)
+		sess.Set(oauth2IDTokenExpiryKey, expiry)
+		srv.scheduleSessionAuthTimer(sess, expiry)
+		return sess
+	}
+	a1 := newSession("https://issuer.example", "sub-a", "a@example.com")
+	a2 := newSession("https://issuer.example", "sub-a2", "A@Example.com")
+	b := newSession("https://issuer.example", "sub-b", "b@example.com")
+	other := newSession("https://other.example", "sub-b", "other@example.com")
+
+	if n := srv.LogoutEmail(" "); n != 0 {
+		t.Fatal(n)
+	}
+	if n := srv.LogoutEmail("a@EXAMPLE.com"); n != 2 {
+		t.Fatal(n)
+	}
+	if a1.Get(srv.SessionKey) != nil || a2.Get(srv.SessionKey) != nil || b.Get(srv.SessionKey) == nil {
+		t.Fatal("wrong sessions cleared")
+	}
+	if len(loggedOut) != 2 {
+		t.Fatal(loggedOut)
+	}
+
+	if n := srv.LogoutSubject("https://issuer.example", "sub-a"); n != 0 {
+		t.Fatal(n)
+	}
+	if n := srv.LogoutSubject("", "sub-b"); n != 0 {
+		t.Fatal(n)
+	}
+	if n := srv.LogoutSubject("https://issuer.example", "sub-b"); n != 1 {
+		t.Fatal(n)
+	}
+	if b.Get(srv.SessionKey) != nil || other.Get(srv.SessionKey) == nil || len(srv.Sessions()) != 1 || len(loggedOut) != 3 {
+		t.Fatal(srv.Sessions(), loggedOut)
+	}
+}
@@ -0,0 +1,57 @@
+package jawsauth
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/linkdata/jaws"
+	"golang.org/x/oauth2"
+)
+
+const oauth2SilentReauthKey = "oauth2silentreauth"
+const oauth2SilentPendingKey = "oauth2silentpending"
+
+// interactionRequired returns true if err is a callback error meaning the
+// provider cannot log the user in without interaction.
+func interactionRequired(err error) bool {
+	var callbackErr *OAuth2CallbackError
+	if errors.As(err, &callbackErr) {
+		switch callbackErr.Code {
+		case "login_required", "interaction_required", "consent_required", "account_selection_required":
+			return true
+		}
+	}
+	return false
+}
+
+// markSilentReauth records that sess, whose auth refresh with provider p failed,
+// should attempt silent re-authentication on its next request, if SilentReauth is set.
+// The original loginTime is kept so that the re-authentication does not extend
+// MaxLifetime.
+func (srv *Server) markSilentReauth(sess *jaws.Session, p *provider, loginTime time.Time) {
+	if srv.SilentReauth && p != nil {
+		sess.Set(oauth2SilentReauthKey, p.name)
+		if !loginTime.IsZero() {
+			sess.Set(oauth2LoginTimeKey, loginTime)
+		}
+	}
+}
+
+// startSilentReauth starts a prompt=none login for sess if markSilentReauth
+// was called for it, returning to the requested URI, and returns true if it did.
+func (srv *Server) startSilentReauth(hw http.ResponseWriter, hr *http.Request, sess *jaws.Session) (started bool) {
+	if name, ok := sess.Get(oauth2SilentReauthKey).(string); ok {
+		sess.Set(oauth2SilentReauthKey, nil)
+		if p := srv.getProvider(name); srv.SilentReauth && p != nil && hr.Method == http.MethodGet {
+			srv.debugLog("jawsauth: silent re-authentication", "session_id", sess.ID(), "provider", name)
+			srv.startLogin(hw, hr, p, sanitizeRedirectTarget(hr.Host, hr.RequestURI), oauth2.SetAuthURLParam("prompt", "none"))
+			sess.Set(oauth2SilentPendingKey, true)
+			started = true
+		}
+		if !started {
+			sess.Set(oauth2LoginTimeKey, nil)
+		}
+	}
+	return
+}
@@ -0,0 +1,148 @@
+package jawsauth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/linkdata/jaws"
+	"golang.org/x/oauth2"
+)
+
+func TestInteractionRequired(t *testing.T) {
+	for code, want := range map[string]bool{
+		"login_required":             true,
+		"interaction_required":       true,
+		"consent_required":           true,
+		"account_selection_required": true,
+		"access_denied":              false,
+	} {
+		if got := interactionRequired(&OAuth2CallbackError{Code: code}); got != want {
+			t.Error(code, got)
+		}
+	}
+	if interactionRequired(ErrOAuth2MissingState) {
+		t.Error("not a callback error")
+	}
+}
+
+func TestSilentReauthAfterRefreshFailure(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	factory := &testAuthTimerFactory{}
+	srv := newTimerTestServer(t, jw, "https://issuer.example", factory)
+	srv.SilentReauth = true
+	var failed error
+	srv.LoginFailed = func(hw http.ResponseWriter, hr *http.Request, httpCode int, err error, email string) bool {
+		failed = err
+		return false
+	}
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/protected?page=2", nil)
+	sess := jw.NewSession(httptest.NewRecorder(), req)
+	expiry := time.Now().Add(-time.Second).Truncate(time.Second)
+	if err = srv.storeSessionAuthClaims(t.Context(), sess, srv.defaultProvider(), map[string]any{
+		"exp":   expiry.Unix(),
+		"email": "user@example.com",
+	}, tokenSourceFunc(func() (*oauth2.Token, error) {
+		return nil, errAuthSessionTestToken
+	}), expiry, nil); err != nil {
+		t.Fatal(err)
+	}
+	loginTime, _ := sess.Get(oauth2LoginTimeKey).(time.Time)
+	factory.timer(0).fire()
+	assertWrapperAuthCleared(t, srv, sess)
+	if name, ok := sess.Get(oauth2SilentReauthKey).(string); !ok || name != "" {
+		t.Fatal(name, ok)
+	}
+	if got, _ := sess.Get(oauth2LoginTimeKey).(time.Time); loginTime.IsZero() || !got.Equal(loginTime) {
+		t.Fatal("login time not kept for silent re-authentication", got)
+	}
+
+	h := srv.Wrap(testStatusHandler{statusCode: http.StatusNoContent})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusFound || location.Query().Get("prompt") != "none" {
+		t.Fatal(rec.Code, location)
+	}
+	if sess.Get(oauth2SilentReauthKey) != nil || sess.Get(oauth2SilentPendingKey) != true {
+		t.Fatal("silent flow not pending")
+	}
+
+	// the provider requires interaction, so an interactive login starts
+	state, _ := sess.Get(oauth2StateKey).(string)
+	callback := httptest.NewRequest(http.MethodGet, "http://example.com/oauth2/callback?error=login_required&state="+state, nil)
+	callback.AddCookie(req.Cookies()[0])
+	rec = httptest.NewRecorder()
+	srv.HandleAuthResponse(rec, callback)
+	if location, err = url.Parse(rec.Header().Get("Location")); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusFound || location.Host != "provider.example" || location.Query().Has("prompt") || failed != nil {
+		t.Fatal(rec.Code, location, failed)
+	}
+	if got, _ := sess.Get(oauth2ReferrerKey).(string); got != "/protected?page=2" {
+		t.Fatal(got)
+	}
+	if sess.Get(oauth2SilentPendingKey) != nil || sess.Get(oauth2LoginTimeKey) != nil {
+		t.Fatal("silent flow still pending")
+	}
+
+	// the interactive login's errors are reported normally
+	state, _ = sess.Get(oauth2StateKey).(string)
+	callback = httptest.NewRequest(http.MethodGet, "http://example.com/oauth2/callback?error=login_required&state="+state, nil)
+	callback.AddCookie(req.Cookies()[0])
+	rec = httptest.NewRecorder()
+	srv.HandleAuthResponse(rec, callback)
+	if rec.Code != http.StatusBadRequest || !errors.Is(failed, ErrOAuth2Callback) {
+		t.Fatal(rec.Code, failed)
+	}
+}
+
+func TestSilentReauthDisabledOrLoggedOut(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	srv := newWrapperTestServer(jw, "https://issuer.example")
+	h := srv.Wrap(testStatusHandler{statusCode: http.StatusNoContent})
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/protected", nil)
+	sess := jw.NewSession(httptest.NewRecorder(), req)
+
+	srv.markSilentReauth(sess, srv.defaultProvider(), time.Time{})
+	if sess.Get(oauth2SilentReauthKey) != nil {
+		t.Fatal("marked while disabled")
+	}
+
+	srv.SilentReauth = true
+	srv.markSilentReauth(sess, srv.defaultProvider(), time.Time{})
+	srv.SilentReauth = false
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if location, _ := url.Parse(rec.Header().Get("Location")); rec.Code != http.StatusFound || location.Query().Has("prompt") {
+		t.Fatal(rec.Code, location)
+	}
+	if sess.Get(oauth2SilentReauthKey) != nil {
+		t.Fatal("silent flag kept")
+	}
+
+	srv.SilentReauth = true
+	srv.markSilentReauth(sess, srv.defaultProvider(), time.Time{})
+	sess.Set(srv.SessionKey, map[string]any{})
+	srv.Logout(sess, nil)
+	if sess.Get(oauth2SilentReauthKey) != nil {
+		t.Fatal("logout kept silent flag")
+	}
+}
@@ -0,0 +1,132 @@
+package jawsauth
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/linkdata/jaws"
+	"golang.org/x/oauth2"
+)
+
+const oauth2StepUpKey = "oauth2stepup"
+
+// ErrStepUpRequired means a bearer token does not satisfy the acr or
+// max_age required by WrapStepUp.
+var ErrStepUpRequired = errors.New("step-up authentication required")
+
+type stepUp struct {
+	acr    string        // space-separated acceptable "acr" values, if not empty
+	maxAge time.Duration // maximum age of "auth_time", if positive
+}
+
+// satisfied returns true if claims have an acceptable "acr" and an "auth_time"
+// no older than maxAge at now.
+func (su *stepUp) satisfied(claims map[string]any, now time.Time) bool {
+	if su.acr != "" {
+		if acr, _ := claims["acr"].(string); !slices.Contains(strings.Fields(su.acr), acr) {
+			return false
+		}
+	}
+	if su.maxAge > 0 {
+		if authTime := claimTime(claims["auth_time"]); authTime.IsZero() || now.Sub(authTime) > su.maxAge {
+			return false
+		}
+	}
+	return true
+}
+
+func (su *stepUp) maxAgeSeconds() string {
+	return strconv.FormatInt(int64(su.maxAge/time.Second), 10)
+}
+
+// authOptions returns the authorization request parameters asking the provider
+// to reauthenticate the user as required.
+func (su *stepUp) authOptions() (opts []oauth2.AuthCodeOption) {
+	opts = append(opts, oauth2.SetAuthURLParam("prompt", "login"))
+	if su.acr != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("acr_values", su.acr))
+	}
+	if su.maxAge > 0 {
+		opts = append(opts, oauth2.SetAuthURLParam("max_age", su.maxAgeSeconds()))
+	}
+	return
+}
+
+// writeStepUpChallenge responds 401 with an RFC 9470 insufficient_user_authentication challenge.
+func (srv *Server) writeStepUpChallenge(hw http.ResponseWriter, su *stepUp) {
+	challenge := `Bearer error="insufficient_user_authentication", error_description="a different authentication level is required"`
+	if su.acr != "" {
+		challenge += `, acr_values="` + su.acr + `"`
+	}
+	if su.maxAge > 0 {
+		challenge += `, max_age="` + su.maxAgeSeconds() + `"`
+	}
+	hw.Header().Set("WWW-Authenticate", challenge)
+	srv.writeResult(hw, http.StatusUnauthorized, ErrStepUpRequired, nil)
+}
+
+// stepUpReturned is called when the login flow with the given state completes.
+// If it was started by serveStepUp, it records that the user returned from it.
+func stepUpReturned(sess *jaws.Session, state string) {
+	if stepUpState, ok := sess.Get(oauth2StepUpKey).(string); ok {
+		sess.Set(oauth2StepUpKey, nil)
+		if stepUpState == state {
+			sess.Set(oauth2StepUpKey, true)
+		}
+	}
+}
+
+// serveStepUp returns false if the session claims satisfy the step-up
+// requirement. Otherwise it sends the user to the session's provider to
+// reauthenticate, returning to the requested URI, and returns true.
+//
+// If the user already returned from such a reauthentication without satisfying
+// the requirement, the 403 handler is served instead to avoid a redirect loop.
+// A reauthentication that was abandoned is simply started again. Requests other
+// than GET and HEAD cannot be redirected and are also served the 403 handler.
+func (w wrapper) serveStepUp(hw http.ResponseWriter, hr *http.Request, sess *jaws.Session, claims map[string]any) (handled bool) {
+	if w.stepUp.satisfied(claims, w.server.now()) {
+		sess.Set(oauth2StepUpKey, nil)
+		return false
+	}
+	srv := w.server
+	if hr.Method != http.MethodGet && hr.Method != http.MethodHead {
+		srv.debugErrorLog("jawsauth: step-up required", ErrStepUpRequired, "session_id", sess.ID(), "method", hr.Method)
+		srv.get403Handler().ServeHTTP(hw, hr)
+		return true
+	}
+	if returned, _ := sess.Get(oauth2StepUpKey).(bool); returned {
+		sess.Set(oauth2StepUpKey, nil)
+		srv.debugErrorLog("jawsauth: step-up not satisfied after reauthentication", ErrStepUpRequired, "session_id", sess.ID())
+		srv.get403Handler().ServeHTTP(hw, hr)
+		return true
+	}
+	srv.debugLog("jawsauth: step-up reauthentication", "session_id", sess.ID(), "acr_values", w.stepUp.acr, "max_age", w.stepUp.maxAge)
+	srv.startLogin(hw, hr, srv.sessionProvider(sess), sanitizeRedirectTarget(hr.Host, hr.RequestURI), w.stepUp.authOptions()...)
+	sess.Set(oauth2StepUpKey, sess.Get(oauth2StateKey))
+	return true
+}
+
+// WrapStepUp returns a http.Handler that requires an authenticated user who
+// recently authenticated at a sufficient level before invoking h.
+//
+// acr is a space-separated list of acceptable "acr" claim values, and if not
+// empty, one of them must match. If maxAge is positive, the "auth_time" claim
+// must be no older than maxAge. Users that do not satisfy these are sent back
+// to the provider with acr_values, max_age and prompt=login, returning to the
+// requested URI. If the provider still does not satisfy them, or the request is
+// not a GET or HEAD, the 403 handler is served. Bearer tokens that do not
+// satisfy them receive 401 with an "insufficient_user_authentication"
+// challenge. If the Server is not Valid, returns h.
+func (srv *Server) WrapStepUp(h http.Handler, acr string, maxAge time.Duration) (rh http.Handler) {
+	rh = srv.wrap(h)
+	if w, ok := rh.(wrapper); ok {
+		w.stepUp = &stepUp{acr: strings.Join(strings.Fields(acr), " "), maxAge: maxAge}
+		rh = w
+	}
+	return
+}
@@ -0,0 +1,150 @@
+package jawsauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linkdata/jaws"
+)
+
+func TestStepUpSatisfied(t *testing.T) {
+	now := time.Now()
+	recent := float64(now.Add(-time.Minute).Unix())
+	old := float64(now.Add(-time.Hour).Unix())
+	tests := []struct {
+		su     stepUp
+		claims map[string]any
+		want   bool
+	}{
+		{stepUp{}, map[string]any{}, true},
+		{stepUp{acr: "mfa"}, map[string]any{"acr": "mfa"}, true},
+		{stepUp{acr: "mfa phr"}, map[string]any{"acr": "phr"}, true},
+		{stepUp{acr: "mfa"}, map[string]any{"acr": "pwd"}, false},
+		{stepUp{acr: "mfa"}, map[string]any{}, false},
+		{stepUp{maxAge: 5 * time.Minute}, map[string]any{"auth_time": recent}, true},
+		{stepUp{maxAge: 5 * time.Minute}, map[string]any{"auth_time": old}, false},
+		{stepUp{maxAge: 5 * time.Minute}, map[string]any{}, false},
+		{stepUp{acr: "mfa", maxAge: 5 * time.Minute}, map[string]any{"acr": "mfa", "auth_time": old}, false},
+	}
+	for i, tt := range tests {
+		if got := tt.su.satisfied(tt.claims, now); got != tt.want {
+			t.Error(i, got)
+		}
+	}
+}
+
+func TestWrapStepUp(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	srv := newWrapperTestServer(jw, "https://issuer.example")
+	srv.handle403 = testStatusHandler{statusCode: http.StatusForbidden}
+	if h := (&Server{}).WrapStepUp(testStatusHandler{statusCode: http.StatusNoContent}, "mfa", 0); h != (testStatusHandler{statusCode: http.StatusNoContent}) {
+		t.Fatal(h)
+	}
+	h := srv.WrapStepUp(testStatusHandler{statusCode: http.StatusNoContent}, " mfa  phr ", 5*time.Minute)
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/admin?tab=users", nil)
+	req.Header.Set("Referer", "http://example.com/")
+	sess := jw.NewSession(httptest.NewRecorder(), req)
+	claims := map[string]any{"sub": "sub-123", "acr": "pwd", "auth_time": float64(time.Now().Add(-time.Hour).Unix())}
+	sess.Set(srv.SessionKey, claims)
+	sess.Set(oauth2IDTokenExpiryKey, time.Now().Add(time.Hour))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusFound {
+		t.Fatal(rec.Code)
+	}
+	u, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if !strings.HasPrefix(u.String(), "https://provider.example/auth?") ||
+		q.Get("acr_values") != "mfa phr" || q.Get("max_age") != "300" || q.Get("prompt") != "login" || q.Get("state") == "" {
+		t.Fatal(u)
+	}
+	if got, _ := sess.Get(oauth2ReferrerKey).(string); got != "/admin?tab=users" {
+		t.Fatal(got)
+	}
+	if sess.Get(srv.SessionKey) == nil {
+		t.Fatal("step-up cleared auth")
+	}
+
+	// an abandoned reauthentication is started again
+	state := q.Get("state")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusFound {
+		t.Fatal(rec.Code)
+	}
+	if got, _ := sess.Get(oauth2StepUpKey).(string); got == "" || got == state {
+		t.Fatal(got)
+	}
+
+	// other login flows do not count as the reauthentication
+	stepUpReturned(sess, state)
+	if sess.Get(oauth2StepUpKey) != nil {
+		t.Fatal("unrelated login flow completed the step-up")
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusFound {
+		t.Fatal(rec.Code)
+	}
+
+	// requests that cannot be redirected are refused
+	post := httptest.NewRequest(http.MethodPost, "http://example.com/admin?tab=users", nil)
+	for _, c := range req.Cookies() {
+		post.AddCookie(c)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, post)
+	if rec.Code != http.StatusForbidden || rec.Header().Get("Location") != "" {
+		t.Fatal(rec.Code, rec.Header().Get("Location"))
+	}
+
+	// the provider did not satisfy the request
+	state, _ = sess.Get(oauth2StateKey).(string)
+	stepUpReturned(sess, state)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden || sess.Get(oauth2StepUpKey) != nil {
+		t.Fatal(rec.Code)
+	}
+
+	claims["acr"] = "phr"
+	claims["auth_time"] = float64(time.Now().Unix())
+	sess.Set(oauth2StepUpKey, true)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent || sess.Get(oauth2StepUpKey) != nil {
+		t.Fatal(rec.Code)
+	}
+}
+
+func TestWrapStepUpBearerToken(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	srv := newBearerTestServer(jw)
+	h := srv.WrapStepUp(testStatusHandler{statusCode: http.StatusNoContent}, "mfa", time.Minute)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/api", nil)
+	req.Header.Set("Authorization", "Bearer "+makeAccessToken(t, "api", time.Now().Add(time.Hour)))
+	h.ServeHTTP(rec, req)
+	want := `Bearer error="insufficient_user_authentication", error_description="a different authentication level is required", acr_values="mfa", max_age="60"`
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") != want {
+		t.Fatal(rec.Code, rec.Header().Get("WWW-Authenticate"))
+	}
+}
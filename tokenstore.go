@@ -0,0 +1,467 @@
+package jawsauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/linkdata/jaws"
+	"golang.org/x/oauth2"
+)
+
+const oauth2StoreKey = "oauth2storekey"
+const oauth2RemoteIPKey = "oauth2remoteip"
+const tokenStoreCookie = "jawsauth"
+
+// ErrTokenNotFound is returned by TokenStore.Load when no record is stored under the key.
+var ErrTokenNotFound = errors.New("token not found")
+
+var errTokenRecordIP = errors.New("token record bound to another ip")
+
+// TokenRecord is the authentication state of a session persisted in a TokenStore.
+type TokenRecord struct {
+	Provider      string         `json:"provider,omitempty"`      // name of the identity provider
+	AccessToken   string         `json:"access_token,omitempty"`  // OAuth2 access token
+	TokenType     string         `json:"token_type,omitempty"`    // OAuth2 token type, usually "Bearer"
+	RefreshToken  string         `json:"refresh_token,omitempty"` // OAuth2 refresh token
+	Expiry        time.Time      `json:"expiry,omitzero"`         // access token expiry
+	IDToken       string         `json:"id_token,omitempty"`      // raw id_token, used as id_token_hint
+	IDTokenExpiry time.Time      `json:"id_token_expiry"`         // id_token expiry
+	AuthTime      time.Time      `json:"auth_time,omitzero"`      // when the user last authenticated, see Revoker
+	LoginTime     time.Time      `json:"login_time,omitzero"`     // when the user originally logged in, see MaxLifetime
+	RemoteIP      string         `json:"remote_ip,omitempty"`     // IP address the session was bound to at login
+	Claims        map[string]any `json:"claims,omitempty"`        // verified OIDC claims
+	Sealed        []byte         `json:"sealed,omitempty"`        // tokens and claims sealed by a KeyRing, see Seal
+}
+
+// TokenStore persists the authentication state of sessions so that it survives
+// process restarts. Implementations must be safe for concurrent use.
+//
+// Keys are opaque random strings generated by Server.
+type TokenStore interface {
+	// Load returns the record stored under key, or ErrTokenNotFound.
+	Load(key string) (rec *TokenRecord, err error)
+	// Save stores rec under key, replacing any existing record.
+	Save(key string, rec *TokenRecord) (err error)
+	// Delete removes any record stored under key.
+	Delete(key string) (err error)
+	// List returns the keys of all stored records, see Server.ResumeSessions.
+	List() (keys []string, err error)
+}
+
+func cloneTokenRecord(rec *TokenRecord) (clone *TokenRecord) {
+	if rec != nil {
+		clone = new(TokenRecord)
+		*clone = *rec
+		clone.Claims = maps.Clone(rec.Claims)
+		clone.Sealed = slices.Clone(rec.Sealed)
+	}
+	return
+}
+
+// MemoryTokenStore is a TokenStore that keeps records in memory.
+//
+// It does not survive restarts by itself, but is useful for tests and as a
+// building block. The zero value is ready to use.
+type MemoryTokenStore struct {
+	mu      sync.Mutex
+	records map[string]*TokenRecord
+}
+
+// NewMemoryTokenStore returns a new, empty MemoryTokenStore.
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{}
+}
+
+// Load implements TokenStore.
+func (ms *MemoryTokenStore) Load(key string) (rec *TokenRecord, err error) {
+	ms.mu.Lock()
+	rec = cloneTokenRecord(ms.records[key])
+	ms.mu.Unlock()
+	if rec == nil {
+		err = ErrTokenNotFound
+	}
+	return
+}
+
+// Save implements TokenStore.
+func (ms *MemoryTokenStore) Save(key string, rec *TokenRecord) (err error) {
+	ms.mu.Lock()
+	if ms.records == nil {
+		ms.records = make(map[string]*TokenRecord)
+	}
+	ms.records[key] = cloneTokenRecord(rec)
+	ms.mu.Unlock()
+	return
+}
+
+// Delete implements TokenStore.
+func (ms *MemoryTokenStore) Delete(key string) (err error) {
+	ms.mu.Lock()
+	delete(ms.records, key)
+	ms.mu.Unlock()
+	return
+}
+
+// List implements TokenStore.
+func (ms *MemoryTokenStore) List() (keys []string, err error) {
+	ms.mu.Lock()
+	keys = slices.Sorted(maps.Keys(ms.records))
+	ms.mu.Unlock()
+	return
+}
+
+// FileTokenStore is a TokenStore that keeps one JSON file per record in a directory.
+//
+// File names are derived by hashing the key, and files are written atomically
+// with mode 0600. The key is stored in the file so that List can return it.
+type FileTokenStore struct {
+	dir string
+}
+
+// fileTokenRecord is the content of a FileTokenStore file.
+type fileTokenRecord struct {
+	Key string `json:"key,omitempty"`
+	*TokenRecord
+}
+
+// NewFileTokenStore returns a FileTokenStore using dir, creating it with mode 0700
+// if it does not exist.
+func NewFileTokenStore(dir string) (fts *FileTokenStore, err error) {
+	if err = os.MkdirAll(dir, 0o700); err == nil {
+		fts = &FileTokenStore{dir: dir}
+	}
+	return
+}
+
+func (fts *FileTokenStore) filename(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(fts.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// Load implements TokenStore.
+func (fts *FileTokenStore) Load(key string) (rec *TokenRecord, err error) {
+	var fr *fileTokenRecord
+	if fr, err = fts.readFile(fts.filename(key)); err == nil {
+		rec = fr.TokenRecord
+	} else if errors.Is(err, fs.ErrNotExist) {
+		err = ErrTokenNotFound
+	}
+	return
+}
+
+func (fts *FileTokenStore) readFile(fn string) (fr *fileTokenRecord, err error) {
+	var data []byte
+	if data, err = os.ReadFile(fn); err == nil {
+		fr = &fileTokenRecord{TokenRecord: new(TokenRecord)}
+		if err = json.Unmarshal(data, fr); err != nil {
+			fr = nil
+		}
+	}
+	return
+}
+
+// Save implements TokenStore.
+func (fts *FileTokenStore) Save(key string, rec *TokenRecord) (err error) {
+	var data []byte
+	if data, err = json.Marshal(fileTokenRecord{Key: key, TokenRecord: rec}); err == nil {
+		var f *os.File
+		if f, err = os.CreateTemp(fts.dir, ".tmp-*"); err == nil {
+			tmpname := f.Name()
+			_, err = f.Write(data)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err == nil {
+				err = os.Rename(tmpname, fts.filename(key))
+			}
+			if err != nil {
+				_ = os.Remove(tmpname)
+			}
+		}
+	}
+	return
+}
+
+// Delete implements TokenStore.
+func (fts *FileTokenStore) Delete(key string) (err error) {
+	if err = os.Remove(fts.filename(key)); errors.Is(err, fs.ErrNotExist) {
+		err = nil
+	}
+	return
+}
+
+// List implements TokenStore. Files that cannot be read or that were written
+// without a key are skipped.
+func (fts *FileTokenStore) List() (keys []string, err error) {
+	var entries []os.DirEntry
+	if entries, err = os.ReadDir(fts.dir); err == nil {
+		for _, entry := range entries {
+			if name := entry.Name(); entry.Type().IsRegular() && filepath.Ext(name) == ".json" {
+				if fr, e := fts.readFile(filepath.Join(fts.dir, name)); e == nil && fr.Key != "" && fts.filename(fr.Key) == filepath.Join(fts.dir, name) {
+					keys = append(keys, fr.Key)
+				}
+			}
+		}
+		slices.Sort(keys)
+	}
+	return
+}
+
+// persistSessionAuth saves the session's auth state in TokenStore, if set.
+func (srv *Server) persistSessionAuth(sess *jaws.Session, p *provider, claims map[string]any, tokenSource oauth2.TokenSource, expiry time.Time) {
+	if srv.TokenStore != nil && tokenSource != nil {
+		token, err := tokenSource.Token()
+		if err == nil {
+			key, _ := sess.Get(oauth2StoreKey).(string)
+			if key == "" {
+				key = randomHexString()
+				sess.Set(oauth2StoreKey, key)
+			}
+			idToken, _ := token.Extra("id_token").(string)
+			authTime, _ := sess.Get(oauth2AuthTimeKey).(time.Time)
+			loginTime, _ := sess.Get(oauth2LoginTimeKey).(time.Time)
+			remoteIP, _ := sess.Get(oauth2RemoteIPKey).(string)
+			if remoteIP == "" && sess.IP().IsValid() {
+				remoteIP = sess.IP().String()
+				sess.Set(oauth2RemoteIPKey, remoteIP)
+			}
+			err = srv.saveTokenRecord(key, &TokenRecord{
+				Provider:      p.name,
+				AccessToken:   token.AccessToken,
+				TokenType:     token.TokenType,
+				RefreshToken:  token.RefreshToken,
+				Expiry:        token.Expiry,
+				IDToken:       idToken,
+				IDTokenExpiry: expiry,
+				AuthTime:      authTime,
+				LoginTime:     loginTime,
+				RemoteIP:      remoteIP,
+				Claims:        claims,
+			})
+		}
+		_ = srv.Jaws.Log(err)
+	}
+}
+
+// saveTokenRecord saves rec in TokenStore, sealed with KeyRing if set.
+func (srv *Server) saveTokenRecord(key string, rec *TokenRecord) (err error) {
+	if srv.KeyRing != nil {
+		rec, err = rec.Seal(srv.KeyRing, key)
+	}
+	if err == nil {
+		err = srv.TokenStore.Save(key, rec)
+	}
+	return
+}
+
+// loadTokenRecord loads the record stored under key in TokenStore, opening it
+// with KeyRing if set. Records sealed with a key other than the primary are
+// resealed with the primary key.
+func (srv *Server) loadTokenRecord(key string) (rec *TokenRecord, err error) {
+	if rec, err = srv.TokenStore.Load(key); err == nil && srv.KeyRing != nil {
+		var keyID string
+		if rec, keyID, err = rec.Open(srv.KeyRing, key); err == nil && keyID != srv.KeyRing.Primary() {
+			_ = srv.Jaws.Log(srv.saveTokenRecord(key, rec))
+		}
+	}
+	return
+}
+
+// forgetSessionAuth deletes the session's auth state from TokenStore, if set.
+func (srv *Server) forgetSessionAuth(sess *jaws.Session) {
+	if key, ok := sess.Get(oauth2StoreKey).(string); ok {
+		sess.Set(oauth2StoreKey, nil)
+		srv.mu.Lock()
+		if srv.restored[key] == sess {
+			delete(srv.restored, key)
+		}
+		srv.mu.Unlock()
+		if srv.TokenStore != nil {
+			_ = srv.Jaws.Log(srv.TokenStore.Delete(key))
+		}
+	}
+}
+
+// clearTokenStoreCookie expires the cookie set by setTokenStoreCookie.
+func (srv *Server) clearTokenStoreCookie(hw http.ResponseWriter) {
+	if srv.TokenStore != nil {
+		http.SetCookie(hw, &http.Cookie{
+			Name:     tokenStoreCookie,
+			Path:     "/",
+			MaxAge:   -1,
+			Secure:   srv.ishttps,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+}
+
+// setTokenStoreCookie sets the cookie used to find the session's persisted
+// auth state after a restart.
+func (srv *Server) setTokenStoreCookie(hw http.ResponseWriter, sess *jaws.Session) {
+	if key, ok := sess.Get(oauth2StoreKey).(string); ok && srv.TokenStore != nil {
+		http.SetCookie(hw, &http.Cookie{
+			Name:     tokenStoreCookie,
+			Value:    key,
+			Path:     "/",
+			Secure:   srv.ishttps,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+}
+
+// resumeSession rehydrates sess from the auth state persisted in TokenStore
+// under the key in the request's cookie, and returns true if it did.
+//
+// The record is only resumed from the IP address the session was bound to at
+// login, as JaWS binds its own sessions. Any other session still holding the
+// key, whether live or restored by ResumeSessions, is retired first so that a
+// refresh token is never shared between sessions.
+func (srv *Server) resumeSession(hr *http.Request, sess *jaws.Session) (resumed bool) {
+	if srv.TokenStore != nil {
+		if cookie, err := hr.Cookie(tokenStoreCookie); err == nil && cookie.Value != "" {
+			resumed = srv.restoreSession(hr.Context(), hr, sess, cookie.Value)
+			srv.debugLog("jawsauth: resume session from token store", "session_id", sess.ID(), "resumed", resumed)
+		}
+	}
+	return
+}
+
+// ResumeSessions restores every session persisted in TokenStore into a JaWS
+// session of its own and reschedules its auth-refresh timer, so that refresh,
+// Sessions, LogoutEmail, LogoutSubject, Revoke, back-channel logout and
+// MaxSessionsPerUser cover sessions from before a restart even before their
+// users return. Call it once at startup, after any AddProvider calls.
+//
+// When a user returns, their restored session is replaced by the one bound to
+// their browser. It returns the number of sessions restored.
+func (srv *Server) ResumeSessions(ctx context.Context) (n int, err error) {
+	err = ErrOAuth2NotConfigured
+	if srv != nil && srv.TokenStore != nil {
+		var keys []string
+		if keys, err = srv.TokenStore.List(); err == nil {
+			for _, key := range keys {
+				var hr *http.Request
+				if hr, err = http.NewRequestWithContext(ctx, http.MethodGet, "/", nil); err == nil {
+					sess := srv.Jaws.NewSession(nil, hr)
+					if srv.restoreSession(ctx, nil, sess, key) {
+						srv.mu.Lock()
+						if srv.restored == nil {
+							srv.restored = make(map[string]*jaws.Session)
+						}
+						srv.restored[key] = sess
+						srv.mu.Unlock()
+						n++
+					}
+				}
+			}
+		}
+		srv.debugLog("jawsauth: resume sessions from token store", "sessions", n, "keys", len(keys))
+	}
+	return
+}
+
+// retireStoreKeyHolders stops and clears every session other than keep that
+// holds the TokenStore key, including one ResumeSessions restored, keeping the
+// record in TokenStore and reloading the sessions without firing LogoutEvent.
+func (srv *Server) retireStoreKeyHolders(key string, keep *jaws.Session) {
+	holders := srv.authSessions(func(sess *jaws.Session) bool {
+		got, _ := sess.Get(oauth2StoreKey).(string)
+		return sess != keep && got == key
+	})
+	srv.mu.Lock()
+	if sess := srv.restored[key]; sess != nil && sess != keep {
+		if !slices.Contains(holders, sess) {
+			holders = append(holders, sess)
+		}
+		delete(srv.restored, key)
+	}
+	srv.mu.Unlock()
+	for _, sess := range holders {
+		sess.Set(oauth2StoreKey, nil)
+		srv.clearSessionAuth(sess, nil, false, true, nil)
+	}
+}
+
+// restoreSession rehydrates sess from the auth state persisted in TokenStore
+// under key, and returns true if it did. If hr is not nil, the record must be
+// bound to the IP address of sess. Other sessions holding key are retired.
+//
+// Records that fail to open with KeyRing are ignored, as are records without a
+// login time if MaxLifetime is set. The auth-refresh timer is
+// rescheduled, and if the id_token has already expired, the session is refreshed
+// immediately using the stored refresh token.
+func (srv *Server) restoreSession(ctx context.Context, hr *http.Request, sess *jaws.Session, key string) (resumed bool) {
+	rec, err := srv.loadTokenRecord(key)
+	if err == nil && hr != nil && rec.RemoteIP != "" && (!sess.IP().IsValid() || rec.RemoteIP != sess.IP().String()) {
+		err = errTokenRecordIP
+	}
+	if err == nil {
+		p := srv.getProvider(rec.Provider)
+		loginTime := rec.LoginTime
+		if loginTime.IsZero() {
+			loginTime = rec.AuthTime
+		}
+		// without a login time, MaxLifetime could not be enforced
+		if p.valid() && !rec.IDTokenExpiry.IsZero() && rec.Claims != nil && (srv.MaxLifetime <= 0 || !loginTime.IsZero()) {
+			srv.retireStoreKeyHolders(key, sess)
+			token := (&oauth2.Token{
+				AccessToken:  rec.AccessToken,
+				TokenType:    rec.TokenType,
+				RefreshToken: rec.RefreshToken,
+				Expiry:       rec.Expiry,
+			}).WithExtra(map[string]any{"id_token": rec.IDToken})
+			verified := extractEmailVerified(rec.Claims)
+			sid, _ := rec.Claims["sid"].(string)
+			sess.Set(srv.SessionKey, rec.Claims)
+			sess.Set(srv.SessionTokenKey, p.oauth2cfg.TokenSource(srv.providerContext(context.Background(), p), token))
+			rememberRefreshToken(sess, token)
+			sess.Set(oauth2IDTokenExpiryKey, rec.IDTokenExpiry)
+			sess.Set(srv.SessionEmailKey, srv.extractEmail(rec.Claims))
+			sess.Set(srv.SessionEmailVerifiedKey, verified)
+			sess.Set(oauth2SidKey, sid)
+			sess.Set(oauth2ProviderKey, p.name)
+			sess.Set(oauth2StoreKey, key)
+			if rec.RemoteIP != "" {
+				sess.Set(oauth2RemoteIPKey, rec.RemoteIP)
+			}
+			if !rec.AuthTime.IsZero() {
+				sess.Set(oauth2AuthTimeKey, rec.AuthTime)
+			}
+			if !loginTime.IsZero() {
+				sess.Set(oauth2LoginTimeKey, loginTime)
+			}
+			sess.Set(oauth2LastActivityKey, srv.now())
+			srv.scheduleSessionAuthTimer(sess, rec.IDTokenExpiry)
+			resumed = true
+			if !rec.IDTokenExpiry.After(srv.now()) {
+				if err = srv.refreshSessionAuth(ctx, sess, time.Time{}, nil); err != nil {
+					if errors.Is(err, ErrRefreshTokenReuse) {
+						srv.refreshTokenReused(ctx, sess, err)
+					}
+					srv.clearSessionAuth(sess, hr, false, false, nil)
+					resumed = false
+				}
+			}
+			if resumed {
+				srv.Jaws.Dirty(sess)
+			}
+		}
+	}
+	if err != nil && !errors.Is(err, ErrTokenNotFound) {
+		_ = srv.Jaws.Log(err)
+	}
+	return
+}
@@ -0,0 +1,362 @@
+package jawsauth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/linkdata/jaws"
+)
+
+func testTokenStore(t *testing.T, store TokenStore) {
+	t.Helper()
+	if _, err := store.Load("missing"); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatal(err)
+	}
+	expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+	rec := &TokenRecord{
+		Provider:      "primary",
+		AccessToken:   "access",
+		RefreshToken:  "refresh",
+		IDTokenExpiry: expiry,
+		Claims:        map[string]any{"sub": "sub-123"},
+	}
+	if err := store.Save("key", rec); err != nil {
+		t.Fatal(err)
+	}
+	rec.Claims["sub"] = "modified"
+	got, err := store.Load("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.RefreshToken != "refresh" || !got.IDTokenExpiry.Equal(expiry) || got.Claims["sub"] != "sub-123" {
+		t.Fatal(got)
+	}
+	if err = store.Save("another", rec); err != nil {
+		t.Fatal(err)
+	}
+	if keys, err := store.List(); err != nil || !slices.Equal(keys, []string{"another", "key"}) {
+		t.Fatal(keys, err)
+	}
+	if err = store.Delete("another"); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Delete("key"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.Load("key"); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatal(err)
+	}
+	if err = store.Delete("key"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMemoryTokenStore(t *testing.T) {
+	testTokenStore(t, NewMemoryTokenStore())
+	testTokenStore(t, &MemoryTokenStore{})
+}
+
+func TestFileTokenStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileTokenStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testTokenStore(t, store)
+
+	if err = store.Save("../escape", &TokenRecord{}); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatal(entries)
+	}
+	if info, err := entries[0].Info(); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatal(info.Mode(), err)
+	}
+	if err = os.WriteFile(store.filename("corrupt"), []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if rec, err := store.Load("corrupt"); err == nil || rec != nil {
+		t.Fatal(rec, err)
+	}
+	if err = os.WriteFile(store.filename("keyless"), []byte("{}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if keys, err := store.List(); err != nil || !slices.Equal(keys, []string{"../escape"}) {
+		t.Fatal(keys, err)
+	}
+}
+
+func TestServerTokenStoreResume(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	store := NewMemoryTokenStore()
+	srv := newWrapperTestServer(jw, "https://issuer.example")
+	srv.TokenStore = store
+	factory := &testAuthTimerFactory{}
+	srv.Clock = factory
+	sess, failedErr := runLoginCallback(t, jw, srv, map[string]any{"email": "user@example.com", "sid": "sid-1"})
+	if failedErr != nil {
+		t.Fatal(failedErr)
+	}
+	key, _ := sess.Get(oauth2StoreKey).(string)
+	if key == "" {
+		t.Fatal("missing store key")
+	}
+	rec, err := store.Load(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.AccessToken != "token123" || rec.IDToken == "" || rec.Claims["sub"] != "sub-123" {
+		t.Fatal(rec)
+	}
+
+	// simulate a restart with a fresh JaWS and Server sharing the store
+	jw2, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw2.Close()
+	srv2 := newWrapperTestServer(jw2, "https://issuer.example")
+	srv2.oauth2cfg = srv.oauth2cfg
+	srv2.idTokenVerifier = srv.idTokenVerifier
+	srv2.TokenStore = store
+	srv2.Clock = factory
+
+	var gotEmail string
+	h := srv2.Wrap(http.HandlerFunc(func(hw http.ResponseWriter, hr *http.Request) {
+		gotEmail = srv2.RequestAuth(hr).Email()
+		hw.WriteHeader(http.StatusNoContent)
+	}))
+	rec2 := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/protected", nil)
+	req.AddCookie(&http.Cookie{Name: tokenStoreCookie, Value: key})
+	h.ServeHTTP(rec2, req)
+	if rec2.Code != http.StatusNoContent || gotEmail != "user@example.com" {
+		t.Fatal(rec2.Code, gotEmail)
+	}
+	sess2 := jw2.GetSession(req)
+	if sid, _ := sess2.Get(oauth2SidKey).(string); sid != "sid-1" {
+		t.Fatal(sid)
+	}
+	if hint := srv2.sessionIDTokenHint(sess2); hint != rec.IDToken {
+		t.Fatal(hint)
+	}
+	srv2.mu.Lock()
+	scheduled := srv2.authTimers[sess2.ID()] != nil
+	srv2.mu.Unlock()
+	if !scheduled {
+		t.Fatal("auth timer not rescheduled")
+	}
+
+	// an expired id_token is refreshed while resuming
+	rec.IDTokenExpiry = time.Now().Add(-time.Minute)
+	if err = store.Save(key, rec); err != nil {
+		t.Fatal(err)
+	}
+	srv2.Logout(sess2, nil)
+	if err = store.Save(key, rec); err != nil {
+		t.Fatal(err)
+	}
+	rec2 = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/protected", nil)
+	req.AddCookie(&http.Cookie{Name: tokenStoreCookie, Value: key})
+	h.ServeHTTP(rec2, req)
+	if rec2.Code != http.StatusNoContent {
+		t.Fatal(rec2.Code)
+	}
+	sess2 = jw2.GetSession(req)
+	if expiry, _ := sess2.Get(oauth2IDTokenExpiryKey).(time.Time); !expiry.After(time.Now()) {
+		t.Fatal(expiry)
+	}
+
+	srv2.Logout(sess2, nil)
+	if _, err = store.Load(key); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatal(err)
+	}
+	rec2 = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/protected", nil)
+	req.AddCookie(&http.Cookie{Name: tokenStoreCookie, Value: key})
+	h.ServeHTTP(rec2, req)
+	if rec2.Code != http.StatusFound {
+		t.Fatal(rec2.Code)
+	}
+}
+
+func TestServerTokenStoreResumeLiveSession(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	store := NewMemoryTokenStore()
+	srv := newWrapperTestServer(jw, "https://issuer.example")
+	srv.TokenStore = store
+	srv.Clock = &testAuthTimerFactory{}
+	sess, failedErr := runLoginCallback(t, jw, srv, map[string]any{"email": "user@example.com"})
+	if failedErr != nil {
+		t.Fatal(failedErr)
+	}
+	key, _ := sess.Get(oauth2StoreKey).(string)
+	if rec, err := store.Load(key); err != nil || rec.RemoteIP != sess.IP().String() {
+		t.Fatal(rec.RemoteIP, err)
+	}
+
+	h := srv.Wrap(http.HandlerFunc(func(hw http.ResponseWriter, hr *http.Request) {
+		hw.WriteHeader(http.StatusNoContent)
+	}))
+
+	// the cookie is not honored from another IP address
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/protected", nil)
+	req.RemoteAddr = "198.51.100.7:1234"
+	req.AddCookie(&http.Cookie{Name: tokenStoreCookie, Value: key})
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusFound {
+		t.Fatal(rec.Code)
+	}
+	if got, _ := sess.Get(oauth2StoreKey).(string); got != key || sess.Get(srv.SessionKey) == nil {
+		t.Fatal("original session retired")
+	}
+
+	// resuming while the original session is live retires the original
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/protected", nil)
+	req.AddCookie(&http.Cookie{Name: tokenStoreCookie, Value: key})
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatal(rec.Code)
+	}
+	sess2 := jw.GetSession(req)
+	if sess2 == nil || sess2 == sess {
+		t.Fatal(sess2)
+	}
+	if got, _ := sess2.Get(oauth2StoreKey).(string); got != key {
+		t.Fatal(got)
+	}
+	if sess.Get(oauth2StoreKey) != nil || sess.Get(srv.SessionKey) != nil {
+		t.Fatal("original session still holds the record")
+	}
+	if srv.Logout(sess, nil); sess2.Get(srv.SessionKey) == nil {
+		t.Fatal("resumed session logged out")
+	}
+	if _, err = store.Load(key); err != nil {
+		t.Fatal(err)
+	}
+
+	// HandleLogout deletes the record and expires the cookie
+	rec = httptest.NewRecorder()
+	logoutReq := httptest.NewRequest(http.MethodGet, "http://example.com/logout", nil)
+	for _, c := range req.Cookies() {
+		logoutReq.AddCookie(c)
+	}
+	srv.HandleLogout(rec, logoutReq)
+	if _, err = store.Load(key); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatal(err)
+	}
+	var expired bool
+	for _, c := range rec.Result().Cookies() {
+		expired = expired || (c.Name == tokenStoreCookie && c.MaxAge < 0)
+	}
+	if !expired {
+		t.Fatal(rec.Result().Cookies())
+	}
+}
+
+func TestServerResumeSessions(t *testing.T) {
+	jw, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+
+	store := NewMemoryTokenStore()
+	srv := newWrapperTestServer(jw, "https://issuer.example")
+	srv.TokenStore = store
+	factory := &testAuthTimerFactory{}
+	srv.Clock = factory
+	var keys []string
+	for _, sid := range []string{"sid-1", "sid-2"} {
+		sess, failedErr := runLoginCallback(t, jw, srv, map[string]any{"email": "user@example.com", "sid": sid})
+		if failedErr != nil {
+			t.Fatal(failedErr)
+		}
+		key, _ := sess.Get(oauth2StoreKey).(string)
+		keys = append(keys, key)
+	}
+
+	// simulate a restart with a fresh JaWS and Server sharing the store
+	jw2, err := jaws.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw2.Close()
+	srv2 := newWrapperTestServer(jw2, "https://issuer.example")
+	srv2.oauth2cfg = srv.oauth2cfg
+	srv2.idTokenVerifier = srv.idTokenVerifier
+	srv2.TokenStore = store
+	srv2.Clock = factory
+	srv2.MaxSessionsPerUser = 2
+	srv2.SessionLimitPolicy = SessionLimitReject
+
+	if n, err := (&Server{}).ResumeSessions(t.Context()); n != 0 || !errors.Is(err, ErrOAuth2NotConfigured) {
+		t.Fatal(n, err)
+	}
+	n, err := srv2.ResumeSessions(t.Context())
+	if n != 2 || err != nil {
+		t.Fatal(n, err)
+	}
+	if infos := srv2.Sessions(); len(infos) != 2 || infos[0].Email != "user@example.com" {
+		t.Fatal(infos)
+	}
+	if _, failedErr := runLoginCallback(t, jw2, srv2, map[string]any{"email": "user@example.com", "sid": "sid-3"}); !errors.Is(failedErr, ErrTooManySessions) {
+		t.Fatal(failedErr)
+	}
+
+	// the returning user replaces the restored session
+	h := srv2.Wrap(http.HandlerFunc(func(hw http.ResponseWriter, hr *http.Request) {
+		hw.WriteHeader(http.StatusNoContent)
+	}))
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/protected", nil)
+	req.AddCookie(&http.Cookie{Name: tokenStoreCookie, Value: keys[0]})
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatal(rec.Code)
+	}
+	sess := jw2.GetSession(req)
+	infos := srv2.Sessions()
+	if len(infos) != 2 || !slices.ContainsFunc(infos, func(info SessionInfo) bool { return info.ID == sess.ID() }) {
+		t.Fatal(infos)
+	}
+	if _, err = store.Load(keys[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if n = srv2.LogoutEmail("user@example.com"); n != 2 {
+		t.Fatal(n)
+	}
+	if keys, err := store.List(); err != nil || len(keys) != 0 {
+		t.Fatal(keys, err)
+	}
+	srv2.mu.Lock()
+	restored := len(srv2.restored)
+	srv2.mu.Unlock()
+	if restored != 0 {
+		t.Fatal(restored)
+	}
+}
@@ -2,34 +2,73 @@ package jawsauth
 
 import (
 	"net/http"
-	"time"
 )
 
 type wrapper struct {
 	server  *Server
 	handler http.Handler
-	admin   bool
+	policy  Policy  // if not nil, must allow the user
+	stepUp  *stepUp // if not nil, the user must satisfy it, see WrapStepUp
+}
+
+// serveAllowed invokes h if the policy allows the user with the given claims,
+// otherwise the 403 handler, or a 500 response if the policy fails.
+func (w wrapper) serveAllowed(hw http.ResponseWriter, hr *http.Request, h http.Handler, claims map[string]any) {
+	if w.policy != nil {
+		allowed, err := w.policy.Allow(hr.Context(), claims, hr)
+		if err != nil {
+			w.server.debugErrorLog("jawsauth: policy failed", err)
+			w.server.writeResult(hw, http.StatusInternalServerError, err, nil)
+			return
+		}
+		if !allowed {
+			h = w.server.get403Handler()
+		}
+	}
+	h.ServeHTTP(hw, hr)
 }
 
 func (w wrapper) ServeHTTP(hw http.ResponseWriter, hr *http.Request) {
 	h := w.handler
+	if w.server.BearerAuth {
+		if rawToken, present := bearerToken(hr); present {
+			w.serveBearer(hw, hr, rawToken)
+			return
+		}
+	}
 	sess := w.server.Jaws.GetSession(hr)
 	if sess == nil {
 		sess = w.server.Jaws.NewSession(hw, hr)
 	}
-	if current, present := w.server.sessionAuthStatus(sess, time.Now); !current {
+	current, present := w.server.sessionAuthStatus(sess, w.server.now)
+	if !present && w.server.resumeSession(hr, sess) {
+		current, present = w.server.sessionAuthStatus(sess, w.server.now)
+	}
+	if current && w.server.sessionRevoked(hr.Context(), sess, false) {
+		current = false
+	}
+	if current {
+		if err := w.server.sessionExpired(sess, w.server.now()); err != nil {
+			w.server.debugErrorLog("jawsauth: session expired", err, "session_id", sess.ID())
+			current = false
+		} else {
+			w.server.Touch(sess)
+		}
+	}
+	if !current {
 		if present {
 			w.server.clearSessionAuth(sess, hr, true, false, nil)
 		}
+		if w.server.startSilentReauth(hw, hr, sess) {
+			return
+		}
 		w.server.HandleLogin(hw, hr)
 		return
 	}
 
-	if w.admin {
-		email, _ := sess.Get(w.server.SessionEmailKey).(string)
-		if !w.server.IsAdmin(email) {
-			h = w.server.get403Handler()
-		}
+	claims, _ := sess.Get(w.server.SessionKey).(map[string]any)
+	if w.stepUp != nil && w.serveStepUp(hw, hr, sess, claims) {
+		return
 	}
-	h.ServeHTTP(hw, hr)
+	w.serveAllowed(hw, hr, h, claims)
 }
@@ -51,7 +51,7 @@ func TestWrapperServeHTTPSet403HandlerConcurrent(t *testing.T) {
 	w := wrapper{
 		server:  srv,
 		handler: testStatusHandler{statusCode: http.StatusOK},
-		admin:   true,
+		policy:  srv.AdminPolicy(),
 	}
 
 	var wg sync.WaitGroup
@@ -299,6 +299,7 @@ func newWrapperTestServer(jw *jaws.Jaws, issuer string) *Server {
 			RedirectURL: "http://example.com/oauth2/callback",
 		},
 		idTokenVerifier: oidc.NewVerifier(issuer, passthroughKeySet{}, &oidc.Config{ClientID: "client"}),
+		issuer:          issuer,
 	}
 }
 